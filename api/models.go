@@ -0,0 +1,100 @@
+package api
+
+import (
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/crsf"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// Backend is what the api reads from and controls, the app implements it
+type Backend interface {
+	Status() Status
+	Profiles() []profiles.Profile
+	SelectProfile(name string) error
+	UpdateProfile(profile profiles.Profile) error
+	DeleteProfile(name string) error
+	SetTrims(trims map[string]int) error
+}
+
+type Status struct {
+	Time      time.Time
+	Profile   string
+	Frame     sbus.Frame //mixed frame before output mapping
+	Output    sbus.Frame //frame sent to the sbus tx ports
+	MixState  models.MixState
+	Inputs    []models.Input //axis inputs (steer, pedals, handbrake) after merging controllers
+	FFLevel   float64
+	Arming    ArmingStatus
+	EStop     EStopStatus
+	Watchdog  WatchdogStatus
+	Trainer   TrainerStatus
+	Gyro      GyroStatus
+	Ports     []PortStatus
+	Telemetry []TelemetryStatus
+}
+
+type ArmingStatus struct {
+	Armed  bool
+	Reason string    //why outputs are held neutral, empty when armed
+	Since  time.Time //last change, zero if none since start up
+}
+
+type EStopStatus struct {
+	Latched bool
+	Reason  string    //what latched it, empty when not latched
+	Since   time.Time //last latch or reset, zero if none since start up
+}
+
+type TrainerStatus struct {
+	Enabled  bool
+	Takeover bool      //the instructor has full control
+	Since    time.Time //control last changed hands, zero if it has not since start up
+}
+
+type GyroStatus struct {
+	Enabled    bool
+	Mode       string
+	Active     bool    //attitude telemetry is fresh so the gyro is steering
+	YawRate    float64 //degrees per second
+	Correction int     //sbus steps added to steer
+}
+
+type WatchdogStatus struct {
+	Tripped bool      //outputs are in failsafe because processing stalled
+	Since   time.Time //last trip or recovery, zero if none since start up
+}
+
+type PortStatus struct {
+	Kind         string //sbus or crsf
+	Index        int
+	Path         string
+	Type         string
+	Receiving    bool
+	Transmitting bool
+	LastReceived time.Time
+	Age          time.Duration //time since the last frame, -1 if none received
+	SBusStats    *sbus.Stats   //reader counts, nil for crsf ports
+}
+
+type TelemetryStatus struct {
+	Kind      string //sbus or crsf
+	Index     int
+	Path      string
+	RxVoltage float64 //sbus2 receiver supply volts, 0 for crsf or when not reported
+	crsf.CRSFTelemetry
+}
+
+type profileNameRequest struct {
+	Name string `json:"name"`
+}
+
+type trimsRequest struct {
+	Trims map[string]int `json:"trims"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
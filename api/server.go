@@ -0,0 +1,307 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/sbus"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	shutdownTimeout = 2 * time.Second
+	minPushRate     = 10 * time.Millisecond
+
+	TokenHeader = "X-PDW-Token"
+)
+
+type Server struct {
+	cfg      config.APIConfig
+	backend  Backend
+	pushRate time.Duration
+	mux      *http.ServeMux
+}
+
+func NewServer(cfg config.APIConfig, backend Backend) *Server {
+	pushRate := time.Duration(cfg.PushRate) * time.Millisecond
+	if pushRate < minPushRate {
+		pushRate = minPushRate
+	}
+
+	s := &Server{
+		cfg:      cfg,
+		backend:  backend,
+		pushRate: pushRate,
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/api/status", getOnly(s.handleStatus))
+	s.mux.HandleFunc("/api/frame", getOnly(s.handleFrame))
+	s.mux.HandleFunc("/api/state", getOnly(s.handleState))
+	s.mux.HandleFunc("/api/ports", getOnly(s.handlePorts))
+	s.mux.HandleFunc("/api/telemetry", getOnly(s.handleTelemetry))
+	s.mux.HandleFunc("/api/profiles", s.protect(s.handleProfiles))
+	s.mux.HandleFunc("/api/profiles/select", postOnly(s.protect(s.handleSelectProfile)))
+	s.mux.HandleFunc("/api/profiles/delete", postOnly(s.protect(s.handleDeleteProfile)))
+	s.mux.HandleFunc("/api/trims", postOnly(s.protect(s.handleTrims)))
+	s.mux.Handle("/api/ws", websocket.Server{Handler: s.handleStream, Handshake: checkOrigin})
+	s.mux.Handle("/metrics", metrics.Handler(metrics.Default))
+
+	dashboard, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		panic(err) //embedded at build time so this can only be a programming error
+	}
+	s.mux.Handle("/", http.FileServer(http.FS(dashboard)))
+	return s
+}
+
+// Handler exposes the routes without a listener, useful with httptest
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	httpServer := &http.Server{
+		Addr:              s.cfg.Address,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext: func(_ net.Listener) context.Context {
+			return ctx //lets websocket streams see shutdown
+		},
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		slog.Info("api listening", "address", s.cfg.Address)
+		errChan <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("api server stopped: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := httpServer.Shutdown(shutdownCtx)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("api server did not shutdown cleanly", "error", err)
+		}
+		return ctx.Err()
+	}
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.backend.Status())
+}
+
+func (s *Server) handleFrame(w http.ResponseWriter, r *http.Request) {
+	status := s.backend.Status()
+	writeJSON(w, http.StatusOK, struct {
+		Frame  sbus.Frame
+		Output sbus.Frame
+	}{status.Frame, status.Output})
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.backend.Status().MixState)
+}
+
+func (s *Server) handlePorts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.backend.Status().Ports)
+}
+
+func (s *Server) handleTelemetry(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.backend.Status().Telemetry)
+}
+
+// GET lists profiles, POST adds or replaces one by name
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.backend.Profiles())
+	case http.MethodPost:
+		profile := profiles.Profile{}
+		if !decodeRequest(w, r, &profile) {
+			return
+		}
+		err := profile.Validate()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		err = s.backend.UpdateProfile(profile)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *Server) handleSelectProfile(w http.ResponseWriter, r *http.Request) {
+	req := profileNameRequest{}
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	writeProfileResult(w, s.backend.SelectProfile(req.Name), req)
+}
+
+func (s *Server) handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	req := profileNameRequest{}
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	writeProfileResult(w, s.backend.DeleteProfile(req.Name), req)
+}
+
+// handleTrims sets trims on the active profile, they are saved with it
+func (s *Server) handleTrims(w http.ResponseWriter, r *http.Request) {
+	req := trimsRequest{}
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	for name, value := range req.Trims {
+		switch name {
+		case profiles.TrimSteer, profiles.TrimThrottle, profiles.TrimGyroGain:
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unknown trim %s", name))
+			return
+		}
+		if value < -100 || value > 100 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("trim %s value %d out of range", name, value))
+			return
+		}
+	}
+	err := s.backend.SetTrims(req.Trims)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+// handleStream pushes the full status at the configured rate until the client goes away
+func (s *Server) handleStream(conn *websocket.Conn) {
+	defer conn.Close()
+	ctx := conn.Request().Context()
+	slog.Info("api stream opened", "remote", conn.Request().RemoteAddr)
+	defer slog.Info("api stream closed", "remote", conn.Request().RemoteAddr)
+
+	ticker := time.NewTicker(s.pushRate)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := websocket.JSON.Send(conn, s.backend.Status())
+			if err != nil {
+				slog.Debug("api stream send failed", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// protect guards requests that change settings. Browsers send an Origin on every POST so a page from
+// another site is turned away, and when a token is configured it must match
+func (s *Server) protect(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			handler(w, r)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !sameHost(origin, r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("origin %s not allowed", origin))
+			return
+		}
+		if s.cfg.Token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(TokenHeader)), []byte(s.cfg.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid api token"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// checkOrigin only upgrades websockets opened by the dashboard's own pages
+func checkOrigin(wsConfig *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(wsConfig, r)
+	if err != nil {
+		return err
+	}
+	if origin == nil || origin.Host != r.Host {
+		return fmt.Errorf("origin %s not allowed", r.Header.Get("Origin"))
+	}
+	wsConfig.Origin = origin
+	return nil
+}
+
+func sameHost(origin string, host string) bool {
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == host
+}
+
+func getOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return methodOnly(http.MethodGet, handler)
+}
+
+func postOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return methodOnly(http.MethodPost, handler)
+}
+
+func methodOnly(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeProfileResult(w http.ResponseWriter, err error, body interface{}) {
+	if errors.Is(err, profiles.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err)
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+	} else {
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		slog.Warn("failed writing api response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
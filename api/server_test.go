@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/sbus"
+	"golang.org/x/net/websocket"
+)
+
+type fakeBackend struct {
+	lock     sync.Mutex
+	status   Status
+	profiles []profiles.Profile
+	selected string
+	trims    map[string]int
+}
+
+func newFakeBackend() *fakeBackend {
+	frame := sbus.NewFrame()
+	frame.Ch[0] = 1500
+	return &fakeBackend{
+		status: Status{
+			Profile:  "default",
+			Frame:    frame,
+			Output:   frame,
+			MixState: models.MixState{Esc: "forward", Gear: 2},
+			Ports:    []PortStatus{{Kind: "sbus", Index: 0, Path: "/dev/ttyAMA0"}},
+		},
+		profiles: []profiles.Profile{{Name: "default"}},
+	}
+}
+
+func (b *fakeBackend) Status() Status {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.status
+}
+
+func (b *fakeBackend) Profiles() []profiles.Profile {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]profiles.Profile(nil), b.profiles...)
+}
+
+func (b *fakeBackend) SelectProfile(name string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for i := range b.profiles {
+		if b.profiles[i].Name == name {
+			b.selected = name
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", profiles.ErrNotFound, name)
+}
+
+func (b *fakeBackend) UpdateProfile(profile profiles.Profile) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.profiles = append(b.profiles, profile)
+	return nil
+}
+
+func (b *fakeBackend) DeleteProfile(name string) error {
+	return b.SelectProfile(name)
+}
+
+func (b *fakeBackend) SetTrims(trims map[string]int) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trims = trims
+	return nil
+}
+
+func testServer(t *testing.T, backend Backend, pushRate int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(NewServer(config.APIConfig{Enabled: true, PushRate: pushRate}, backend).Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func request(t *testing.T, server *httptest.Server, method string, path string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("%s %s: content type %q", method, path, resp.Header.Get("Content-Type"))
+	}
+	var decoded interface{}
+	err = json.NewDecoder(resp.Body).Decode(&decoded)
+	if err != nil {
+		t.Fatalf("%s %s: %s", method, path, err)
+	}
+	object, _ := decoded.(map[string]interface{})
+	return resp.StatusCode, object
+}
+
+func TestReadEndpoints(t *testing.T) {
+	server := testServer(t, newFakeBackend(), 100)
+
+	code, body := request(t, server, http.MethodGet, "/api/status", "")
+	if code != http.StatusOK || body["Profile"] != "default" {
+		t.Errorf("status: %d %v", code, body)
+	}
+	code, body = request(t, server, http.MethodGet, "/api/frame", "")
+	if code != http.StatusOK || body["Frame"] == nil || body["Output"] == nil {
+		t.Errorf("frame: %d %v", code, body)
+	}
+	code, body = request(t, server, http.MethodGet, "/api/state", "")
+	if code != http.StatusOK || body["Esc"] != "forward" || body["Gear"] != 2.0 {
+		t.Errorf("state: %d %v", code, body)
+	}
+	for _, path := range []string{"/api/ports", "/api/telemetry", "/api/profiles"} {
+		code, _ = request(t, server, http.MethodGet, path, "")
+		if code != http.StatusOK {
+			t.Errorf("%s: %d", path, code)
+		}
+	}
+	code, body = request(t, server, http.MethodPost, "/api/status", "")
+	if code != http.StatusMethodNotAllowed || body["error"] == nil {
+		t.Errorf("post status: %d %v", code, body)
+	}
+}
+
+func TestWriteEndpoints(t *testing.T) {
+	backend := newFakeBackend()
+	server := testServer(t, backend, 100)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+	}{
+		{name: "select", method: http.MethodPost, path: "/api/profiles/select", body: `{"name":"default"}`, wantCode: http.StatusOK},
+		{name: "select missing", method: http.MethodPost, path: "/api/profiles/select", body: `{"name":"nope"}`, wantCode: http.StatusNotFound},
+		{name: "select with get", method: http.MethodGet, path: "/api/profiles/select", wantCode: http.StatusMethodNotAllowed},
+		{name: "bad json", method: http.MethodPost, path: "/api/profiles/select", body: `{`, wantCode: http.StatusBadRequest},
+		{name: "save profile", method: http.MethodPost, path: "/api/profiles", body: `{"name":"drift","esc_mode":"no_gears"}`, wantCode: http.StatusOK},
+		{name: "invalid profile", method: http.MethodPost, path: "/api/profiles", body: `{"name":"drift","esc_mode":"auto"}`, wantCode: http.StatusBadRequest},
+		{name: "trims", method: http.MethodPost, path: "/api/trims", body: `{"trims":{"steer_trim":4}}`, wantCode: http.StatusOK},
+		{name: "trim out of range", method: http.MethodPost, path: "/api/trims", body: `{"trims":{"steer_trim":400}}`, wantCode: http.StatusBadRequest},
+		{name: "unknown trim", method: http.MethodPost, path: "/api/trims", body: `{"trims":{"steer_trim":4,"brake_trim":2}}`, wantCode: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		code, body := request(t, server, tc.method, tc.path, tc.body)
+		if code != tc.wantCode {
+			t.Errorf("%s: got %d want %d %v", tc.name, code, tc.wantCode, body)
+		}
+	}
+
+	backend.lock.Lock()
+	defer backend.lock.Unlock()
+	if backend.selected != "default" || backend.trims["steer_trim"] != 4 || len(backend.profiles) != 2 {
+		t.Errorf("backend not updated, selected %q trims %v profiles %d", backend.selected, backend.trims, len(backend.profiles))
+	}
+}
+
+func TestStreamRate(t *testing.T) {
+	const pushRate = 20
+	server := testServer(t, newFakeBackend(), pushRate)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws"
+	conn, err := websocket.Dial(wsURL, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const messages = 6
+	start := time.Now()
+	for i := 0; i < messages; i++ {
+		status := Status{}
+		err = websocket.JSON.Receive(conn, &status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Profile != "default" {
+			t.Fatalf("got profile %q", status.Profile)
+		}
+	}
+	elapsed := time.Since(start)
+	if elapsed < messages*pushRate*time.Millisecond*3/4 { //the first push waits a full tick
+		t.Errorf("%d messages in %s, faster than every %dms", messages, elapsed, pushRate)
+	}
+}
+
+func TestWriteProtection(t *testing.T) {
+	server := httptest.NewServer(NewServer(config.APIConfig{Enabled: true, PushRate: 100, Token: "Secret"}, newFakeBackend()).Handler())
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		origin   string
+		token    string
+		wantCode int
+	}{
+		{name: "no token", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", wantCode: http.StatusUnauthorized},
+		{name: "token", token: "Secret", wantCode: http.StatusOK},
+		{name: "same origin", origin: server.URL, token: "Secret", wantCode: http.StatusOK},
+		{name: "other origin", origin: "http://example.com", token: "Secret", wantCode: http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/trims", strings.NewReader(`{"trims":{"steer_trim":4}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if tc.token != "" {
+			req.Header.Set(TokenHeader, tc.token)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.wantCode {
+			t.Errorf("%s: got %d want %d", tc.name, resp.StatusCode, tc.wantCode)
+		}
+	}
+
+	code, _ := request(t, server, http.MethodGet, "/api/profiles", "")
+	if code != http.StatusOK {
+		t.Errorf("reading profiles without a token: %d", code)
+	}
+}
+
+func TestStreamOrigin(t *testing.T) {
+	server := testServer(t, newFakeBackend(), 100)
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws"
+	conn, err := websocket.Dial(wsURL, "", "http://example.com")
+	if err == nil {
+		conn.Close()
+		t.Fatal("stream opened from another origin")
+	}
+}
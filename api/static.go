@@ -0,0 +1,8 @@
+package api
+
+import "embed"
+
+// Dashboard served from / so the crew can tune from a phone
+//
+//go:embed static
+var staticFiles embed.FS
@@ -5,12 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"runtime/debug"
+	"sync"
 	"time"
 
+	"github.com/Speshl/pi_drift_wheel/api"
 	"github.com/Speshl/pi_drift_wheel/config"
 	"github.com/Speshl/pi_drift_wheel/controllers"
 	"github.com/Speshl/pi_drift_wheel/controllers/models"
 	"github.com/Speshl/pi_drift_wheel/crsf"
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/recorder"
 	sbus "github.com/Speshl/pi_drift_wheel/sbus"
 	"golang.org/x/sync/errgroup"
 )
@@ -23,14 +31,40 @@ const (
 	DefaultMinYaw = -180 //102 / 117
 	DefaultMidYaw = 0
 	DefaultMaxYaw = 180 //-124/109
+
+	DefaultProfileName = "default"
 )
 
+var ErrShutdownTimeout = errors.New("timed out waiting for shutdown")
+
+var ErrProcessingPanic = errors.New("processing panicked")
+
 type App struct {
 	cfg config.Config
 
 	controllerManager *controllers.ControllerManager
 	sBusConns         []*sbus.SBus
+	sbusPorts         []int //config index of each sbus connection
 	crsfConns         []*crsf.CRSF
+	crsfPorts         []int //config index of each crsf connection
+
+	profiles       *profiles.ProfileManager
+	profile        profiles.Profile //profile currently applied to the mixer and outputs
+	profileVersion uint64
+	lastLRValue    int
+
+	trimLock     sync.Mutex
+	lastTrims    map[string]int
+	pendingTrims map[string]map[string]int //trims waiting to be saved, keyed by profile
+	setTrims     map[string]int            //trims requested outside the processing loop
+
+	statusLock sync.RWMutex
+	status     api.Status
+
+	recorder *recorder.Recorder //nil when recording is disabled
+	stage    *Stage             //created with the controllers
+	estop    *EStop
+	watchdog *Watchdog
 
 	setMinPitch int
 	setMidPitch int
@@ -44,11 +78,35 @@ type App struct {
 }
 
 func NewApp(cfg config.Config) *App {
-	return &App{
+	app := &App{
 		cfg:         cfg,
 		setMinPitch: DefaultMinPitch,
 		setMidPitch: DefaultMidPitch,
 		setMaxPitch: DefaultMaxPitch,
+		estop:       NewEStop(cfg.EStopCfg),
+		watchdog:    NewWatchdog(time.Duration(cfg.AppCfg.WatchdogTimeout) * time.Millisecond),
+	}
+	app.profiles = profiles.NewProfileManager(cfg.AppCfg.StateDir, DefaultProfile(cfg))
+	if cfg.RecorderCfg.Enabled {
+		app.recorder = recorder.NewRecorder(cfg.RecorderCfg)
+		app.estop.SetChangeHook(func(latched bool, reason string) {
+			app.recorder.RecordEStop(latched, reason)
+		})
+	}
+	return app
+}
+
+// Profile used when none have been saved yet, built from the compiled in defaults and env config
+func DefaultProfile(cfg config.Config) profiles.Profile {
+	return profiles.Profile{
+		Name:          DefaultProfileName,
+		InvertOutputs: cfg.AppCfg.InvertOutputs,
+		EscMode:       profiles.EscModeHPattern,
+		FF: profiles.FFCalibration{
+			MinPitch: DefaultMinPitch,
+			MidPitch: DefaultMidPitch,
+			MaxPitch: DefaultMaxPitch,
+		},
 	}
 }
 
@@ -56,19 +114,34 @@ func (a *App) Start(ctx context.Context) (err error) {
 	ctx, cancel := context.WithCancel(ctx)
 	group, ctx := errgroup.WithContext(ctx)
 
+	err = a.profiles.Load()
+	if err != nil {
+		slog.Error("failed loading profiles, using default", "error", err)
+	}
+
+	a.startRecorder(ctx, group)
+
 	a.startControllers(ctx, group, cancel)
 
 	a.startSbus(ctx, group, cancel)
 
 	a.startCRSF(ctx, group, cancel)
 
+	a.startEStop(ctx, group)
+
+	a.startWatchdog(ctx, group)
+
 	a.startKillListener(ctx, group, cancel)
 
+	a.startTrimSaver(ctx, group)
+
+	a.startAPI(ctx, group)
+
 	group.Go(func() error {
 		return a.processData(ctx)
 	})
 
-	err = group.Wait()
+	err = waitWithTimeout(ctx, group, time.Duration(a.cfg.AppCfg.ShutdownTimeout)*time.Millisecond)
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			slog.Info("app context was cancelled", "error", err)
@@ -80,12 +153,36 @@ func (a *App) Start(ctx context.Context) (err error) {
 	return nil
 }
 
+// waitWithTimeout waits for the group, giving it timeout to finish once ctx is done.
+// A handle that will not close should not stop the process exiting
+func waitWithTimeout(ctx context.Context, group *errgroup.Group, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- group.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w after %s", ErrShutdownTimeout, timeout)
+	}
+}
+
 /*
 Reads Sbus RX and Controller Inputs to merge into a single sbus frame to be sent to all Sbus Tx.  Also reads CRSF telemetry to get feedback for force feedback.
 */
-func (a *App) processData(ctx context.Context) error {
+func (a *App) processData(ctx context.Context) (err error) {
 	slog.Info("start processing")
 	defer slog.Info("stopping processing")
+	defer a.recoverProcessing(&err)
 
 	time.Sleep(500 * time.Millisecond) //give some time for signals to warm up
 
@@ -113,74 +210,121 @@ func (a *App) processData(ctx context.Context) error {
 		// 	}
 
 		case <-mergeTicker.C:
-			//gather inputs and combine all into a single frame
-			mixedFrame, mixedController, err := a.gatherInputs()
-			if err != nil {
-				slog.Error("error gathering inputs", "error", err)
+			//pick up any profile switch made since the last tick
+			if version := a.profiles.Version(); version != a.profileVersion {
+				a.profileVersion = version
+				a.applyProfile(a.profiles.Active())
+			}
+			a.applyRequestedTrims()
+
+			//combine the controllers and receivers into a single frame, neutral until armed
+			result := a.stage.Tick(time.Now(), deviceSources{app: a})
+			if result.Err != nil {
+				slog.Error("error gathering inputs", "error", result.Err)
+				a.sendOutputs(result.Output)
 				continue //Might need return here
 			}
 
 			//do anything we need to at this point with the comibined input frame
-			a.utilizeInputs(mixedFrame, mixedController)
-
-			//finally send the combined frame to all sbus tx
-			a.sendOutputs(mixedFrame)
-
-			if time.Since(lastWriteTime) > (5*time.Millisecond)+mergeTime {
-				slog.Warn("slow processing", "duration", time.Since(lastWriteTime))
+			a.utilizeInputs(result.Mixed, result.MixState)
+			a.trackTrims(result.MixState.Trims)
+
+			//finally send the frame to all sbus tx
+			a.sendOutputs(result.Output)
+			a.publishStatus(result.Mixed, result.Output, result.MixState)
+
+			interval := time.Since(lastWriteTime)
+			metrics.ProcessLoopInterval.Observe(interval.Seconds())
+			metrics.ProcessLoopJitter.Set((interval - mergeTime).Seconds())
+			if interval > (5*time.Millisecond)+mergeTime {
+				metrics.ProcessLoopSlow.Inc()
+				slog.Warn("slow processing", "duration", interval)
 			}
 			lastWriteTime = time.Now()
 
-			slog.Info("details",
-				"steer", mixedFrame.Frame.Ch[0],
-				"esc", mixedFrame.Frame.Ch[1],
-				"gyro_gain", mixedFrame.Frame.Ch[2],
-				"tilt", mixedFrame.Frame.Ch[3],
-				"roll", mixedFrame.Frame.Ch[4],
-				"pan", mixedFrame.Frame.Ch[5],
+			slog.Debug("details",
+				"steer", result.Mixed.Frame.Ch[0],
+				"esc", result.Mixed.Frame.Ch[1],
+				"gyro_gain", result.Mixed.Frame.Ch[2],
+				"tilt", result.Mixed.Frame.Ch[3],
+				"roll", result.Mixed.Frame.Ch[4],
+				"pan", result.Mixed.Frame.Ch[5],
 				"levelFromFeedback", a.ffLevel,
 			)
 		}
 	}
 }
 
-func (a *App) gatherInputs() (sbus.SBusFrame, models.MixState, error) {
-	framesToMerge := make([]sbus.SBusFrame, 0, len(a.controllerManager.Controllers)+len(a.sBusConns))
-
-	controllerFrame, err := a.controllerManager.GetMixedFrame() //Get one frame that has been pre-mixed from all connected controllers
-	if err != nil {
-		return sbus.NewSBusFrame(), a.controllerManager.GetMixState(), fmt.Errorf("error getting mixed frame - %w", err)
+// recoverProcessing latches the e-stop if the processing loop panics, so the outputs are held neutral
+// while the app shuts down instead of the last frame going out until the process dies
+func (a *App) recoverProcessing(err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
 	}
-	framesToMerge = append(framesToMerge, controllerFrame)
+	a.estop.Trigger(time.Now(), EStopPanic)
+	slog.Error("processing panicked", "panic", recovered, "stack", string(debug.Stack()))
+	*err = fmt.Errorf("%w: %v", ErrProcessingPanic, recovered)
+}
 
-	for i := range a.sBusConns { //Get a frame from each sbus connection that is labeled as a control device
-		if a.sBusConns[i].IsReceiving() && a.sBusConns[i].Type() == sbus.RxTypeControl {
+// deviceSources reads the stage's receivers from the app's ports
+type deviceSources struct {
+	app *App
+}
 
-			readFrame := a.sBusConns[i].GetReadFrame()
-			newFrame := sbus.NewSBusFrame()
-			for _, j := range a.cfg.SbusCfgs[i].SBusChannels { //Only pull over values we care about
-				newFrame.Frame.Ch[j] = readFrame.Ch[j]
-			}
-			slog.Debug("sbus frame", "port", i, "channels", a.cfg.SbusCfgs[i].SBusChannels, "read", readFrame, "newFrame", newFrame)
-			framesToMerge = append(framesToMerge, newFrame)
-		} else if a.sBusConns[i].IsReceiving() && a.sBusConns[i].Type() == sbus.RxTypeTelemetry {
-			slog.Info("sbus telemetry", "frame", a.sBusConns[i].GetReadFrame())
+func (d deviceSources) SBus(port int) (sbus.Frame, time.Time) {
+	for i := range d.app.sBusConns {
+		if d.app.sbusPorts[i] != port || !d.app.sBusConns[i].IsReceiving() {
+			continue
 		}
+		return d.app.sBusConns[i].GetReadFrame(), d.app.sBusConns[i].LastReceived()
 	}
+	return sbus.NewFrame(), time.Time{}
+}
 
-	return MergeFrames(framesToMerge), a.controllerManager.GetMixState(), nil
+func (d deviceSources) CRSF(port int) CRSFLink {
+	for i := range d.app.crsfConns {
+		if d.app.crsfPorts[i] != port {
+			continue
+		}
+		data := d.app.crsfConns[i].GetData()
+		return CRSFLink{
+			Channels:          CRSFChannelsFrame(data.Channels),
+			ChannelsReceived:  d.app.crsfConns[i].ChannelsReceived(),
+			LinkStatsReceived: d.app.crsfConns[i].LinkStatsReceived(),
+			UplinkQuality:     data.LinkStats.UplinkQuality,
+		}
+	}
+	return CRSFLink{Channels: sbus.NewFrame()}
+}
+
+// Attitude is zero when the port is not open
+func (d deviceSources) Attitude(port int) (frames.AttitudeData, time.Time) {
+	for i := range d.app.crsfConns {
+		if d.app.crsfPorts[i] == port {
+			return d.app.crsfConns[i].AttitudeSample()
+		}
+	}
+	return frames.AttitudeData{}, time.Time{}
 }
 
 func (a *App) utilizeInputs(inputFrame sbus.SBusFrame, controlState models.MixState) {
 	//Do anything we need to do with the input frame here
-	//crsf device 0 attitude telemetry is used for feedback
-	attitude := a.crsfConns[0].GetAttitude() //Todo: always using first crsf
+	//attitude pitch from crsf or an sbus2 feedback sensor is used for feedback
+	attitude := a.telemetry().Attitude
 	a.ffLevel = calculateFFLevel(a.setMinPitch, a.setMidPitch, a.setMaxPitch, int(attitude.Pitch), int(inputFrame.Frame.Ch[0]))
 
 	red1 := controlState.Buttons["red1"]
+	red2 := controlState.Buttons["red2"]
 	lrValue := controlState.Buttons["left/right"]
 	udValue := controlState.Buttons["up/down"]
 
+	if red2 == 1 && lrValue != 0 && a.lastLRValue == 0 { //red2 + left/right cycles profiles
+		go a.cycleProfile(lrValue)
+	}
+	a.lastLRValue = lrValue
+
+	wasCalibrating := a.ffEnabled
 	if red1 == 1 {
 		if lrValue > 0 { //Set right end point
 			a.ffEnabled = true
@@ -201,13 +345,129 @@ func (a *App) utilizeInputs(inputFrame sbus.SBusFrame, controlState models.MixSt
 		a.ffEnabled = false
 	}
 
+	if wasCalibrating && !a.ffEnabled { //done setting endpoints so keep them with the profile
+		profile := a.profile
+		profile.FF = profiles.FFCalibration{
+			MinPitch: a.setMinPitch,
+			MidPitch: a.setMidPitch,
+			MaxPitch: a.setMaxPitch,
+		}
+		a.profile = profile
+		go a.saveProfile(profile)
+	}
+}
+
+// SelectProfile switches the active profile, it is applied on the next processing tick
+func (a *App) SelectProfile(name string) error {
+	return a.profiles.Select(name)
+}
+
+func (a *App) UpdateProfile(profile profiles.Profile) error {
+	return a.profiles.Update(profile)
+}
+
+func (a *App) DeleteProfile(name string) error {
+	return a.profiles.Delete(name)
+}
+
+// SetTrims changes trims on the active profile, they are applied on the next processing tick
+func (a *App) SetTrims(trims map[string]int) error {
+	a.trimLock.Lock()
+	defer a.trimLock.Unlock()
+	if a.setTrims == nil {
+		a.setTrims = make(map[string]int, len(trims))
+	}
+	maps.Copy(a.setTrims, trims)
+	return nil
+}
+
+func (a *App) applyRequestedTrims() {
+	a.trimLock.Lock()
+	requested := a.setTrims
+	a.setTrims = nil
+	a.trimLock.Unlock()
+	if len(requested) == 0 {
+		return
+	}
+
+	trims := a.controllerManager.GetMixState().Trims
+	merged := make(map[string]int, len(trims)+len(requested))
+	maps.Copy(merged, trims)
+	maps.Copy(merged, requested)
+	a.controllerManager.SetTrims(merged) //saved by trackTrims once the mixer picks them up
+	slog.Info("set trims", "profile", a.profile.Name, "trims", merged)
+}
+
+func (a *App) cycleProfile(offset int) {
+	profile, err := a.profiles.Cycle(offset)
+	if err != nil {
+		slog.Error("failed saving selected profile", "profile", profile.Name, "error", err)
+	}
+}
+
+func (a *App) saveProfile(profile profiles.Profile) {
+	err := a.profiles.Update(profile)
+	if err != nil {
+		slog.Error("failed saving profile", "profile", profile.Name, "error", err)
+	}
+}
+
+func (a *App) applyProfile(profile profiles.Profile) {
+	switched := profile.Name != a.profile.Name
+	a.profile = profile
+	a.setMinPitch = profile.FF.MinPitch
+	a.setMidPitch = profile.FF.MidPitch
+	a.setMaxPitch = profile.FF.MaxPitch
+	a.stage.SetProfile(profile)
+	a.recorder.RecordProfile(profile)
+	if switched { //only restore trims when changing cars so edits to the current profile keep live trims
+		trims := a.profiles.Trims(profile.Name)
+		a.controllerManager.SetTrims(trims)
+		a.lastTrims = trims
+		a.recorder.RecordTrims(trims)
+		slog.Info("restored trims", "profile", profile.Name, "trims", trims)
+	}
+	slog.Info("applied profile", "name", profile.Name, "esc_mode", profile.EscMode)
+}
+
+// Queue trims for saving when they change, the saver goroutine writes them out
+func (a *App) trackTrims(trims map[string]int) {
+	if maps.Equal(trims, a.lastTrims) {
+		return
+	}
+	a.lastTrims = maps.Clone(trims)
+	a.recorder.RecordTrims(trims)
+
+	a.trimLock.Lock()
+	defer a.trimLock.Unlock()
+	if a.pendingTrims == nil {
+		a.pendingTrims = make(map[string]map[string]int, 1)
+	}
+	a.pendingTrims[a.profile.Name] = maps.Clone(trims)
+}
+
+func (a *App) saveTrims() {
+	a.trimLock.Lock()
+	pending := a.pendingTrims
+	a.pendingTrims = nil
+	a.trimLock.Unlock()
+
+	for name, trims := range pending {
+		err := a.profiles.SaveTrims(name, trims)
+		if err != nil {
+			slog.Error("failed saving trims", "profile", name, "error", err)
+			continue
+		}
+		slog.Debug("saved trims", "profile", name, "trims", trims)
+	}
 }
 
-func (a *App) sendOutputs(mixedFrame sbus.SBusFrame) {
-	mixedFrame = InvertChannels(mixedFrame, a.cfg.AppCfg.InvertOutputs)
+// sendOutputs writes a frame from the stage, already mapped onto the car's channels, to every sbus tx
+func (a *App) sendOutputs(outputFrame sbus.SBusFrame) {
 	for i := range a.sBusConns {
 		if a.sBusConns[i].IsTransmitting() {
-			a.sBusConns[i].SetWriteFrame(mixedFrame)
+			a.sBusConns[i].SetWriteFrame(outputFrame)
 		}
 	}
+	a.recorder.RecordOutput(outputFrame)
 }
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func TestWaitWithTimeout(t *testing.T) {
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context) error
+		want error
+	}{
+		{
+			name: "stops cleanly",
+			run: func(ctx context.Context) error {
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond) //some shutdown work
+				return ctx.Err()
+			},
+			want: context.Canceled,
+		},
+		{
+			name: "never stops",
+			run: func(ctx context.Context) error {
+				<-stuck
+				return nil
+			},
+			want: ErrShutdownTimeout,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		ctx, cancel := context.WithCancel(context.Background())
+		group, ctx := errgroup.WithContext(ctx)
+		group.Go(func() error {
+			return tc.run(ctx)
+		})
+		cancel()
+
+		start := time.Now()
+		err := waitWithTimeout(ctx, group, 100*time.Millisecond)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v want %v", tc.name, err, tc.want)
+		}
+		if waited := time.Since(start); waited > 500*time.Millisecond {
+			t.Errorf("%s: waited %v", tc.name, waited)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// Reasons outputs are disarmed
+const (
+	DisarmStartup    = "startup"
+	DisarmKill       = "kill button"
+	DisarmSourceLost = "source lost"
+	DisarmEStop      = "emergency stop"
+)
+
+// ArmingInputs is what the arming checks look at each tick
+type ArmingInputs struct {
+	Buttons  map[string]int //mix state buttons, 0 when released
+	Steer    int            //mixed steer channel with its trim removed
+	Esc      int            //mixed esc channel with its trim removed
+	Throttle int            //percent of travel the raw throttle is pressed
+	SourceOK bool           //every control source is delivering
+}
+
+// NewArmingInputs reads the arming inputs from a tick's mix, steer is channel 0 and esc channel 1
+func NewArmingInputs(mixedFrame sbus.SBusFrame, mixState models.MixState, inputs []models.Input, sourceOK bool) ArmingInputs {
+	armingInputs := ArmingInputs{
+		Buttons:  mixState.Buttons,
+		Steer:    int(mixedFrame.Frame.Ch[0]) - mixState.Trims["steer_trim"],
+		Esc:      int(mixedFrame.Frame.Ch[1]) - mixState.Trims["throttle_trim"],
+		SourceOK: sourceOK,
+	}
+	for i := range inputs {
+		if inputs[i].Label == "throttle" {
+			armingInputs.Throttle = models.GetScaledInputChange(inputs[i])
+		}
+	}
+	return armingInputs
+}
+
+// Arming keeps outputs neutral until the driver arms with the wheel centered and off the throttle
+type Arming struct {
+	cfg       config.ArmingConfig
+	armed     bool
+	reason    string //why outputs are disarmed
+	since     time.Time
+	holdStart time.Time //when the arm button was first seen held with everything at rest
+	onChange  func(armed bool, reason string)
+}
+
+func NewArming(cfg config.ArmingConfig) *Arming {
+	arming := &Arming{
+		cfg:    cfg,
+		reason: DisarmStartup,
+	}
+	if !cfg.Enabled {
+		arming.armed = true
+		arming.reason = ""
+	}
+	return arming
+}
+
+// Update applies this tick's inputs and returns if outputs are armed
+func (a *Arming) Update(now time.Time, inputs ArmingInputs) bool {
+	if !a.cfg.Enabled {
+		return true
+	}
+
+	if a.armed {
+		if a.cfg.KillButton != "" && inputs.Buttons[a.cfg.KillButton] != 0 {
+			a.Disarm(now, DisarmKill)
+		} else if !inputs.SourceOK {
+			a.Disarm(now, DisarmSourceLost)
+		}
+		return a.armed
+	}
+
+	if !inputs.SourceOK || inputs.Buttons[a.cfg.ArmButton] == 0 || inputs.Buttons[a.cfg.KillButton] != 0 || !a.atRest(inputs) {
+		a.holdStart = time.Time{}
+		return false
+	}
+	if a.holdStart.IsZero() {
+		a.holdStart = now
+		slog.Info("arming, keep holding", "button", a.cfg.ArmButton, "hold", time.Duration(a.cfg.ArmHold)*time.Millisecond)
+	}
+	if now.Sub(a.holdStart) >= time.Duration(a.cfg.ArmHold)*time.Millisecond {
+		a.armed = true
+		a.reason = ""
+		a.since = now
+		a.holdStart = time.Time{}
+		metrics.Armed.Set(1)
+		slog.Info("armed")
+		if a.onChange != nil {
+			a.onChange(true, "")
+		}
+	}
+	return a.armed
+}
+
+func (a *Arming) atRest(inputs ArmingInputs) bool {
+	return abs(inputs.Steer-sbus.MidValue) <= a.cfg.CenterRange &&
+		abs(inputs.Esc-sbus.MidValue) <= a.cfg.CenterRange &&
+		inputs.Throttle <= a.cfg.ThrottleRange
+}
+
+func (a *Arming) Disarm(now time.Time, reason string) {
+	a.holdStart = time.Time{}
+	if !a.armed || !a.cfg.Enabled {
+		return
+	}
+	a.armed = false
+	a.reason = reason
+	a.since = now
+	metrics.Armed.Set(0)
+	metrics.Disarms.With(reason).Inc()
+	slog.Warn("disarmed", "reason", reason)
+	if a.onChange != nil {
+		a.onChange(false, reason)
+	}
+}
+
+// SetChangeHook is called every time outputs arm or disarm
+func (a *Arming) SetChangeHook(hook func(armed bool, reason string)) {
+	a.onChange = hook
+}
+
+func (a *Arming) Armed() bool {
+	return a.armed
+}
+
+// Reason is why outputs are disarmed, empty when armed
+func (a *Arming) Reason() string {
+	return a.reason
+}
+
+// Since is when the state last changed, zero if it has not since start up
+func (a *Arming) Since() time.Time {
+	return a.since
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+var testArmingCfg = config.ArmingConfig{
+	Enabled:       true,
+	ArmButton:     "red3",
+	ArmHold:       1000,
+	KillButton:    "red4",
+	CenterRange:   60,
+	ThrottleRange: 5,
+	SourceTimeout: 250,
+}
+
+// restInputs has the wheel centered, pedals up and every source delivering
+func restInputs(buttons map[string]int) ArmingInputs {
+	return ArmingInputs{
+		Buttons:  buttons,
+		Steer:    sbus.MidValue,
+		Esc:      sbus.MidValue,
+		SourceOK: true,
+	}
+}
+
+func armed(t *testing.T, arming *Arming, start time.Time) {
+	t.Helper()
+	held := restInputs(map[string]int{"red3": 1})
+	arming.Update(start, held)
+	if !arming.Update(start.Add(time.Second), held) {
+		t.Fatal("did not arm")
+	}
+}
+
+func TestArmingStartsDisarmed(t *testing.T) {
+	arming := NewArming(testArmingCfg)
+	if arming.Update(time.Now(), restInputs(nil)) {
+		t.Error("armed without the gesture")
+	}
+	if arming.Reason() != DisarmStartup {
+		t.Errorf("reason %q", arming.Reason())
+	}
+}
+
+func TestArmingDisabledIsAlwaysArmed(t *testing.T) {
+	arming := NewArming(config.ArmingConfig{})
+	inputs := restInputs(nil)
+	inputs.SourceOK = false
+	if !arming.Update(time.Now(), inputs) {
+		t.Error("disabled arming held outputs")
+	}
+	arming.Disarm(time.Now(), DisarmKill)
+	if !arming.Armed() {
+		t.Error("disabled arming disarmed")
+	}
+}
+
+func TestArmingGesture(t *testing.T) {
+	start := time.Now()
+	held := map[string]int{"red3": 1}
+	tests := []struct {
+		name   string
+		change func(*ArmingInputs)
+		want   bool
+	}{
+		{name: "at rest", change: func(*ArmingInputs) {}, want: true},
+		{name: "inside center range", change: func(i *ArmingInputs) { i.Steer += 60; i.Esc -= 60 }, want: true},
+		{name: "steer off center", change: func(i *ArmingInputs) { i.Steer += 61 }, want: false},
+		{name: "esc off center", change: func(i *ArmingInputs) { i.Esc -= 61 }, want: false},
+		{name: "throttle pressed", change: func(i *ArmingInputs) { i.Throttle = 6 }, want: false},
+		{name: "source lost", change: func(i *ArmingInputs) { i.SourceOK = false }, want: false},
+		{name: "kill held", change: func(i *ArmingInputs) { i.Buttons = map[string]int{"red3": 1, "red4": 1} }, want: false},
+		{name: "button released", change: func(i *ArmingInputs) { i.Buttons = nil }, want: false},
+	}
+	for _, tc := range tests {
+		arming := NewArming(testArmingCfg)
+		inputs := restInputs(held)
+		tc.change(&inputs)
+		arming.Update(start, inputs)
+		if arming.Update(start.Add(999*time.Millisecond), inputs) {
+			t.Errorf("%s: armed before the hold time", tc.name)
+		}
+		if got := arming.Update(start.Add(time.Second), inputs); got != tc.want {
+			t.Errorf("%s: got armed %v want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// Letting go of the button or moving the wheel mid hold starts the hold over
+func TestArmingHoldRestarts(t *testing.T) {
+	start := time.Now()
+	arming := NewArming(testArmingCfg)
+	held := restInputs(map[string]int{"red3": 1})
+	arming.Update(start, held)
+	moved := restInputs(map[string]int{"red3": 1})
+	moved.Steer = sbus.MaxValue
+	arming.Update(start.Add(500*time.Millisecond), moved)
+	arming.Update(start.Add(600*time.Millisecond), held)
+	if arming.Update(start.Add(1500*time.Millisecond), held) {
+		t.Error("armed with a broken hold")
+	}
+	if !arming.Update(start.Add(1600*time.Millisecond), held) {
+		t.Error("did not arm after a full hold")
+	}
+}
+
+func TestArmingDisarms(t *testing.T) {
+	start := time.Now()
+
+	arming := NewArming(testArmingCfg)
+	armed(t, arming, start)
+	moving := restInputs(nil)
+	moving.Steer = sbus.MaxValue
+	moving.Throttle = 100
+	if !arming.Update(start.Add(2*time.Second), moving) {
+		t.Error("driving disarmed")
+	}
+	if arming.Update(start.Add(3*time.Second), restInputs(map[string]int{"red4": 1})) {
+		t.Error("kill button did not disarm")
+	}
+	if arming.Reason() != DisarmKill || !arming.Since().Equal(start.Add(3*time.Second)) {
+		t.Errorf("reason %q since %v", arming.Reason(), arming.Since())
+	}
+
+	arming = NewArming(testArmingCfg)
+	armed(t, arming, start)
+	lost := restInputs(nil)
+	lost.SourceOK = false
+	if arming.Update(start.Add(2*time.Second), lost) || arming.Reason() != DisarmSourceLost {
+		t.Errorf("source loss did not disarm, reason %q", arming.Reason())
+	}
+	if arming.Update(start.Add(3*time.Second), restInputs(nil)) {
+		t.Error("re-armed when the source came back")
+	}
+}
+
+func TestNewArmingInputs(t *testing.T) {
+	frame := frameWith(map[int]uint16{0: 1002, 1: 982})
+	mixState := models.NewMixState()
+	mixState.Buttons["red3"] = 1
+	mixState.Trims["steer_trim"] = 10
+	mixState.Trims["throttle_trim"] = -10
+	inputs := []models.Input{
+		{Label: "steer", Value: 8191, Min: 0, Max: 16383, Rests: "middle"},
+		{Label: "throttle", Value: 51, Min: 0, Max: 255, Rests: "low"},
+	}
+
+	got := NewArmingInputs(frame, mixState, inputs, true)
+	if got.Steer != sbus.MidValue || got.Esc != sbus.MidValue {
+		t.Errorf("steer %d esc %d, want trims removed", got.Steer, got.Esc)
+	}
+	if got.Throttle != 20 || got.Buttons["red3"] != 1 || !got.SourceOK {
+		t.Errorf("got %+v", got)
+	}
+}
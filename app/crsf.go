@@ -0,0 +1,35 @@
+package app
+
+import (
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// CRSFChannelsFrame puts crsf channels in an sbus frame, both use the same 172-1811 range
+func CRSFChannelsFrame(channels frames.ChannelsData) sbus.Frame {
+	frame := sbus.NewFrame()
+	for i := 0; i < len(channels.Channels) && i < sbus.MaxChannels; i++ {
+		frame.Ch[i] = channels.Channels[i]
+	}
+	return frame
+}
+
+// crsfLinkOK is false before the first channels frame, once they stop for longer than the timeout,
+// or while the receiver reports uplink quality under the minimum
+func crsfLinkOK(now time.Time, channelsReceived time.Time, linkStatsReceived time.Time, quality uint8, minQuality int, timeout time.Duration) bool {
+	if channelsReceived.IsZero() || now.Sub(channelsReceived) > timeout {
+		return false
+	}
+	return linkStatsReceived.IsZero() || int(quality) >= minQuality
+}
+
+// SBusLinkOK is false before the first frame, once frames stop for longer than the timeout,
+// or while the receiver flags the frame lost or failsafe
+func SBusLinkOK(now time.Time, lastReceived time.Time, frame sbus.Frame, timeout time.Duration) bool {
+	if lastReceived.IsZero() || now.Sub(lastReceived) > timeout {
+		return false
+	}
+	return !frame.Flags.Framelost && !frame.Flags.Failsafe
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+func TestCRSFLinkOK(t *testing.T) {
+	now := time.Now()
+	timeout := 250 * time.Millisecond
+	tests := []struct {
+		name      string
+		channels  time.Time
+		linkStats time.Time
+		quality   uint8
+		want      bool
+	}{
+		{name: "no channels yet", want: false},
+		{name: "channels without link stats", channels: now.Add(-10 * time.Millisecond), want: true},
+		{name: "good link", channels: now, linkStats: now, quality: 100, want: true},
+		{name: "quality at the minimum", channels: now, linkStats: now, quality: 30, want: true},
+		{name: "low quality", channels: now, linkStats: now, quality: 29, want: false},
+		{name: "channels stopped", channels: now.Add(-300 * time.Millisecond), linkStats: now, quality: 100, want: false},
+	}
+	for _, tc := range tests {
+		if got := crsfLinkOK(now, tc.channels, tc.linkStats, tc.quality, 30, timeout); got != tc.want {
+			t.Errorf("%s: got %v want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCRSFChannelsFrame(t *testing.T) {
+	channels := frames.ChannelsData{Channels: []uint16{172, 1811, 1500}}
+	frame := CRSFChannelsFrame(channels)
+	if frame.Ch[0] != 172 || frame.Ch[1] != 1811 || frame.Ch[2] != 1500 || frame.Ch[3] != uint16(sbus.MidValue) {
+		t.Errorf("got %v", frame.Ch)
+	}
+}
+
+func TestSBusLinkOK(t *testing.T) {
+	now := time.Now()
+	timeout := 250 * time.Millisecond
+	failsafe := sbus.NewFrame()
+	failsafe.Flags.Failsafe = true
+	frameLost := sbus.NewFrame()
+	frameLost.Flags.Framelost = true
+	tests := []struct {
+		name         string
+		lastReceived time.Time
+		frame        sbus.Frame
+		want         bool
+	}{
+		{name: "no frames yet", frame: sbus.NewFrame(), want: false},
+		{name: "fresh frame", lastReceived: now.Add(-10 * time.Millisecond), frame: sbus.NewFrame(), want: true},
+		{name: "frames stopped", lastReceived: now.Add(-300 * time.Millisecond), frame: sbus.NewFrame(), want: false},
+		{name: "failsafe", lastReceived: now, frame: failsafe, want: false},
+		{name: "frame lost", lastReceived: now, frame: frameLost, want: false},
+	}
+	for _, tc := range tests {
+		if got := SBusLinkOK(now, tc.lastReceived, tc.frame, timeout); got != tc.want {
+			t.Errorf("%s: got %v want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// Reasons the e-stop latched
+const (
+	EStopButton     = "button"
+	EStopDevice     = "device"
+	EStopDeviceLost = "device lost"
+	EStopPanic      = "processing panic"
+)
+
+// EStop overrides every sbus output with a neutral frame until it is reset. It is driven from its own
+// goroutines and writes straight to the outputs so it still works if the processing loop stalls
+type EStop struct {
+	cfg config.EStopConfig
+
+	lock       sync.RWMutex
+	outputs    []*sbus.SBus
+	latched    bool
+	reason     string
+	since      time.Time
+	resetStart time.Time //when the reset button was first seen held
+	onChange   func(latched bool, reason string)
+}
+
+func NewEStop(cfg config.EStopConfig) *EStop {
+	return &EStop{
+		cfg: cfg,
+	}
+}
+
+// SetOutputs are the ports overridden when latched
+func (e *EStop) SetOutputs(outputs []*sbus.SBus) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.outputs = outputs
+	if e.latched {
+		e.override()
+	}
+}
+
+// SetChangeHook is called on every latch and reset, under the e-stop's lock so it must not block
+func (e *EStop) SetChangeHook(hook func(latched bool, reason string)) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.onChange = hook
+}
+
+// Trigger latches neutral on every output, safe to call from any goroutine
+func (e *EStop) Trigger(now time.Time, reason string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.resetStart = time.Time{}
+	if e.latched {
+		return
+	}
+	e.latched = true
+	e.reason = reason
+	e.since = now
+	e.override()
+	metrics.EStopLatched.Set(1)
+	metrics.EStops.With(reason).Inc()
+	slog.Error("emergency stop latched", "reason", reason)
+	if e.onChange != nil {
+		e.onChange(true, reason)
+	}
+}
+
+func (e *EStop) override() {
+	for i := range e.outputs {
+		e.outputs[i].SetOverrideFrame(sbus.NewFrame())
+	}
+}
+
+func (e *EStop) Reset(now time.Time) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.resetStart = time.Time{}
+	if !e.latched {
+		return
+	}
+	e.latched = false
+	e.reason = ""
+	e.since = now
+	for i := range e.outputs {
+		e.outputs[i].ClearOverrideFrame()
+	}
+	metrics.EStopLatched.Set(0)
+	slog.Warn("emergency stop reset, arm to drive")
+	if e.onChange != nil {
+		e.onChange(false, "")
+	}
+}
+
+// UpdateButtons latches while the e-stop button is pressed and resets once the reset button is held long enough
+func (e *EStop) UpdateButtons(now time.Time, stopPressed bool, resetPressed bool) {
+	if stopPressed {
+		e.Trigger(now, EStopButton)
+		return
+	}
+
+	e.lock.Lock()
+	if !e.latched || !resetPressed {
+		e.resetStart = time.Time{}
+		e.lock.Unlock()
+		return
+	}
+	if e.resetStart.IsZero() {
+		e.resetStart = now
+		slog.Info("resetting emergency stop, keep holding", "button", e.cfg.ResetButton, "hold", time.Duration(e.cfg.ResetHold)*time.Millisecond)
+	}
+	held := now.Sub(e.resetStart) >= time.Duration(e.cfg.ResetHold)*time.Millisecond
+	e.lock.Unlock()
+
+	if held {
+		e.Reset(now)
+	}
+}
+
+func (e *EStop) Latched() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.latched
+}
+
+// Reason is what latched the e-stop, empty when it is not latched
+func (e *EStop) Reason() string {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.reason
+}
+
+// Since is when the e-stop last latched or reset, zero if it has not since start up
+func (e *EStop) Since() time.Time {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.since
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+)
+
+var testEStopCfg = config.EStopConfig{
+	Button:      "x/square",
+	ResetButton: "b/circle",
+	ResetHold:   2000,
+}
+
+func TestEStopLatches(t *testing.T) {
+	start := time.Now()
+	estop := NewEStop(testEStopCfg)
+	estop.UpdateButtons(start, false, false)
+	if estop.Latched() {
+		t.Fatal("latched with nothing pressed")
+	}
+
+	estop.UpdateButtons(start, true, false)
+	estop.UpdateButtons(start.Add(time.Second), false, false) //released
+	if !estop.Latched() || estop.Reason() != EStopButton || !estop.Since().Equal(start) {
+		t.Fatalf("latched %v reason %q since %v", estop.Latched(), estop.Reason(), estop.Since())
+	}
+
+	estop.Trigger(start.Add(2*time.Second), EStopDevice)
+	if estop.Reason() != EStopButton || !estop.Since().Equal(start) {
+		t.Errorf("second trigger changed the latch to %q at %v", estop.Reason(), estop.Since())
+	}
+}
+
+func TestEStopReset(t *testing.T) {
+	start := time.Now()
+	estop := NewEStop(testEStopCfg)
+	estop.Trigger(start, EStopDevice)
+
+	estop.UpdateButtons(start, false, true)
+	estop.UpdateButtons(start.Add(1500*time.Millisecond), false, false) //let go early
+	estop.UpdateButtons(start.Add(1600*time.Millisecond), false, true)
+	estop.UpdateButtons(start.Add(3500*time.Millisecond), false, true)
+	if !estop.Latched() {
+		t.Fatal("reset without a full hold")
+	}
+
+	estop.UpdateButtons(start.Add(3550*time.Millisecond), true, true) //stop pressed again mid hold
+	estop.UpdateButtons(start.Add(3600*time.Millisecond), false, true)
+	estop.UpdateButtons(start.Add(5500*time.Millisecond), false, true)
+	if !estop.Latched() {
+		t.Fatal("reset while the hold was interrupted by the stop button")
+	}
+
+	estop.UpdateButtons(start.Add(5600*time.Millisecond), false, true)
+	if estop.Latched() || estop.Reason() != "" {
+		t.Fatalf("still latched after a full hold, reason %q", estop.Reason())
+	}
+	if !estop.Since().Equal(start.Add(5600 * time.Millisecond)) {
+		t.Errorf("since %v", estop.Since())
+	}
+}
+
+func TestIsPressed(t *testing.T) {
+	inputs := []models.Input{
+		{Label: "x/square", Value: 0, Min: 0, Max: 1, Rests: "low"},
+		{Label: "b/circle", Value: 1, Min: 0, Max: 1, Rests: "low"},
+		{Label: "left/right", Value: -1, Min: -1, Max: 1, Rests: "mid"},
+		{Label: "up/down", Value: 0, Min: -1, Max: 1, Rests: "mid"},
+		{Label: "handbrake", Value: 255, Min: 0, Max: 255, Rests: "high"},
+	}
+	tests := map[string]bool{
+		"x/square":   false,
+		"b/circle":   true,
+		"left/right": true,
+		"up/down":    false,
+		"handbrake":  false,
+		"red1":       false,
+		"":           false,
+	}
+	for label, want := range tests {
+		if got := isPressed(inputs, label); got != want {
+			t.Errorf("%q: got %v want %v", label, got, want)
+		}
+	}
+}
+
+func TestRecoverProcessingLatches(t *testing.T) {
+	a := &App{estop: NewEStop(testEStopCfg)}
+	process := func() (err error) {
+		defer a.recoverProcessing(&err)
+		var mixer map[string]int
+		mixer["steer"] = 1 //panics like a bad mixer would
+		return nil
+	}
+
+	err := process()
+	if !errors.Is(err, ErrProcessingPanic) {
+		t.Errorf("got %v want %v", err, ErrProcessingPanic)
+	}
+	if !a.estop.Latched() || a.estop.Reason() != EStopPanic {
+		t.Errorf("estop latched %t reason %q", a.estop.Latched(), a.estop.Reason())
+	}
+}
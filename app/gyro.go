@@ -0,0 +1,139 @@
+package app
+
+import (
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// Software gyro modes
+const (
+	GyroModeRate    = "rate"    //counter steers against the yaw rate
+	GyroModeHeading = "heading" //also steers back to the heading held while the wheel is centered
+)
+
+const gyroRateSmoothing = 0.5 //weight of each new yaw rate sample
+
+// Gyro counter steers from the yaw in crsf attitude telemetry, for cars with an imu but no hardware gyro.
+// Gain comes from the gyro gain channel so the gyro gain trim sets it. Stale telemetry passes steering through untouched
+type Gyro struct {
+	cfg config.GyroConfig
+
+	lastYaw    float64   //degrees
+	lastSample time.Time //when lastYaw arrived, zero until the first sample
+	rate       float64   //degrees per second, smoothed
+	hasRate    bool      //two samples have been seen since the gyro went active
+	heading    float64   //degrees, heading mode target
+	holding    bool      //heading mode has a target
+	active     bool
+	correction int //sbus steps added to steer on the last apply
+}
+
+func NewGyro(cfg config.GyroConfig) *Gyro {
+	if cfg.Mode != GyroModeRate && cfg.Mode != GyroModeHeading {
+		slog.Error("unknown gyro mode, using rate", "mode", cfg.Mode)
+		cfg.Mode = GyroModeRate
+	}
+	return &Gyro{
+		cfg: cfg,
+	}
+}
+
+// Apply updates the yaw rate from the latest attitude sample and adds the counter steer to channel 0
+func (g *Gyro) Apply(now time.Time, frame sbus.SBusFrame, attitude frames.AttitudeData, received time.Time) sbus.SBusFrame {
+	fresh := !received.IsZero() && now.Sub(received) <= time.Duration(g.cfg.Timeout)*time.Millisecond
+	g.setActive(fresh)
+	if !fresh {
+		return frame
+	}
+
+	yaw := attitude.YawDegree()
+	if g.cfg.Reverse {
+		yaw = -yaw
+	}
+	if received != g.lastSample {
+		if !g.lastSample.IsZero() {
+			elapsed := received.Sub(g.lastSample).Seconds()
+			if elapsed > 0 {
+				sampleRate := wrapDegrees(yaw-g.lastYaw) / elapsed
+				if !g.hasRate {
+					g.rate = sampleRate
+				} else {
+					g.rate += gyroRateSmoothing * (sampleRate - g.rate)
+				}
+				g.hasRate = true
+			}
+		}
+		g.lastYaw = yaw
+		g.lastSample = received
+	}
+
+	steer := int(frame.Frame.Ch[0])
+	correction := -g.cfg.RateGain * g.rate
+	if !g.hasRate {
+		correction = 0
+	}
+	if g.cfg.Mode == GyroModeHeading {
+		if !g.holding || abs(steer-sbus.MidValue) > g.cfg.SteerDeadband { //the driver is steering, follow them
+			g.heading = yaw
+			g.holding = true
+		}
+		correction -= g.cfg.HeadingGain * wrapDegrees(yaw-g.heading)
+	}
+
+	gain := float64(int(frame.Frame.Ch[2])-sbus.MinValue) / float64(sbus.MaxValue-sbus.MinValue)
+	g.correction = min(max(int(math.Round(correction*gain)), -g.cfg.MaxCorrection), g.cfg.MaxCorrection)
+	frame.Frame.Ch[0] = uint16(min(max(steer+g.correction, sbus.MinValue), sbus.MaxValue))
+	return frame
+}
+
+// setActive starts the gyro over when telemetry goes stale so an old yaw is not used for the rate or heading
+func (g *Gyro) setActive(active bool) {
+	if active == g.active {
+		return
+	}
+	g.active = active
+	if active {
+		metrics.GyroActive.Set(1)
+		slog.Info("gyro active", "mode", g.cfg.Mode)
+		return
+	}
+	metrics.GyroActive.Set(0)
+	metrics.GyroStale.Inc()
+	slog.Warn("attitude telemetry stale, gyro off")
+	g.lastSample = time.Time{}
+	g.rate = 0
+	g.hasRate = false
+	g.holding = false
+	g.correction = 0
+}
+
+func (g *Gyro) Active() bool {
+	return g.active
+}
+
+// YawRate is the smoothed yaw rate in degrees per second
+func (g *Gyro) YawRate() float64 {
+	return g.rate
+}
+
+// Correction is the sbus steps added to steer on the last apply
+func (g *Gyro) Correction() int {
+	return g.correction
+}
+
+// wrapDegrees keeps a heading difference inside -180 to 180 so crossing the wrap is a small change
+func wrapDegrees(degrees float64) float64 {
+	for degrees > 180 {
+		degrees -= 360
+	}
+	for degrees < -180 {
+		degrees += 360
+	}
+	return degrees
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+func gyroConfig(mode string) config.GyroConfig {
+	return config.GyroConfig{
+		Enabled:       true,
+		Mode:          mode,
+		RateGain:      2,
+		HeadingGain:   10,
+		MaxCorrection: 400,
+		SteerDeadband: 30,
+		Timeout:       250,
+	}
+}
+
+// attitudeAt builds an attitude frame with the yaw in degrees, in the same units as the crsf frame
+func attitudeAt(degrees float64) frames.AttitudeData {
+	return frames.AttitudeData{Yaw: int16(math.Round(degrees * 3.14159 / 180 * 10000))}
+}
+
+func gyroFrame(steer int, gain int) sbus.SBusFrame {
+	frame := sbus.NewSBusFrame()
+	frame.Frame.Ch[0] = uint16(steer)
+	frame.Frame.Ch[2] = uint16(gain)
+	return frame
+}
+
+func wantSteer(t *testing.T, name string, frame sbus.SBusFrame, want int) {
+	t.Helper()
+	if got := int(frame.Frame.Ch[0]); abs(got-want) > 1 { //yaw is stored in whole 10000ths of a radian
+		t.Errorf("%s: steer got %d want %d", name, got, want)
+	}
+}
+
+func TestGyroRate(t *testing.T) {
+	start := time.Now()
+	gyro := NewGyro(gyroConfig(GyroModeRate))
+
+	frame := gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(0), start)
+	wantSteer(t, "first sample", frame, sbus.MidValue)
+	if !gyro.Active() {
+		t.Fatal("gyro not active with fresh telemetry")
+	}
+
+	next := start.Add(100 * time.Millisecond)
+	frame = gyro.Apply(next, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(10), next) //100 degrees a second to the right
+	wantSteer(t, "counter steer", frame, sbus.MidValue-200)
+	if math.Abs(gyro.YawRate()-100) > 1 {
+		t.Errorf("yaw rate got %f want 100", gyro.YawRate())
+	}
+
+	frame = gyro.Apply(next.Add(5*time.Millisecond), gyroFrame(sbus.MidValue+300, sbus.MidValue), attitudeAt(10), next)
+	wantSteer(t, "repeated sample at half gain", frame, sbus.MidValue+300-100)
+
+	frame = gyro.Apply(next.Add(5*time.Millisecond), gyroFrame(sbus.MidValue, sbus.MinValue), attitudeAt(10), next)
+	wantSteer(t, "no gain", frame, sbus.MidValue)
+}
+
+func TestGyroRateSmoothing(t *testing.T) {
+	start := time.Now()
+	gyro := NewGyro(gyroConfig(GyroModeRate))
+	gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(0), start)
+	gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(10), start.Add(100*time.Millisecond))
+	gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(10), start.Add(200*time.Millisecond))
+	if math.Abs(gyro.YawRate()-50) > 1 {
+		t.Errorf("yaw rate got %f want 50", gyro.YawRate())
+	}
+}
+
+func TestGyroLimits(t *testing.T) {
+	start := time.Now()
+	cfg := gyroConfig(GyroModeRate)
+	cfg.MaxCorrection = 100
+	gyro := NewGyro(cfg)
+	gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(0), start)
+	frame := gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(-20), start.Add(100*time.Millisecond))
+	wantSteer(t, "max correction", frame, sbus.MidValue+100)
+	if gyro.Correction() != 100 {
+		t.Errorf("correction got %d want 100", gyro.Correction())
+	}
+
+	frame = gyro.Apply(start, gyroFrame(sbus.MaxValue-50, sbus.MaxValue), attitudeAt(-40), start.Add(200*time.Millisecond))
+	wantSteer(t, "steer range", frame, sbus.MaxValue)
+}
+
+func TestGyroWrapAndReverse(t *testing.T) {
+	start := time.Now()
+	gyro := NewGyro(gyroConfig(GyroModeRate))
+	gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(175), start)
+	frame := gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(-175), start.Add(100*time.Millisecond))
+	wantSteer(t, "across the wrap", frame, sbus.MidValue-200)
+
+	cfg := gyroConfig(GyroModeRate)
+	cfg.Reverse = true
+	gyro = NewGyro(cfg)
+	gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(0), start)
+	frame = gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(10), start.Add(100*time.Millisecond))
+	wantSteer(t, "reversed", frame, sbus.MidValue+200)
+}
+
+func TestGyroHeadingHold(t *testing.T) {
+	start := time.Now()
+	cfg := gyroConfig(GyroModeHeading)
+	cfg.RateGain = 0 //heading only
+	gyro := NewGyro(cfg)
+
+	frame := gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(90), start)
+	wantSteer(t, "holds the starting heading", frame, sbus.MidValue)
+
+	frame = gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(95), start.Add(100*time.Millisecond))
+	wantSteer(t, "steers back to the heading", frame, sbus.MidValue-50)
+
+	frame = gyro.Apply(start, gyroFrame(sbus.MidValue+20, sbus.MaxValue), attitudeAt(95), start.Add(150*time.Millisecond))
+	wantSteer(t, "inside the deadband", frame, sbus.MidValue+20-50)
+
+	frame = gyro.Apply(start, gyroFrame(sbus.MidValue+200, sbus.MaxValue), attitudeAt(120), start.Add(200*time.Millisecond))
+	wantSteer(t, "driver steering", frame, sbus.MidValue+200)
+
+	frame = gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(118), start.Add(300*time.Millisecond))
+	wantSteer(t, "holds the new heading", frame, sbus.MidValue+20)
+}
+
+func TestGyroStale(t *testing.T) {
+	start := time.Now()
+	gyro := NewGyro(gyroConfig(GyroModeRate))
+
+	frame := gyro.Apply(start, gyroFrame(sbus.MidValue+10, sbus.MaxValue), frames.AttitudeData{}, time.Time{})
+	wantSteer(t, "no telemetry", frame, sbus.MidValue+10)
+	if gyro.Active() {
+		t.Error("gyro active without telemetry")
+	}
+
+	gyro.Apply(start, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(0), start)
+	gyro.Apply(start.Add(100*time.Millisecond), gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(10), start.Add(100*time.Millisecond))
+
+	late := start.Add(400 * time.Millisecond)
+	frame = gyro.Apply(late, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(10), start.Add(100*time.Millisecond))
+	wantSteer(t, "stale telemetry", frame, sbus.MidValue)
+	if gyro.Active() || gyro.Correction() != 0 || gyro.YawRate() != 0 {
+		t.Errorf("stale gyro still running, active %t correction %d rate %f", gyro.Active(), gyro.Correction(), gyro.YawRate())
+	}
+
+	frame = gyro.Apply(late, gyroFrame(sbus.MidValue, sbus.MaxValue), attitudeAt(50), late)
+	wantSteer(t, "first sample after stale", frame, sbus.MidValue)
+}
+
+func TestNewGyroUnknownMode(t *testing.T) {
+	gyro := NewGyro(gyroConfig("spin"))
+	if gyro.cfg.Mode != GyroModeRate {
+		t.Errorf("mode got %s want %s", gyro.cfg.Mode, GyroModeRate)
+	}
+}
@@ -0,0 +1,331 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// Merge modes, picked per output channel
+const (
+	MergeFurthest = "furthest" //value furthest from neutral wins, ties keep the earlier source
+	MergePriority = "priority" //first listed source that is delivering the channel wins
+	MergeOverride = "override" //first listed source more than the threshold from neutral wins, else the first source
+	MergeSum      = "sum"      //offsets from neutral are added together
+	MergeMin      = "min"
+	MergeMax      = "max"
+)
+
+// ControllerSource is the source name of the frame mixed from the controllers. The controllers themselves are
+// merged input by input before the mixer, see ParseInputMergePolicies
+const ControllerSource = "controllers"
+
+// SBusSource is the source name of an sbus rx port by its config index
+func SBusSource(port int) string {
+	return fmt.Sprintf("sbus%d", port)
+}
+
+// CRSFSource is the source name of a crsf control port by its config index
+func CRSFSource(port int) string {
+	return fmt.Sprintf("crsf%d", port)
+}
+
+// ControllerChannels are the mixed channels the wheel drives, steer, esc, gyro gain and the profile's rear brake channel if it has one
+func ControllerChannels(handbrake models.Handbrake) []int {
+	channels := []int{0, 1, 2}
+	if handbrake.Channel > 2 && handbrake.Channel < sbus.MaxChannels {
+		channels = append(channels, handbrake.Channel)
+	}
+	return channels
+}
+
+// SBusRemap is the channel table for an sbus rx port. A bad table falls back to passing SBusChannels through
+func SBusRemap(port int, cfg config.SBusConfig) sbus.Remap {
+	return channelRemap(SBusSource(port), cfg.SBusRemap, cfg.SBusChannels)
+}
+
+// CRSFRemap is the channel table for a crsf control port. A bad table falls back to passing CRSFChannels through
+func CRSFRemap(port int, cfg config.CRSFConfig) sbus.Remap {
+	return channelRemap(CRSFSource(port), cfg.CRSFRemap, cfg.CRSFChannels)
+}
+
+func channelRemap(source string, value string, channels []int) sbus.Remap {
+	if value == "" {
+		return sbus.IdentityRemap(channels)
+	}
+	remap, err := sbus.ParseRemap(value)
+	if err != nil {
+		slog.Error("failed parsing remap, passing channels through", "source", source, "remap", value, "channels", channels, "error", err)
+		return sbus.IdentityRemap(channels)
+	}
+	return remap
+}
+
+// MergeSourceNames are the sources a merge policy may name
+func MergeSourceNames(sbusPorts int, crsfPorts int) []string {
+	names := []string{ControllerSource}
+	for i := 0; i < sbusPorts; i++ {
+		names = append(names, SBusSource(i))
+	}
+	for i := 0; i < crsfPorts; i++ {
+		names = append(names, CRSFSource(i))
+	}
+	return names
+}
+
+// MergeSource is one frame to merge and where it came from
+type MergeSource struct {
+	Name     string
+	Frame    sbus.SBusFrame
+	Channels []int //channels this source delivers, nil for all of them
+}
+
+func (s MergeSource) delivers(ch int) bool {
+	return s.Channels == nil || slices.Contains(s.Channels, ch)
+}
+
+// MergePolicy is how one output channel is picked from the sources
+type MergePolicy struct {
+	Mode      string
+	Sources   []string //sources considered in order, empty for all in the order they are gathered
+	Threshold int      //override only, sbus steps from neutral before a source counts as active
+	Neutral   int      //resting value of the channel, sbus.MidValue unless set
+}
+
+func DefaultMergePolicy() MergePolicy {
+	return MergePolicy{
+		Mode:    MergeFurthest,
+		Neutral: sbus.MidValue,
+	}
+}
+
+// ParseMergePolicy reads mode[:source,source...[:threshold[:neutral]]] like "override:sbus0,controllers:100".
+// An empty value is the default furthest from mid over every source
+func ParseMergePolicy(value string, knownSources []string) (MergePolicy, error) {
+	policy := DefaultMergePolicy()
+	fields := strings.Split(strings.TrimSpace(value), ":")
+	if fields[0] == "" {
+		return policy, nil
+	}
+	if len(fields) > 4 {
+		return policy, fmt.Errorf("merge policy %q has too many fields", value)
+	}
+
+	switch fields[0] {
+	case MergeFurthest, MergePriority, MergeOverride, MergeSum, MergeMin, MergeMax:
+		policy.Mode = fields[0]
+	default:
+		return policy, fmt.Errorf("unknown merge mode %q", fields[0])
+	}
+
+	if len(fields) > 1 {
+		for _, source := range strings.Split(fields[1], ",") {
+			source = strings.TrimSpace(source)
+			if source == "" {
+				continue
+			}
+			if !slices.Contains(knownSources, source) {
+				return policy, fmt.Errorf("unknown merge source %q", source)
+			}
+			policy.Sources = append(policy.Sources, source)
+		}
+	}
+	if (policy.Mode == MergePriority || policy.Mode == MergeOverride) && len(policy.Sources) == 0 {
+		return policy, fmt.Errorf("%s merge needs its sources in order", policy.Mode)
+	}
+
+	if len(fields) > 2 && fields[2] != "" {
+		threshold, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return policy, fmt.Errorf("failed parsing merge threshold: %w", err)
+		}
+		policy.Threshold = threshold
+	}
+	if len(fields) > 3 && fields[3] != "" {
+		neutral, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return policy, fmt.Errorf("failed parsing merge neutral: %w", err)
+		}
+		if neutral < sbus.MinValue || neutral > sbus.MaxValue {
+			return policy, fmt.Errorf("merge neutral %d is outside %d-%d", neutral, sbus.MinValue, sbus.MaxValue)
+		}
+		policy.Neutral = neutral
+	}
+	return policy, nil
+}
+
+// ParseMergePolicies reads a policy per channel. Channels that fail to parse use the default so one typo does not stop the car
+func ParseMergePolicies(values []string, knownSources []string) ([]MergePolicy, error) {
+	policies := make([]MergePolicy, len(values))
+	var errs []error
+	for i := range values {
+		policy, err := ParseMergePolicy(values[i], knownSources)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("channel %d: %w", i, err))
+			policy = DefaultMergePolicy()
+		}
+		policies[i] = policy
+	}
+	return policies, errors.Join(errs...)
+}
+
+// MergeSources merges the sources channel by channel using each channel's policy, channels without one use the default.
+// The first source's priority and flags are kept
+func MergeSources(sources []MergeSource, policies []MergePolicy) sbus.SBusFrame {
+	if len(sources) == 0 {
+		return sbus.NewSBusFrame()
+	}
+
+	mergedFrame := sources[0].Frame
+	for ch := range mergedFrame.Frame.Ch {
+		policy := DefaultMergePolicy()
+		if ch < len(policies) {
+			policy = policies[ch]
+		}
+		mergedFrame.Frame.Ch[ch] = uint16(mergeChannel(ch, sources, policy))
+	}
+	return mergedFrame
+}
+
+// candidates are the indexes of the sources delivering a channel in the order the policy considers them
+func candidates(ch int, sources []MergeSource, policy MergePolicy) []int {
+	indexes := make([]int, 0, len(sources))
+	if len(policy.Sources) == 0 {
+		for i := range sources {
+			if sources[i].delivers(ch) {
+				indexes = append(indexes, i)
+			}
+		}
+		return indexes
+	}
+	for _, name := range policy.Sources {
+		for i := range sources {
+			if sources[i].Name == name && sources[i].delivers(ch) {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return indexes
+}
+
+func mergeChannel(ch int, sources []MergeSource, policy MergePolicy) int {
+	indexes := candidates(ch, sources, policy)
+	if len(indexes) == 0 {
+		return policy.Neutral
+	}
+	values := make([]int, len(indexes))
+	for i := range indexes {
+		values[i] = int(sources[indexes[i]].Frame.Frame.Ch[ch])
+	}
+
+	if policy.Mode == MergeSum {
+		merged := policy.Neutral
+		for _, value := range values {
+			merged += value - policy.Neutral
+		}
+		return min(max(merged, sbus.MinValue), sbus.MaxValue)
+	}
+	return values[pick(values, policy)]
+}
+
+// pick is the position of the value the policy picks, every mode but sum picks one of the values
+func pick(values []int, policy MergePolicy) int {
+	picked := 0
+	switch policy.Mode {
+	case MergePriority: //the first candidate
+	case MergeOverride:
+		for i, value := range values {
+			if abs(value-policy.Neutral) > policy.Threshold {
+				return i
+			}
+		}
+	case MergeMin:
+		for i := range values {
+			if values[i] < values[picked] {
+				picked = i
+			}
+		}
+	case MergeMax:
+		for i := range values {
+			if values[i] > values[picked] {
+				picked = i
+			}
+		}
+	default: //furthest
+		for i := range values {
+			if abs(values[i]-policy.Neutral) > abs(values[picked]-policy.Neutral) {
+				picked = i
+			}
+		}
+	}
+	return picked
+}
+
+// ParseInputMergePolicies reads a merge policy per controller input label, with the controllers named by
+// controllers.SourceName like "priority:g27_racing_wheel,arduino_llc_arduino_micro". Input travel is put on the
+// sbus scale with rest at the minimum, so override thresholds are sbus steps of that scale and the neutral field is
+// ignored. Sum cannot pick one controller's reading so it is refused. Labels that fail to parse merge furthest from rest
+func ParseInputMergePolicies(values map[string]string, knownSources []string) (map[string]MergePolicy, error) {
+	policies := make(map[string]MergePolicy, len(values))
+	var errs []error
+	labels := make([]string, 0, len(values))
+	for label := range values {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels) //errors in a stable order
+	for _, label := range labels {
+		policy, err := ParseMergePolicy(values[label], knownSources)
+		if err == nil && policy.Mode == MergeSum {
+			err = fmt.Errorf("%s merge cannot pick one controller", MergeSum)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("input %s: %w", label, err))
+			policy = DefaultMergePolicy()
+		}
+		policy.Neutral = sbus.MinValue
+		policies[label] = policy
+	}
+	return policies, errors.Join(errs...)
+}
+
+// InputMerge picks controller inputs with the per label policies, labels without one go furthest from rest
+func InputMerge(policies map[string]MergePolicy) controllers.InputMerge {
+	return func(label string, inputs []controllers.InputSource) int {
+		policy, ok := policies[label]
+		if !ok {
+			policy = DefaultMergePolicy()
+			policy.Neutral = sbus.MinValue
+		}
+		sources := make([]MergeSource, len(inputs))
+		for i := range inputs {
+			sources[i] = MergeSource{Name: inputs[i].Name}
+			sources[i].Frame.Frame.Ch[0] = uint16(inputTravel(inputs[i].Input))
+		}
+		indexes := candidates(0, sources, policy)
+		if len(indexes) == 0 {
+			return -1
+		}
+		values := make([]int, len(indexes))
+		for i := range indexes {
+			values[i] = int(sources[indexes[i]].Frame.Frame.Ch[0])
+		}
+		return indexes[pick(values, policy)]
+	}
+}
+
+// inputTravel puts how far an input is from rest on the sbus scale, rest is sbus.MinValue and full travel sbus.MaxValue
+func inputTravel(input models.Input) int {
+	travel := input.Max - input.Min
+	if input.Rests == "middle" {
+		travel /= 2
+	}
+	return models.MapToRange(models.GetInputChangeAmount(input), 0, travel, sbus.MinValue, sbus.MaxValue)
+}
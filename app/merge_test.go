@@ -0,0 +1,195 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/go-evdev"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+func TestParseMergePolicy(t *testing.T) {
+	known := MergeSourceNames(2, 2)
+	tests := []struct {
+		value   string
+		want    MergePolicy
+		wantErr bool
+	}{
+		{value: "", want: DefaultMergePolicy()},
+		{value: "max", want: MergePolicy{Mode: MergeMax, Neutral: sbus.MidValue}},
+		{value: "priority:sbus1,controllers", want: MergePolicy{Mode: MergePriority, Sources: []string{"sbus1", "controllers"}, Neutral: sbus.MidValue}},
+		{value: "override:sbus0, controllers:100", want: MergePolicy{Mode: MergeOverride, Sources: []string{"sbus0", "controllers"}, Threshold: 100, Neutral: sbus.MidValue}},
+		{value: "furthest::0:172", want: MergePolicy{Mode: MergeFurthest, Neutral: sbus.MinValue}},
+		{value: "priority", wantErr: true},
+		{value: "loudest", wantErr: true},
+		{value: "sum:sbus2", wantErr: true},
+		{value: "override:sbus0:lots", wantErr: true},
+		{value: "sum::0:2000", wantErr: true},
+		{value: "sum:sbus0:0:992:1", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := ParseMergePolicy(tc.value, known)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: error %v", tc.value, err)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %+v want %+v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestParseMergePoliciesFallsBack(t *testing.T) {
+	policies, err := ParseMergePolicies([]string{"max", "typo"}, MergeSourceNames(1, 0))
+	if err == nil {
+		t.Fatal("no error for a bad policy")
+	}
+	if policies[0].Mode != MergeMax || !reflect.DeepEqual(policies[1], DefaultMergePolicy()) {
+		t.Errorf("got %+v", policies)
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	sources := []MergeSource{
+		{Name: ControllerSource, Frame: frameWith(map[int]uint16{0: 1100, 1: 900, 2: 300})},
+		{Name: SBusSource(0), Frame: frameWith(map[int]uint16{0: 1000, 1: 1500, 2: 172}), Channels: []int{0, 1}},
+		{Name: SBusSource(1), Frame: frameWith(map[int]uint16{0: 500, 1: 1200})},
+	}
+	tests := []struct {
+		name   string
+		policy MergePolicy
+		ch     int
+		want   uint16
+	}{
+		{name: "furthest", policy: DefaultMergePolicy(), ch: 0, want: 500},
+		{name: "furthest skips channels a source does not deliver", policy: MergePolicy{Mode: MergeFurthest, Neutral: sbus.MinValue}, ch: 2, want: 992},
+		{name: "furthest from a low neutral", policy: MergePolicy{Mode: MergeFurthest, Sources: []string{"sbus0", "controllers"}, Neutral: sbus.MinValue}, ch: 2, want: 300},
+		{name: "priority", policy: MergePolicy{Mode: MergePriority, Sources: []string{"sbus0", "controllers"}, Neutral: sbus.MidValue}, ch: 1, want: 1500},
+		{name: "priority skips a source without the channel", policy: MergePolicy{Mode: MergePriority, Sources: []string{"sbus0", "controllers"}, Neutral: sbus.MidValue}, ch: 2, want: 300},
+		{name: "priority with nothing delivering", policy: MergePolicy{Mode: MergePriority, Sources: []string{"sbus0"}, Neutral: sbus.MinValue}, ch: 2, want: 172},
+		{name: "override active", policy: MergePolicy{Mode: MergeOverride, Sources: []string{"sbus0", "controllers"}, Threshold: 100, Neutral: sbus.MidValue}, ch: 1, want: 1500},
+		{name: "override inside the threshold", policy: MergePolicy{Mode: MergeOverride, Sources: []string{"sbus0", "controllers"}, Threshold: 100, Neutral: sbus.MidValue}, ch: 0, want: 1100},
+		{name: "sum", policy: MergePolicy{Mode: MergeSum, Sources: []string{"controllers", "sbus0"}, Neutral: sbus.MidValue}, ch: 0, want: 1108},
+		{name: "sum of every source", policy: MergePolicy{Mode: MergeSum, Neutral: sbus.MidValue}, ch: 0, want: 616},
+		{name: "sum clamps", policy: MergePolicy{Mode: MergeSum, Neutral: sbus.MinValue}, ch: 1, want: 1811},
+		{name: "min", policy: MergePolicy{Mode: MergeMin, Neutral: sbus.MidValue}, ch: 1, want: 900},
+		{name: "max", policy: MergePolicy{Mode: MergeMax, Neutral: sbus.MidValue}, ch: 1, want: 1500},
+	}
+	for _, tc := range tests {
+		policies := make([]MergePolicy, tc.ch+1)
+		for i := range policies {
+			policies[i] = DefaultMergePolicy()
+		}
+		policies[tc.ch] = tc.policy
+		got := MergeSources(sources, policies)
+		if got.Frame.Ch[tc.ch] != tc.want {
+			t.Errorf("%s: got %d want %d", tc.name, got.Frame.Ch[tc.ch], tc.want)
+		}
+	}
+}
+
+// Channels the wheel does not drive belong to the receivers, even when the wheel is listed first
+func TestMergeSourcesReceiverOnlyChannel(t *testing.T) {
+	sources := []MergeSource{
+		{Name: ControllerSource, Frame: frameWith(map[int]uint16{0: 1100}), Channels: ControllerChannels(models.Handbrake{})},
+		{Name: SBusSource(0), Frame: frameWith(map[int]uint16{5: 1500})},
+	}
+	tests := []struct {
+		name   string
+		policy MergePolicy
+		want   uint16
+	}{
+		{name: "priority", policy: MergePolicy{Mode: MergePriority, Sources: []string{"controllers", "sbus0"}, Neutral: sbus.MidValue}, want: 1500},
+		{name: "sum", policy: MergePolicy{Mode: MergeSum, Neutral: sbus.MinValue}, want: 1500},
+		{name: "min", policy: MergePolicy{Mode: MergeMin, Neutral: sbus.MidValue}, want: 1500},
+	}
+	for _, tc := range tests {
+		policies := make([]MergePolicy, 6)
+		for i := range policies {
+			policies[i] = DefaultMergePolicy()
+		}
+		policies[5] = tc.policy
+		got := MergeSources(sources, policies)
+		if got.Frame.Ch[5] != tc.want {
+			t.Errorf("%s: got %d want %d", tc.name, got.Frame.Ch[5], tc.want)
+		}
+	}
+
+	if channels := ControllerChannels(models.Handbrake{Channel: 5}); !reflect.DeepEqual(channels, []int{0, 1, 2, 5}) {
+		t.Errorf("rear brake channel not driven by the wheel, got %v", channels)
+	}
+}
+
+func TestSBusRemap(t *testing.T) {
+	identity := SBusRemap(0, config.SBusConfig{SBusChannels: []int{3, 4}})
+	if !reflect.DeepEqual(identity.Outputs(), []int{3, 4}) {
+		t.Errorf("identity delivers %v", identity.Outputs())
+	}
+	remap := SBusRemap(0, config.SBusConfig{SBusChannels: []int{3, 4}, SBusRemap: "1>0"})
+	if !reflect.DeepEqual(remap.Outputs(), []int{0}) {
+		t.Errorf("remap delivers %v", remap.Outputs())
+	}
+	bad := SBusRemap(0, config.SBusConfig{SBusChannels: []int{3, 4}, SBusRemap: "1>0,2>0"})
+	if !reflect.DeepEqual(bad, identity) {
+		t.Errorf("bad remap fell back to %+v", bad)
+	}
+}
+
+func TestInputMergePolicies(t *testing.T) {
+	manager := controllers.NewControllerManager(config.ControllerManagerConfig{}, models.ControllerOptions{})
+	wheel, err := manager.AddVirtualController("G27 Racing Wheel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noisy, err := manager.AddVirtualController("G27 Racing Wheel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := manager.SourceNames(); !reflect.DeepEqual(names, []string{"g27_racing_wheel", "g27_racing_wheel2"}) {
+		t.Fatalf("source names %v", names)
+	}
+
+	steer := func() int {
+		t.Helper()
+		frame, err := manager.GetMixedFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(frame.Frame.Ch[0])
+	}
+	wheel.ApplyEvent(&evdev.InputEvent{Type: evdev.EV_ABS, Code: evdev.ABS_X, Value: 10000})
+	noisy.ApplyEvent(&evdev.InputEvent{Type: evdev.EV_ABS, Code: evdev.ABS_X, Value: 0}) //full lock left
+	manager.SetInputMerge(InputMerge(nil))
+	furthest := steer()
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+		want    func(got int) bool
+	}{
+		{name: "default furthest", value: "", want: func(got int) bool { return got == furthest && got < sbus.MidValue }},
+		{name: "priority", value: "priority:g27_racing_wheel,g27_racing_wheel2", want: func(got int) bool { return got > sbus.MidValue }},
+		{name: "priority to a controller without steering", value: "priority:g27_racing_wheel3", wantErr: true, want: func(got int) bool { return got == furthest }},
+		{name: "sum refused", value: "sum", wantErr: true, want: func(got int) bool { return got == furthest }},
+	}
+	for _, tc := range tests {
+		policies, err := ParseInputMergePolicies(map[string]string{"steer": tc.value}, manager.SourceNames())
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error %v", tc.name, err)
+		}
+		manager.SetInputMerge(InputMerge(policies))
+		if got := steer(); !tc.want(got) {
+			t.Errorf("%s: steer %d", tc.name, got)
+		}
+	}
+
+	merge := InputMerge(map[string]MergePolicy{"steer": {Mode: MergePriority, Sources: []string{"arduino_llc_arduino_micro"}, Neutral: sbus.MinValue}})
+	manager.SetInputMerge(merge)
+	if got := steer(); abs(got-sbus.MidValue) > 1 {
+		t.Errorf("steer from an absent source got %d want it at rest", got)
+	}
+}
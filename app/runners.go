@@ -8,40 +8,85 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/Speshl/pi_drift_wheel/api"
 	"github.com/Speshl/pi_drift_wheel/config"
 	"github.com/Speshl/pi_drift_wheel/controllers"
-	"github.com/Speshl/pi_drift_wheel/controllers/models"
 	"github.com/Speshl/pi_drift_wheel/crsf"
+	"github.com/Speshl/pi_drift_wheel/go-evdev"
 	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+	"github.com/Speshl/pi_drift_wheel/transport"
 	"golang.org/x/sync/errgroup"
 )
 
 func (a *App) startControllers(ctx context.Context, group *errgroup.Group, cancel context.CancelFunc) error {
-	a.controllerManager = controllers.NewControllerManager(a.cfg.ControllerManagerCfg, models.ControllerOptions{UseHPattern: true})
+	a.controllerManager = controllers.NewControllerManager(a.cfg.ControllerManagerCfg, a.profiles.Active().ControllerOptions())
+	a.stage = NewStage(NewStageConfig(a.cfg), a.controllerManager, a.estop, a.watchdog)
+	if a.recorder != nil {
+		a.controllerManager.SetEventHook(func(controller string, e *evdev.InputEvent) {
+			a.recorder.RecordInput(controller, uint16(e.Type), uint16(e.Code), e.Value)
+		})
+		a.stage.Arming().SetChangeHook(func(armed bool, reason string) {
+			a.recorder.RecordArming(armed, reason)
+		})
+	}
 	err := a.controllerManager.LoadControllers()
 	if err != nil {
 		return fmt.Errorf("failed loading controllers: %w", err)
 	}
+	inputPolicies, err := ParseInputMergePolicies(a.cfg.ControllerManagerCfg.InputMergePolicies, a.controllerManager.SourceNames())
+	if err != nil {
+		slog.Error("failed parsing input merge policies, merging those inputs furthest from rest", "controllers", a.controllerManager.SourceNames(), "error", err)
+	}
+	a.controllerManager.SetInputMerge(InputMerge(inputPolicies))
+	if a.cfg.TrainerCfg.Enabled && a.cfg.TrainerCfg.Instructor == InstructorController {
+		err = a.controllerManager.SetInstructor(a.cfg.TrainerCfg.Device)
+		if err != nil {
+			slog.Error("failed finding instructor wheel, instructor channels stay neutral", "device", a.cfg.TrainerCfg.Device, "error", err)
+		}
+	}
 	group.Go(func() error {
 		defer cancel()
 		slog.Info("starting controller manager")
 		defer slog.Info("stopping controller manager")
+		defer a.releaseControllers()
 		return a.controllerManager.Start(ctx)
 	})
 	return nil
 }
 
+// releaseControllers lets go of the wheel's force feedback and closes the devices, unblocking their reads
+func (a *App) releaseControllers() {
+	err := a.controllerManager.StopForceFeedback()
+	if err != nil {
+		slog.Error("failed releasing force feedback", "error", err)
+	}
+	err = a.controllerManager.Close()
+	if err != nil {
+		slog.Error("failed closing controllers", "error", err)
+	}
+}
+
 func (a *App) startSbus(ctx context.Context, group *errgroup.Group, cancel context.CancelFunc) error {
 	a.sBusConns = make([]*sbus.SBus, 0, config.MaxSbus)
 	for i := 0; i < config.MaxSbus; i++ {
 		i := i
+		sensors, err := sbus.ParseSensorSlots(a.cfg.SbusCfgs[i].SBus2Slots)
+		if err != nil {
+			slog.Error("failed parsing sbus2 slots, only reading receiver voltage", "index", i, "slots", a.cfg.SbusCfgs[i].SBus2Slots, "error", err)
+		}
 		sBus, err := sbus.NewSBus(
 			a.cfg.SbusCfgs[i].SBusPath,
 			a.cfg.SbusCfgs[i].SBusRx,
 			a.cfg.SbusCfgs[i].SBusTx,
 			&sbus.SBusCfgOpts{
-				Type: sbus.RxTypeControl,
+				Type:        a.cfg.SbusCfgs[i].SBusType,
+				Sensors:     sensors,
+				ShutdownFor: time.Duration(a.cfg.AppCfg.ShutdownNeutralTime) * time.Millisecond,
+				OnReadFrame: func(frame sbus.Frame) {
+					a.recorder.RecordSBusRX(i, frame)
+				},
 			},
 		)
 		if err != nil { //TODO: Remove when more channels supported
@@ -52,11 +97,14 @@ func (a *App) startSbus(ctx context.Context, group *errgroup.Group, cancel conte
 		}
 
 		a.sBusConns = append(a.sBusConns, sBus)
+		a.sbusPorts = append(a.sbusPorts, i)
 		group.Go(func() error {
 			defer cancel()
-			err := ListPorts()
-			if err != nil {
-				return err
+			if transport.IsSerial(a.cfg.SbusCfgs[i].SBusPath) {
+				err := ListPorts()
+				if err != nil {
+					return err
+				}
 			}
 			slog.Info("starting sbus", "index", i, "path", a.cfg.SbusCfgs[i].SBusPath)
 			defer slog.Info("stopping sbus", "index", i, "path", a.cfg.SbusCfgs[i].SBusPath)
@@ -80,10 +128,14 @@ func (a *App) startCRSF(ctx context.Context, group *errgroup.Group, cancel conte
 			a.cfg.CRSFCfgs[i].CRSFPath,
 			&crsf.CRSFOptions{
 				BaudRate: config.CRSFBaudRate,
+				OnFrame: func(data []byte) {
+					a.recorder.RecordCRSF(i, data)
+				},
 			},
 		)
 
 		a.crsfConns = append(a.crsfConns, crsf)
+		a.crsfPorts = append(a.crsfPorts, i)
 		group.Go(func() error {
 			defer cancel()
 			//TODO: List ports for crsf
@@ -94,6 +146,90 @@ func (a *App) startCRSF(ctx context.Context, group *errgroup.Group, cancel conte
 	}
 }
 
+// startEStop watches the e-stop bindings on goroutines of their own, outside the processing loop
+func (a *App) startEStop(ctx context.Context, group *errgroup.Group) {
+	a.estop.SetOutputs(a.sBusConns)
+	if a.cfg.EStopCfg.Button == "" && a.cfg.EStopCfg.Device == "" {
+		slog.Warn("no emergency stop configured")
+		return
+	}
+
+	group.Go(func() error {
+		slog.Info("starting estop buttons", "button", a.cfg.EStopCfg.Button, "reset_button", a.cfg.EStopCfg.ResetButton)
+		defer slog.Info("stopping estop buttons")
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+				stopPressed, resetPressed := false, false
+				for _, controller := range a.controllerManager.Controllers {
+					inputs := controller.GetRawInputs() //raw so a stalled mixer cannot hide a press
+					stopPressed = stopPressed || isPressed(inputs, a.cfg.EStopCfg.Button)
+					resetPressed = resetPressed || isPressed(inputs, a.cfg.EStopCfg.ResetButton)
+				}
+				a.estop.UpdateButtons(time.Now(), stopPressed, resetPressed)
+			}
+		}
+	})
+
+	if a.cfg.EStopCfg.Device == "" {
+		return
+	}
+	group.Go(func() error {
+		slog.Info("starting estop device", "device", a.cfg.EStopCfg.Device)
+		defer slog.Info("stopping estop device", "device", a.cfg.EStopCfg.Device)
+		err := a.watchEStopDevice(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("lost estop device", "device", a.cfg.EStopCfg.Device, "error", err)
+			a.estop.Trigger(time.Now(), EStopDeviceLost) //no way to stop the car now, so stop it
+			return nil
+		}
+		return ctx.Err()
+	})
+}
+
+func (a *App) watchEStopDevice(ctx context.Context) error {
+	device, err := openInputDevice(a.cfg.EStopCfg.Device)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		device.Close() //unblocks the read below
+	}()
+	for {
+		e, err := device.ReadOne()
+		if err != nil {
+			return fmt.Errorf("failed reading estop device: %w", err)
+		}
+		if e.Type == evdev.EV_KEY && e.Value == 1 {
+			a.estop.Trigger(time.Now(), EStopDevice)
+		}
+	}
+}
+
+// startWatchdog checks the processing loop is still sending frames from a goroutine of its own
+func (a *App) startWatchdog(ctx context.Context, group *errgroup.Group) {
+	a.watchdog.SetOutputs(a.sBusConns)
+	group.Go(func() error {
+		slog.Info("starting watchdog", "timeout", time.Duration(a.cfg.AppCfg.WatchdogTimeout)*time.Millisecond)
+		defer slog.Info("stopping watchdog")
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+				a.watchdog.Check(time.Now())
+			}
+		}
+	})
+}
+
 func (a *App) startKillListener(ctx context.Context, group *errgroup.Group, cancel context.CancelFunc) {
 	group.Go(func() error {
 		signalChannel := make(chan os.Signal, 1)
@@ -111,3 +247,52 @@ func (a *App) startKillListener(ctx context.Context, group *errgroup.Group, canc
 		}
 	})
 }
+
+func (a *App) startTrimSaver(ctx context.Context, group *errgroup.Group) {
+	group.Go(func() error {
+		ticker := time.NewTicker(time.Second) //batch trim presses so the sd card is not written every tick
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.saveTrims()
+			case <-ctx.Done():
+				a.saveTrims() //flush anything still pending before shutdown
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+func (a *App) startAPI(ctx context.Context, group *errgroup.Group) {
+	if !a.cfg.APICfg.Enabled {
+		return
+	}
+	server := api.NewServer(a.cfg.APICfg, a)
+	group.Go(func() error {
+		slog.Info("starting api", "address", a.cfg.APICfg.Address)
+		defer slog.Info("stopping api", "address", a.cfg.APICfg.Address)
+		err := server.Start(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("api stopped, continuing without it", "address", a.cfg.APICfg.Address, "error", err) //the dashboard is only diagnostics
+			return nil
+		}
+		return err
+	})
+}
+
+func (a *App) startRecorder(ctx context.Context, group *errgroup.Group) {
+	if a.recorder == nil {
+		return
+	}
+	group.Go(func() error {
+		slog.Info("starting recorder", "dir", a.cfg.RecorderCfg.Dir)
+		defer slog.Info("stopping recorder", "dir", a.cfg.RecorderCfg.Dir)
+		err := a.recorder.Start(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("recorder stopped, continuing without recording", "error", err) //losing the log should not stop the car
+			return nil
+		}
+		return err
+	})
+}
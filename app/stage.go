@@ -0,0 +1,323 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// StageConfig is what the output stage takes from the config
+type StageConfig struct {
+	Merge              []MergePolicy //per output channel
+	SBusRemaps         []sbus.Remap  //per sbus port, nil unless a control port or the trainer instructor
+	CRSFRemaps         []sbus.Remap  //per crsf port, nil unless a control port or the trainer instructor
+	CRSFMinLinkQuality []int         //per crsf port
+	Arming             config.ArmingConfig
+	Trainer            config.TrainerConfig
+	Gyro               config.GyroConfig
+}
+
+// NewStageConfig picks the receivers the stage merges and its checks out of the app config
+func NewStageConfig(cfg config.Config) StageConfig {
+	merge, err := ParseMergePolicies(cfg.AppCfg.MergePolicies, MergeSourceNames(len(cfg.SbusCfgs), len(cfg.CRSFCfgs)))
+	if err != nil {
+		slog.Error("failed parsing merge policies, using furthest from mid for those channels", "error", err)
+	}
+	stageCfg := StageConfig{
+		Merge:              merge,
+		SBusRemaps:         make([]sbus.Remap, len(cfg.SbusCfgs)),
+		CRSFRemaps:         make([]sbus.Remap, len(cfg.CRSFCfgs)),
+		CRSFMinLinkQuality: make([]int, len(cfg.CRSFCfgs)),
+		Arming:             cfg.ArmingCfg,
+		Trainer:            cfg.TrainerCfg,
+		Gyro:               cfg.GyroCfg,
+	}
+	for i := range cfg.SbusCfgs {
+		if cfg.SbusCfgs[i].SBusType == sbus.RxTypeControl || isInstructorPort(cfg.TrainerCfg, SBusSource(i)) {
+			stageCfg.SBusRemaps[i] = append(sbus.Remap{}, SBusRemap(i, cfg.SbusCfgs[i])...) //never nil, nil means not merged
+		}
+	}
+	for i := range cfg.CRSFCfgs {
+		if cfg.CRSFCfgs[i].CRSFType == sbus.RxTypeControl || isInstructorPort(cfg.TrainerCfg, CRSFSource(i)) {
+			stageCfg.CRSFRemaps[i] = append(sbus.Remap{}, CRSFRemap(i, cfg.CRSFCfgs[i])...)
+		}
+		stageCfg.CRSFMinLinkQuality[i] = cfg.CRSFCfgs[i].CRSFMinLinkQuality
+	}
+	return stageCfg
+}
+
+func isInstructorPort(cfg config.TrainerConfig, source string) bool {
+	return cfg.Enabled && cfg.Instructor == source
+}
+
+// CRSFLink is the latest channels of a crsf port and what its link looked like
+type CRSFLink struct {
+	Channels          sbus.Frame
+	ChannelsReceived  time.Time //zero before the first channels frame
+	LinkStatsReceived time.Time //zero before the first link statistics
+	UplinkQuality     uint8
+}
+
+// StageSources is where the stage reads its receivers, the app from its ports and replay from a session log.
+// Ports are config indexes
+type StageSources interface {
+	SBus(port int) (sbus.Frame, time.Time) //latest frame and when it arrived, zero while the port is not receiving
+	CRSF(port int) CRSFLink
+	Attitude(port int) (frames.AttitudeData, time.Time) //latest attitude of a crsf port, zero time before the first
+}
+
+// StageResult is one tick through the stage
+type StageResult struct {
+	Mixed    sbus.SBusFrame //controllers and receivers merged, then the trainer and gyro
+	MixState models.MixState
+	Output   sbus.SBusFrame //frame to send, neutral while disarmed, remapped and inverted for the car
+	Armed    bool
+	Err      error //set when the controllers could not be mixed, the output is then neutral
+}
+
+// Stage turns a tick's inputs into the output frame: mix the controllers, merge the receivers, apply the
+// trainer and gyro, hold neutral until armed, then remap and invert. The app runs it every processing tick
+// and replay runs it for every recorded output so a session log replays through the same code
+type Stage struct {
+	cfg               StageConfig
+	controllerManager *controllers.ControllerManager
+	estop             *EStop
+	watchdog          *Watchdog
+	profile           profiles.Profile
+
+	arming     *Arming
+	trainer    *Trainer //nil when trainer mode is off
+	gyro       *Gyro    //nil when the software gyro is off
+	sbusLinkUp []bool   //last link state of each sbus port, for logging changes
+	crsfLinkUp []bool   //last link state of each crsf port, for logging changes
+}
+
+func NewStage(cfg StageConfig, controllerManager *controllers.ControllerManager, estop *EStop, watchdog *Watchdog) *Stage {
+	stage := &Stage{
+		cfg:               cfg,
+		controllerManager: controllerManager,
+		estop:             estop,
+		watchdog:          watchdog,
+		arming:            NewArming(cfg.Arming),
+		sbusLinkUp:        make([]bool, len(cfg.SBusRemaps)),
+		crsfLinkUp:        make([]bool, len(cfg.CRSFRemaps)),
+	}
+	if cfg.Trainer.Enabled {
+		stage.trainer = NewTrainer(cfg.Trainer)
+	}
+	if cfg.Gyro.Enabled {
+		stage.gyro = NewGyro(cfg.Gyro)
+	}
+	return stage
+}
+
+// SetProfile changes the mixer options and the output map and inverts
+func (s *Stage) SetProfile(profile profiles.Profile) {
+	s.profile = profile
+	s.controllerManager.SetOptions(profile.ControllerOptions())
+}
+
+func (s *Stage) Tick(now time.Time, sources StageSources) StageResult {
+	controllerFrame, err := s.controllerManager.GetMixedFrame()
+	if err != nil {
+		s.arming.Disarm(now, DisarmSourceLost) //do not leave the last frame going out
+		return StageResult{
+			MixState: s.controllerManager.GetMixState(),
+			Output:   s.output(now, sbus.NewSBusFrame()),
+			Err:      fmt.Errorf("error getting mixed frame - %w", err),
+		}
+	}
+
+	merge := make([]MergeSource, 0, 1+len(s.cfg.SBusRemaps)+len(s.cfg.CRSFRemaps))
+	merge = append(merge, MergeSource{
+		Name:     ControllerSource,
+		Frame:    controllerFrame,
+		Channels: ControllerChannels(s.profile.Handbrake), //channels the wheel does not drive are left to the receivers
+	})
+	for port, remap := range s.cfg.SBusRemaps { //port order keeps ties in the merge the same every tick
+		if remap == nil || s.isInstructor(SBusSource(port)) {
+			continue //not a control port, or merged in by the trainer instead
+		}
+		readFrame, ok := s.sbusFrame(now, port, sources)
+		if !ok {
+			continue //a silent or failsafe receiver must not hold its last sticks
+		}
+		merge = append(merge, MergeSource{
+			Name:     SBusSource(port),
+			Frame:    sbus.SBusFrame{Frame: remap.Apply(readFrame)},
+			Channels: remap.Outputs(), //Only pull over values we care about
+		})
+	}
+	for port, remap := range s.cfg.CRSFRemaps {
+		if remap == nil || s.isInstructor(CRSFSource(port)) {
+			continue
+		}
+		readFrame, ok := s.crsfFrame(now, port, sources)
+		if !ok {
+			continue
+		}
+		merge = append(merge, MergeSource{
+			Name:     CRSFSource(port),
+			Frame:    sbus.SBusFrame{Frame: remap.Apply(readFrame)},
+			Channels: remap.Outputs(),
+		})
+	}
+
+	result := StageResult{
+		Mixed:    MergeSources(merge, s.cfg.Merge),
+		MixState: s.controllerManager.GetMixState(),
+	}
+	if s.trainer != nil {
+		instructorFrame, takeoverPressed, instructorOK := s.instructorFrame(now, sources)
+		s.trainer.Update(now, takeoverPressed, instructorOK)
+		result.Mixed = s.trainer.Mix(result.Mixed, instructorFrame, instructorOK)
+	}
+	if s.gyro != nil {
+		attitude, received := sources.Attitude(s.cfg.Gyro.Port)
+		result.Mixed = s.gyro.Apply(now, result.Mixed, attitude, received)
+	}
+
+	if s.estop.Latched() { //the estop holds the outputs itself, this keeps them neutral and makes the driver arm again after a reset
+		s.arming.Disarm(now, DisarmEStop)
+	} else {
+		armingInputs := NewArmingInputs(result.Mixed, result.MixState, s.controllerManager.GetInputs(), s.controlSourcesOK(now, sources))
+		result.Armed = s.arming.Update(now, armingInputs)
+	}
+	if result.Armed {
+		result.Output = s.output(now, result.Mixed)
+	} else {
+		result.Output = s.output(now, sbus.NewSBusFrame())
+	}
+	return result
+}
+
+// output maps a frame onto the car's channels, every frame out is a beat for the watchdog
+func (s *Stage) output(now time.Time, frame sbus.SBusFrame) sbus.SBusFrame {
+	frame = RemapChannels(frame, s.profile.OutputMap)
+	frame = InvertChannels(frame, s.profile.InvertOutputs)
+	s.watchdog.Beat(now)
+	return frame
+}
+
+func (s *Stage) isInstructor(source string) bool {
+	return s.trainer != nil && s.cfg.Trainer.Instructor == source
+}
+
+// instructorFrame reads the trainer instructor, false when the instructor is not delivering
+func (s *Stage) instructorFrame(now time.Time, sources StageSources) (frame sbus.SBusFrame, takeoverPressed bool, ok bool) {
+	cfg := s.cfg.Trainer
+	if cfg.Instructor == InstructorController {
+		frame, inputs, err := s.controllerManager.GetInstructorFrame()
+		if err != nil {
+			return sbus.NewSBusFrame(), false, false
+		}
+		return frame, InstructorTakeoverPressed(cfg, inputs), true
+	}
+
+	for port := range s.cfg.SBusRemaps {
+		if SBusSource(port) != cfg.Instructor {
+			continue
+		}
+		readFrame, ok := s.sbusFrame(now, port, sources)
+		if !ok {
+			break
+		}
+		frame, takeoverPressed = InstructorRadioFrame(cfg, readFrame, s.cfg.SBusRemaps[port])
+		return frame, takeoverPressed, true
+	}
+	for port := range s.cfg.CRSFRemaps {
+		if CRSFSource(port) != cfg.Instructor {
+			continue
+		}
+		readFrame, ok := s.crsfFrame(now, port, sources)
+		if !ok {
+			break
+		}
+		frame, takeoverPressed = InstructorRadioFrame(cfg, readFrame, s.cfg.CRSFRemaps[port])
+		return frame, takeoverPressed, true
+	}
+	return sbus.NewSBusFrame(), false, false
+}
+
+// sbusFrame reads the latest frame of an sbus port, false while the receiver is silent or flags
+// the frame lost or failsafe
+func (s *Stage) sbusFrame(now time.Time, port int, sources StageSources) (sbus.Frame, bool) {
+	readFrame, received := sources.SBus(port)
+	ok := SBusLinkOK(now, received, readFrame, time.Duration(s.cfg.Arming.SourceTimeout)*time.Millisecond)
+	if ok != s.sbusLinkUp[port] {
+		s.sbusLinkUp[port] = ok
+		if ok {
+			slog.Info("sbus link up", "port", port)
+		} else {
+			slog.Warn("sbus link lost", "port", port, "last_received", received, "frame_lost", readFrame.Flags.Framelost, "failsafe", readFrame.Flags.Failsafe)
+		}
+	}
+	return readFrame, ok
+}
+
+// crsfFrame reads the channels of a crsf port, false while its link is lost
+func (s *Stage) crsfFrame(now time.Time, port int, sources StageSources) (sbus.Frame, bool) {
+	link := sources.CRSF(port)
+	ok := crsfLinkOK(now,
+		link.ChannelsReceived,
+		link.LinkStatsReceived,
+		link.UplinkQuality,
+		s.cfg.CRSFMinLinkQuality[port],
+		time.Duration(s.cfg.Arming.SourceTimeout)*time.Millisecond,
+	)
+	if ok != s.crsfLinkUp[port] {
+		s.crsfLinkUp[port] = ok
+		if ok {
+			slog.Info("crsf link up", "port", port, "uplink_quality", link.UplinkQuality)
+		} else {
+			slog.Warn("crsf link lost", "port", port, "uplink_quality", link.UplinkQuality, "channels_received", link.ChannelsReceived)
+		}
+	}
+	return link.Channels, ok
+}
+
+// controlSourcesOK is false when a control sbus port that was delivering frames has gone quiet, or a
+// control crsf port that was delivering channels has lost its link.
+// Ports that have never received are not counted so an unplugged receiver does not block arming
+func (s *Stage) controlSourcesOK(now time.Time, sources StageSources) bool {
+	timeout := time.Duration(s.cfg.Arming.SourceTimeout) * time.Millisecond
+	for port := range s.cfg.SBusRemaps {
+		if s.cfg.SBusRemaps[port] == nil {
+			continue
+		}
+		_, received := sources.SBus(port)
+		if !received.IsZero() && now.Sub(received) > timeout {
+			return false
+		}
+	}
+	for port := range s.cfg.CRSFRemaps {
+		if s.cfg.CRSFRemaps[port] == nil || sources.CRSF(port).ChannelsReceived.IsZero() {
+			continue
+		}
+		if !s.crsfLinkUp[port] { //kept up to date by the merge each tick
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Stage) Arming() *Arming {
+	return s.arming
+}
+
+// Trainer is nil when trainer mode is off
+func (s *Stage) Trainer() *Trainer {
+	return s.trainer
+}
+
+// Gyro is nil when the software gyro is off
+func (s *Stage) Gyro() *Gyro {
+	return s.gyro
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// Only control ports and the trainer instructor are read by the stage
+func TestNewStageConfig(t *testing.T) {
+	cfg := config.Config{
+		SbusCfgs: []config.SBusConfig{
+			{SBusType: sbus.RxTypeControl},
+			{SBusType: sbus.RxTypeTelemetry},
+			{SBusType: sbus.RxTypeTelemetry, SBusChannels: []int{0, 1}},
+		},
+		CRSFCfgs: []config.CRSFConfig{
+			{CRSFType: sbus.RxTypeTelemetry, CRSFMinLinkQuality: 40},
+			{CRSFType: sbus.RxTypeControl, CRSFChannels: []int{3}},
+		},
+		TrainerCfg: config.TrainerConfig{Enabled: true, Instructor: SBusSource(2)},
+	}
+	stageCfg := NewStageConfig(cfg)
+	for port, want := range []bool{true, false, true} {
+		if got := stageCfg.SBusRemaps[port] != nil; got != want {
+			t.Errorf("sbus%d: read %t want %t", port, got, want)
+		}
+	}
+	for port, want := range []bool{false, true} {
+		if got := stageCfg.CRSFRemaps[port] != nil; got != want {
+			t.Errorf("crsf%d: read %t want %t", port, got, want)
+		}
+	}
+	if len(stageCfg.SBusRemaps[2]) != 2 || stageCfg.CRSFMinLinkQuality[0] != 40 {
+		t.Errorf("remaps %v min link quality %v", stageCfg.SBusRemaps, stageCfg.CRSFMinLinkQuality)
+	}
+
+	cfg.TrainerCfg.Enabled = false
+	if NewStageConfig(cfg).SBusRemaps[2] != nil {
+		t.Error("instructor port read with the trainer off")
+	}
+}
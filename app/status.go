@@ -0,0 +1,142 @@
+package app
+
+import (
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/api"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/crsf"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+const maxAxisInput = 10 //raw inputs 0-9 are axis, see the g27 key map
+
+// publishStatus keeps a copy of this tick's results for readers outside the processing loop
+func (a *App) publishStatus(mixedFrame sbus.SBusFrame, outputFrame sbus.SBusFrame, mixState models.MixState) {
+	a.statusLock.Lock()
+	defer a.statusLock.Unlock()
+	a.status.Time = time.Now()
+	a.status.Profile = a.profile.Name
+	a.status.Frame = mixedFrame.Frame
+	a.status.Output = outputFrame.Frame
+	a.status.MixState = mixState.Copy()
+	a.status.FFLevel = a.ffLevel
+	arming := a.stage.Arming()
+	a.status.Arming = api.ArmingStatus{
+		Armed:  arming.Armed(),
+		Reason: arming.Reason(),
+		Since:  arming.Since(),
+	}
+
+	if trainer := a.stage.Trainer(); trainer != nil {
+		a.status.Trainer = api.TrainerStatus{
+			Enabled:  true,
+			Takeover: trainer.Takeover(),
+			Since:    trainer.Since(),
+		}
+	}
+
+	if gyro := a.stage.Gyro(); gyro != nil {
+		a.status.Gyro = api.GyroStatus{
+			Enabled:    true,
+			Mode:       a.cfg.GyroCfg.Mode,
+			Active:     gyro.Active(),
+			YawRate:    gyro.YawRate(),
+			Correction: gyro.Correction(),
+		}
+	}
+
+	inputs := a.controllerManager.GetInputs()
+	a.status.Inputs = make([]models.Input, 0, maxAxisInput) //new slice since readers hold the old one
+	for i := 0; i < len(inputs) && i < maxAxisInput; i++ {
+		if inputs[i].Label != "" || inputs[i].Max != inputs[i].Min {
+			a.status.Inputs = append(a.status.Inputs, inputs[i])
+		}
+	}
+}
+
+// Status is safe to call from any goroutine
+func (a *App) Status() api.Status {
+	a.statusLock.RLock()
+	status := a.status
+	a.statusLock.RUnlock()
+
+	status.EStop = api.EStopStatus{ //read live rather than from the last tick in case the processing loop stalled
+		Latched: a.estop.Latched(),
+		Reason:  a.estop.Reason(),
+		Since:   a.estop.Since(),
+	}
+	status.Watchdog = api.WatchdogStatus{
+		Tripped: a.watchdog.Tripped(),
+		Since:   a.watchdog.Since(),
+	}
+
+	now := time.Now()
+	status.Ports = make([]api.PortStatus, 0, len(a.sBusConns)+len(a.crsfConns))
+	status.Telemetry = make([]api.TelemetryStatus, 0, len(a.sBusConns)+len(a.crsfConns))
+	sbusTelemetry := make([]api.TelemetryStatus, 0, len(a.sBusConns)) //listed after crsf so the dashboard keeps showing the crsf link first
+	for i := range a.sBusConns {
+		lastReceived := a.sBusConns[i].LastReceived()
+		stats := a.sBusConns[i].Stats()
+		if a.sBusConns[i].Type() == sbus.RxTypeTelemetry {
+			telemetry := crsf.CRSFTelemetry{}
+			sensors := a.sBusConns[i].GetTelemetry()
+			mergeSBusTelemetry(&telemetry, sensors, now)
+			rxVoltage := 0.0
+			if !sensors.RxVoltageTime.IsZero() && now.Sub(sensors.RxVoltageTime) <= sbusTelemetryMaxAge {
+				rxVoltage = sensors.RxVoltage
+			}
+			sbusTelemetry = append(sbusTelemetry, api.TelemetryStatus{
+				Kind:          "sbus",
+				Index:         i,
+				Path:          a.sBusConns[i].Path(),
+				RxVoltage:     rxVoltage,
+				CRSFTelemetry: telemetry,
+			})
+		}
+		status.Ports = append(status.Ports, api.PortStatus{
+			Kind:         "sbus",
+			Index:        i,
+			Path:         a.sBusConns[i].Path(),
+			Type:         a.sBusConns[i].Type(),
+			Receiving:    a.sBusConns[i].IsReceiving(),
+			Transmitting: a.sBusConns[i].IsTransmitting(),
+			LastReceived: lastReceived,
+			Age:          frameAge(now, lastReceived),
+			SBusStats:    &stats,
+		})
+	}
+
+	for i := range a.crsfConns {
+		lastReceived := a.crsfConns[i].LastReceived()
+		status.Ports = append(status.Ports, api.PortStatus{
+			Kind:         "crsf",
+			Index:        i,
+			Path:         a.crsfConns[i].Path(),
+			Type:         a.cfg.CRSFCfgs[a.crsfPorts[i]].CRSFType,
+			Receiving:    a.crsfConns[i].IsReceiving(),
+			LastReceived: lastReceived,
+			Age:          frameAge(now, lastReceived),
+		})
+		status.Telemetry = append(status.Telemetry, api.TelemetryStatus{
+			Kind:          "crsf",
+			Index:         i,
+			Path:          a.crsfConns[i].Path(),
+			CRSFTelemetry: a.crsfConns[i].GetData().CRSFTelemetry,
+		})
+	}
+	status.Telemetry = append(status.Telemetry, sbusTelemetry...)
+	return status
+}
+
+func (a *App) Profiles() []profiles.Profile {
+	return a.profiles.Profiles()
+}
+
+func frameAge(now time.Time, lastReceived time.Time) time.Duration {
+	if lastReceived.IsZero() {
+		return -1
+	}
+	return now.Sub(lastReceived)
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"math"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/crsf"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// sbusTelemetryMaxAge is how long an sbus2 sensor value is used, sensors report every few frames so older values
+// are from a sensor that stopped
+const sbusTelemetryMaxAge = time.Second
+
+// telemetry merges the first crsf link with every sbus2 telemetry port, sbus2 sensors win when both report
+func (a *App) telemetry() crsf.CRSFTelemetry {
+	merged := crsf.CRSFTelemetry{}
+	if len(a.crsfConns) > 0 { //Todo: always using first crsf
+		merged = a.crsfConns[0].GetData().CRSFTelemetry
+	}
+	for i := range a.sBusConns {
+		if a.sBusConns[i].IsReceiving() && a.sBusConns[i].Type() == sbus.RxTypeTelemetry {
+			mergeSBusTelemetry(&merged, a.sBusConns[i].GetTelemetry(), time.Now())
+		}
+	}
+	return merged
+}
+
+// mergeSBusTelemetry converts the sbus2 sensors that have reported recently into crsf units. The receiver's own
+// supply voltage is not the car's battery so it is left out
+func mergeSBusTelemetry(merged *crsf.CRSFTelemetry, telemetry sbus.Telemetry, now time.Time) {
+	fresh := func(received time.Time) bool {
+		return !received.IsZero() && now.Sub(received) <= sbusTelemetryMaxAge
+	}
+	if fresh(telemetry.VoltageTime) {
+		merged.BatterySensor.Voltage = int16(math.Round(telemetry.Voltage * 10))
+	}
+	if fresh(telemetry.RPMTime) {
+		merged.Rpm.Rpm = []int32{int32(telemetry.RPM)}
+	}
+	if fresh(telemetry.TemperatureTime) {
+		merged.Temperature.Temperatures = []int16{int16(telemetry.Temperature * 10)}
+	}
+	if fresh(telemetry.GpsTime) {
+		merged.Gps.Lat = int32(math.Round(telemetry.Gps.Lat * 10000000))
+		merged.Gps.Long = int32(math.Round(telemetry.Gps.Long * 10000000))
+		merged.Gps.Speed = int16(telemetry.Gps.Speed * 10)
+		merged.Gps.Altitude = uint16(telemetry.Gps.Altitude + 1000)
+		merged.Vario.Speed = int16(math.Round(telemetry.Gps.Vario * 100))
+	}
+	if fresh(telemetry.FeedbackTime) {
+		merged.Attitude.Pitch = int16(telemetry.Feedback)
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/crsf"
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+func TestMergeSBusTelemetry(t *testing.T) {
+	now := time.Now()
+	merged := crsf.CRSFTelemetry{
+		BatterySensor: frames.BatterySensorData{Voltage: 111, Remaining: 80},
+		Attitude:      frames.AttitudeData{Pitch: 42, Roll: 7},
+		Gps:           frames.GpsData{SatelliteCount: 9},
+	}
+	mergeSBusTelemetry(&merged, sbus.Telemetry{
+		RxVoltage:       7.4,
+		RxVoltageTime:   now,
+		Temperature:     -12,
+		TemperatureTime: now,
+		RPM:             12000,
+		RPMTime:         now,
+		Gps:             sbus.GpsTelemetry{Lat: 47.6205, Long: -122.3493, Speed: 43, Altitude: -5, Vario: -1.5},
+		GpsTime:         now,
+		Feedback:        0, //not reported so crsf pitch is kept
+	}, now)
+
+	if merged.BatterySensor.Voltage != 111 || merged.BatterySensor.Remaining != 80 { //the receiver's own supply is not the battery
+		t.Errorf("battery %+v", merged.BatterySensor)
+	}
+	if len(merged.Rpm.Rpm) != 1 || merged.Rpm.Rpm[0] != 12000 {
+		t.Errorf("rpm %+v", merged.Rpm)
+	}
+	if len(merged.Temperature.Temperatures) != 1 || merged.Temperature.Temperatures[0] != -120 {
+		t.Errorf("temperature %+v", merged.Temperature)
+	}
+	wantGps := frames.GpsData{Lat: 476205000, Long: -1223493000, Speed: 430, Altitude: 995, SatelliteCount: 9}
+	if merged.Gps != wantGps {
+		t.Errorf("gps got %+v want %+v", merged.Gps, wantGps)
+	}
+	if merged.Vario.Speed != -150 {
+		t.Errorf("vario %d", merged.Vario.Speed)
+	}
+	if merged.Attitude.Pitch != 42 {
+		t.Errorf("pitch %d", merged.Attitude.Pitch)
+	}
+
+	mergeSBusTelemetry(&merged, sbus.Telemetry{Voltage: 12.6, VoltageTime: now, RxVoltage: 5, RxVoltageTime: now, Feedback: 1500, FeedbackTime: now}, now)
+	if merged.BatterySensor.Voltage != 126 || merged.Attitude.Pitch != 1500 || merged.Attitude.Roll != 7 {
+		t.Errorf("battery %+v attitude %+v", merged.BatterySensor, merged.Attitude)
+	}
+
+	stale := now.Add(-2 * sbusTelemetryMaxAge)
+	merged = crsf.CRSFTelemetry{Attitude: frames.AttitudeData{Pitch: 42}}
+	mergeSBusTelemetry(&merged, sbus.Telemetry{
+		Voltage:      12.6,
+		VoltageTime:  stale,
+		RPM:          9000,
+		RPMTime:      stale,
+		Gps:          sbus.GpsTelemetry{Speed: 43},
+		GpsTime:      stale,
+		Feedback:     1500,
+		FeedbackTime: stale, //one stray slot long ago
+	}, now)
+	if merged.Attitude.Pitch != 42 || merged.BatterySensor.Voltage != 0 || merged.Rpm.Rpm != nil || merged.Gps.Speed != 0 {
+		t.Errorf("stale sensors merged %+v", merged)
+	}
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// InstructorController is the trainer instructor setting for a second wheel instead of an sbus receiver
+const InstructorController = "controller"
+
+// takeoverSwitchHigh is half way from mid to max so both 2 and 3 position radio switches take over at the top
+const takeoverSwitchHigh = (sbus.MidValue + sbus.MaxValue) / 2
+
+// Trainer lets an instructor share or take over control from a student. Split and limited control apply
+// while the student drives, on takeover the instructor's frame goes out as is
+type Trainer struct {
+	cfg      config.TrainerConfig
+	takeover bool
+	pressed  bool //takeover input on the last update, for latching
+	since    time.Time
+}
+
+func NewTrainer(cfg config.TrainerConfig) *Trainer {
+	return &Trainer{
+		cfg: cfg,
+	}
+}
+
+// Update applies the takeover input and returns if the instructor has full control. Losing the instructor hands control back
+func (t *Trainer) Update(now time.Time, takeoverPressed bool, instructorOK bool) bool {
+	if !instructorOK {
+		takeoverPressed = false
+	}
+	wasPressed := t.pressed
+	t.pressed = takeoverPressed
+
+	takeover := takeoverPressed
+	if t.cfg.TakeoverLatch {
+		takeover = t.takeover
+		if takeoverPressed && !wasPressed {
+			takeover = !takeover
+		}
+		if !instructorOK {
+			takeover = false
+		}
+	}
+	if takeover == t.takeover {
+		return t.takeover
+	}
+
+	t.takeover = takeover
+	t.since = now
+	if takeover {
+		metrics.TrainerTakeover.Set(1)
+		metrics.TrainerTakeovers.Inc()
+		slog.Warn("instructor took over")
+	} else if !instructorOK {
+		metrics.TrainerTakeover.Set(0)
+		slog.Warn("lost instructor, student has control")
+	} else {
+		metrics.TrainerTakeover.Set(0)
+		slog.Info("student has control")
+	}
+	return t.takeover
+}
+
+// Mix builds the output from both frames. Channels the instructor owns go neutral when the instructor is lost
+func (t *Trainer) Mix(student sbus.SBusFrame, instructor sbus.SBusFrame, instructorOK bool) sbus.SBusFrame {
+	if t.takeover && instructorOK {
+		return instructor
+	}
+
+	mixed := student
+	mixed.Frame.Ch[1] = limitThrottle(mixed.Frame.Ch[1], t.cfg.StudentThrottle)
+	for _, ch := range t.cfg.InstructorChannels {
+		if instructorOK {
+			mixed.Frame.Ch[ch] = instructor.Frame.Ch[ch]
+		} else {
+			mixed.Frame.Ch[ch] = uint16(sbus.MidValue)
+		}
+	}
+	return mixed
+}
+
+// InstructorRadioFrame reads the takeover switch from an instructor receiver's frame then applies its channel table.
+// An instructor radio without a table drives every channel as is
+func InstructorRadioFrame(cfg config.TrainerConfig, readFrame sbus.Frame, remap sbus.Remap) (frame sbus.SBusFrame, takeoverPressed bool) {
+	if cfg.TakeoverChannel >= 0 && cfg.TakeoverChannel < sbus.MaxChannels {
+		takeoverPressed = int(readFrame.Ch[cfg.TakeoverChannel]) > takeoverSwitchHigh
+	}
+	if len(remap) > 0 {
+		readFrame = remap.Apply(readFrame)
+	}
+	return sbus.SBusFrame{Frame: readFrame}, takeoverPressed
+}
+
+// InstructorTakeoverPressed is true when the takeover button on the instructor wheel is held
+func InstructorTakeoverPressed(cfg config.TrainerConfig, inputs []models.Input) bool {
+	return isPressed(inputs, cfg.TakeoverButton)
+}
+
+// limitThrottle scales esc above mid by percent, brakes below mid are left alone
+func limitThrottle(value uint16, percent int) uint16 {
+	if percent >= 100 || int(value) <= sbus.MidValue {
+		return value
+	}
+	return uint16(sbus.MidValue + (int(value)-sbus.MidValue)*max(percent, 0)/100)
+}
+
+func (t *Trainer) Takeover() bool {
+	return t.takeover
+}
+
+// Since is when control last changed hands, zero if it has not since start up
+func (t *Trainer) Since() time.Time {
+	return t.since
+}
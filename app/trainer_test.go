@@ -0,0 +1,83 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+func TestTrainerTakeover(t *testing.T) {
+	start := time.Now()
+	student := frameWith(map[int]uint16{0: 1200, 1: 1500})
+	instructor := frameWith(map[int]uint16{0: 800, 1: 1000})
+
+	trainer := NewTrainer(config.TrainerConfig{StudentThrottle: 100})
+	if trainer.Update(start, false, true) || trainer.Mix(student, instructor, true) != student {
+		t.Fatal("student should drive without takeover")
+	}
+	if !trainer.Update(start.Add(time.Millisecond), true, true) || trainer.Mix(student, instructor, true) != instructor {
+		t.Fatal("instructor should drive while takeover is held")
+	}
+	if !trainer.Since().Equal(start.Add(time.Millisecond)) {
+		t.Errorf("since %v", trainer.Since())
+	}
+	if trainer.Update(start.Add(2*time.Millisecond), true, false) {
+		t.Fatal("takeover kept with the instructor lost")
+	}
+	if trainer.Update(start.Add(3*time.Millisecond), false, true) {
+		t.Fatal("takeover after release")
+	}
+}
+
+func TestTrainerTakeoverLatch(t *testing.T) {
+	start := time.Now()
+	trainer := NewTrainer(config.TrainerConfig{TakeoverLatch: true})
+	presses := []struct {
+		pressed bool
+		want    bool
+	}{
+		{pressed: true, want: true},
+		{pressed: true, want: true}, //still held
+		{pressed: false, want: true},
+		{pressed: true, want: false},
+		{pressed: false, want: false},
+	}
+	for i, press := range presses {
+		if got := trainer.Update(start.Add(time.Duration(i)*time.Millisecond), press.pressed, true); got != press.want {
+			t.Fatalf("update %d: takeover %v want %v", i, got, press.want)
+		}
+	}
+
+	trainer.Update(start, true, true)
+	trainer.Update(start, false, true)
+	if trainer.Update(start, false, false) {
+		t.Fatal("latched takeover kept with the instructor lost")
+	}
+}
+
+func TestTrainerSplitControl(t *testing.T) {
+	trainer := NewTrainer(config.TrainerConfig{InstructorChannels: []int{1}, StudentThrottle: 50})
+	student := frameWith(map[int]uint16{0: 1200, 1: 1500, 2: 300})
+	instructor := frameWith(map[int]uint16{0: 800, 1: 1100, 2: 1800})
+
+	got := trainer.Mix(student, instructor, true)
+	if want := frameWith(map[int]uint16{0: 1200, 1: 1100, 2: 300}); got != want {
+		t.Errorf("got %+v want %+v", got.Frame.Ch[:3], want.Frame.Ch[:3])
+	}
+	got = trainer.Mix(student, instructor, false)
+	if got.Frame.Ch[1] != uint16(sbus.MidValue) {
+		t.Errorf("instructor channel %d with the instructor lost", got.Frame.Ch[1])
+	}
+
+	trainer = NewTrainer(config.TrainerConfig{StudentThrottle: 50})
+	got = trainer.Mix(student, instructor, true)
+	if got.Frame.Ch[1] != 1246 {
+		t.Errorf("limited throttle %d", got.Frame.Ch[1])
+	}
+	brake := frameWith(map[int]uint16{1: 400})
+	if got = trainer.Mix(brake, instructor, true); got.Frame.Ch[1] != 400 {
+		t.Errorf("limited brake to %d", got.Frame.Ch[1])
+	}
+}
@@ -3,31 +3,42 @@ package app
 import (
 	"fmt"
 	"log/slog"
-	"math"
+	"strings"
 
 	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/go-evdev"
 	sbus "github.com/Speshl/pi_drift_wheel/sbus"
 	"github.com/albenik/go-serial/v2"
 )
 
 // Merge all provided frames into 1 frame. Use the furthest channel value from the midpoint of each frame
 func MergeFrames(frames []sbus.SBusFrame) sbus.SBusFrame {
-	if len(frames) == 0 {
-		return sbus.NewSBusFrame()
-	}
-
-	mergedFrame := frames[0]
+	sources := make([]MergeSource, len(frames))
 	for i := range frames {
-		for j := range frames[i].Frame.Ch {
-			mergedDistFromMid := math.Abs(float64(mergedFrame.Frame.Ch[j]) - float64(sbus.MidValue))
-			frameDisFromMid := math.Abs(float64(frames[i].Frame.Ch[j]) - float64(sbus.MidValue))
+		sources[i] = MergeSource{Frame: frames[i]}
+	}
+	return MergeSources(sources, nil)
+}
 
-			if frameDisFromMid > mergedDistFromMid {
-				mergedFrame.Frame.Ch[j] = frames[i].Frame.Ch[j]
-			}
+// Move each mixed channel to the output channel it is mapped to, channels past the end of the map stay where they are.
+// Outputs no channel lands on are held mid so a moved channel does not also stay on its old output
+func RemapChannels(inputFrame sbus.SBusFrame, outputMap []int) sbus.SBusFrame {
+	if len(outputMap) == 0 {
+		return inputFrame
+	}
+	returnFrame := inputFrame
+	for i := range returnFrame.Frame.Ch {
+		returnFrame.Frame.Ch[i] = uint16(sbus.MidValue)
+		if i >= len(outputMap) {
+			returnFrame.Frame.Ch[i] = inputFrame.Frame.Ch[i]
 		}
 	}
-	return mergedFrame
+	for i := range outputMap { //mapped channels win over ones passed through
+		if outputMap[i] >= 0 && outputMap[i] < sbus.MaxChannels {
+			returnFrame.Frame.Ch[outputMap[i]] = inputFrame.Frame.Ch[i]
+		}
+	}
+	return returnFrame
 }
 
 func InvertChannels(inputFrame sbus.SBusFrame, invertChannels []bool) sbus.SBusFrame {
@@ -42,6 +53,43 @@ func InvertChannels(inputFrame sbus.SBusFrame, invertChannels []bool) sbus.SBusF
 	return returnFrame
 }
 
+// isPressed is true when an input with the label is away from its resting value
+func isPressed(inputs []models.Input, label string) bool {
+	if label == "" {
+		return false
+	}
+	for i := range inputs {
+		if inputs[i].Label != label {
+			continue
+		}
+		rest := inputs[i].Min
+		switch inputs[i].Rests {
+		case "high":
+			rest = inputs[i].Max
+		case "middle", "mid": //hats rest at mid
+			rest = (inputs[i].Min + inputs[i].Max) / 2
+		}
+		if inputs[i].Value != rest {
+			return true
+		}
+	}
+	return false
+}
+
+// openInputDevice opens an input device by its /dev/input path or by the name the kernel reports
+func openInputDevice(nameOrPath string) (*evdev.InputDevice, error) {
+	inputPaths, err := evdev.ListDevicePaths()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing device paths: %w", err)
+	}
+	for _, inputPath := range inputPaths {
+		if inputPath.Path == nameOrPath || strings.EqualFold(inputPath.Name, nameOrPath) { //env values are lower cased
+			return evdev.Open(inputPath.Path)
+		}
+	}
+	return nil, fmt.Errorf("no input device %s", nameOrPath)
+}
+
 func ListPorts() error {
 	ports, err := serial.GetPortsList()
 	if err != nil {
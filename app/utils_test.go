@@ -0,0 +1,173 @@
+package app
+
+import (
+	"math"
+	"testing"
+
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+func frameWith(values map[int]uint16) sbus.SBusFrame {
+	frame := sbus.NewSBusFrame()
+	for ch, value := range values {
+		frame.Frame.Ch[ch] = value
+	}
+	return frame
+}
+
+func TestMergeFrames(t *testing.T) {
+	prioritised := frameWith(map[int]uint16{0: 1000})
+	prioritised.Priority = 10
+
+	tests := []struct {
+		name   string
+		frames []sbus.SBusFrame
+		want   sbus.SBusFrame
+	}{
+		{
+			name:   "no frames",
+			frames: nil,
+			want:   sbus.NewSBusFrame(),
+		},
+		{
+			name:   "single frame",
+			frames: []sbus.SBusFrame{frameWith(map[int]uint16{0: 1500, 15: 172})},
+			want:   frameWith(map[int]uint16{0: 1500, 15: 172}),
+		},
+		{
+			name: "furthest from mid wins per channel",
+			frames: []sbus.SBusFrame{
+				frameWith(map[int]uint16{0: 1000, 1: 500, 2: 1811}),
+				frameWith(map[int]uint16{0: 1500, 1: 1000, 2: 172}),
+			},
+			want: frameWith(map[int]uint16{0: 1500, 1: 500, 2: 172}),
+		},
+		{
+			name: "tie keeps the earlier frame",
+			frames: []sbus.SBusFrame{
+				frameWith(map[int]uint16{0: 1092}),
+				frameWith(map[int]uint16{0: 892}),
+			},
+			want: frameWith(map[int]uint16{0: 1092}),
+		},
+		{
+			name: "first frame priority kept",
+			frames: []sbus.SBusFrame{
+				prioritised,
+				frameWith(map[int]uint16{0: 1811}),
+			},
+			want: func() sbus.SBusFrame {
+				frame := frameWith(map[int]uint16{0: 1811})
+				frame.Priority = 10
+				return frame
+			}(),
+		},
+	}
+	for _, tc := range tests {
+		got := MergeFrames(tc.frames)
+		if got != tc.want {
+			t.Errorf("%s: got %+v want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRemapChannels(t *testing.T) {
+	frame := frameWith(map[int]uint16{0: 1800, 1: 200, 2: 1500, 3: 1100, 4: 900})
+	tests := []struct {
+		name      string
+		outputMap []int
+		want      sbus.SBusFrame
+	}{
+		{name: "no map", outputMap: nil, want: frame},
+		{name: "one to one", outputMap: []int{0, 1, 2, 3}, want: frame},
+		{name: "swap", outputMap: []int{1, 0}, want: frameWith(map[int]uint16{0: 200, 1: 1800, 2: 1500, 3: 1100, 4: 900})},
+		{name: "moved channel leaves its old output", outputMap: []int{3}, want: frameWith(map[int]uint16{1: 200, 2: 1500, 3: 1800, 4: 900})},
+		{name: "moved past the map", outputMap: []int{4, 1, 2}, want: frameWith(map[int]uint16{1: 200, 2: 1500, 3: 1100, 4: 1800})},
+	}
+	for _, tc := range tests {
+		got := RemapChannels(frame, tc.outputMap)
+		if got != tc.want {
+			t.Errorf("%s: got %v want %v", tc.name, got.Frame.Ch, tc.want.Frame.Ch)
+		}
+	}
+}
+
+func TestInvertChannels(t *testing.T) {
+	tests := []struct {
+		name   string
+		frame  sbus.SBusFrame
+		invert []bool
+		want   sbus.SBusFrame
+	}{
+		{
+			name:   "nothing inverted",
+			frame:  frameWith(map[int]uint16{0: 1811}),
+			invert: nil,
+			want:   frameWith(map[int]uint16{0: 1811}),
+		},
+		{
+			name:   "max and min swap sides",
+			frame:  frameWith(map[int]uint16{0: 1811, 1: 172, 2: 1811}),
+			invert: []bool{true, true, false},
+			want:   frameWith(map[int]uint16{0: 173, 1: 1812, 2: 1811}),
+		},
+		{
+			name:   "mid stays",
+			frame:  sbus.NewSBusFrame(),
+			invert: []bool{true, true, true, true},
+			want:   sbus.NewSBusFrame(),
+		},
+		{
+			name:   "last channel",
+			frame:  frameWith(map[int]uint16{15: 1092}),
+			invert: append(make([]bool, 15), true),
+			want:   frameWith(map[int]uint16{15: 892}),
+		},
+	}
+	for _, tc := range tests {
+		got := InvertChannels(tc.frame, tc.invert)
+		if got != tc.want {
+			t.Errorf("%s: got %v want %v", tc.name, got.Frame.Ch, tc.want.Frame.Ch)
+		}
+	}
+}
+
+func TestInvertChannelsTwiceIsUnchanged(t *testing.T) {
+	invert := make([]bool, sbus.MaxChannels)
+	for i := range invert {
+		invert[i] = true
+	}
+	for value := sbus.MinValue; value <= sbus.MaxValue; value++ {
+		frame := frameWith(map[int]uint16{0: uint16(value), 7: uint16(value)})
+		got := InvertChannels(InvertChannels(frame, invert), invert)
+		if got != frame {
+			t.Fatalf("value %d: got %d", value, got.Frame.Ch[0])
+		}
+	}
+}
+
+func TestCalculateFFLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		feedback int
+		steer    int
+		want     float64
+	}{
+		{name: "centered", feedback: 500, steer: sbus.MidValue, want: 0},
+		{name: "inside deadzone", feedback: 500, steer: sbus.MidValue + 8, want: 0},
+		{name: "small pull right", feedback: 500, steer: sbus.MidValue + 100, want: 200.0 / 1639},
+		{name: "small pull left", feedback: 500, steer: sbus.MidValue - 100, want: -200.0 / 1639},
+		{name: "full right from center", feedback: 500, steer: sbus.MaxValue, want: 1638.0 / 1639},
+		{name: "full left from center limits", feedback: 500, steer: sbus.MinValue, want: -1},
+		{name: "servo right wheel left", feedback: 750, steer: sbus.MinValue, want: -1},
+		{name: "servo left wheel center", feedback: 300, steer: sbus.MidValue, want: 1},
+		{name: "feedback past the calibration", feedback: 200, steer: sbus.MinValue, want: 0},
+		{name: "servo following wheel", feedback: 750, steer: sbus.MaxValue, want: 0},
+	}
+	for _, tc := range tests {
+		got := calculateFFLevel(300, 500, 750, tc.feedback, tc.steer)
+		if math.Abs(got-tc.want) > 0.0001 {
+			t.Errorf("%s: got %f want %f", tc.name, got, tc.want)
+		}
+	}
+}
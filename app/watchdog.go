@@ -0,0 +1,90 @@
+package app
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// Watchdog puts every sbus output into failsafe when the processing loop stops producing frames.
+// It is checked from its own goroutine so a stalled loop cannot hold it up
+type Watchdog struct {
+	timeout  time.Duration
+	lastBeat atomic.Int64 //unix nanoseconds of the last frame sent, 0 before the first
+
+	lock    sync.RWMutex
+	outputs []*sbus.SBus
+	tripped bool
+	since   time.Time
+}
+
+func NewWatchdog(timeout time.Duration) *Watchdog {
+	return &Watchdog{
+		timeout: timeout,
+	}
+}
+
+// SetOutputs are the ports put into failsafe when tripped
+func (w *Watchdog) SetOutputs(outputs []*sbus.SBus) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.outputs = outputs
+	w.setFailsafe(w.tripped)
+}
+
+// Beat records a fresh frame, called by the processing loop every time it sends one
+func (w *Watchdog) Beat(now time.Time) {
+	w.lastBeat.Store(now.UnixNano())
+}
+
+// Check trips when there has been no beat within the timeout and recovers once beats resume.
+// Nothing trips before the first beat so a slow start up is left to arming
+func (w *Watchdog) Check(now time.Time) bool {
+	lastBeat := w.lastBeat.Load()
+	if lastBeat == 0 {
+		return false
+	}
+	late := now.Sub(time.Unix(0, lastBeat))
+	stalled := late > w.timeout
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if stalled == w.tripped {
+		return w.tripped
+	}
+	w.tripped = stalled
+	w.since = now
+	w.setFailsafe(stalled)
+	if stalled {
+		metrics.WatchdogTripped.Set(1)
+		metrics.WatchdogTrips.Inc()
+		slog.Error("processing stalled, outputs in failsafe", "since_last_frame", late, "timeout", w.timeout)
+	} else {
+		metrics.WatchdogTripped.Set(0)
+		slog.Info("processing recovered, outputs live")
+	}
+	return w.tripped
+}
+
+func (w *Watchdog) setFailsafe(failsafe bool) {
+	for i := range w.outputs {
+		w.outputs[i].SetFailsafe(failsafe)
+	}
+}
+
+func (w *Watchdog) Tripped() bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.tripped
+}
+
+// Since is when the watchdog last tripped or recovered, zero if it has not since start up
+func (w *Watchdog) Since() time.Time {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.since
+}
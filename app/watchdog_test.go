@@ -0,0 +1,37 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	start := time.Now()
+	watchdog := NewWatchdog(50 * time.Millisecond)
+	if watchdog.Check(start.Add(time.Second)) {
+		t.Fatal("tripped before the first frame")
+	}
+
+	watchdog.Beat(start)
+	if watchdog.Check(start.Add(50 * time.Millisecond)) {
+		t.Fatal("tripped at the timeout")
+	}
+	if !watchdog.Check(start.Add(51*time.Millisecond)) || !watchdog.Tripped() {
+		t.Fatal("did not trip past the timeout")
+	}
+	if !watchdog.Since().Equal(start.Add(51 * time.Millisecond)) {
+		t.Errorf("since %v", watchdog.Since())
+	}
+	watchdog.Check(start.Add(time.Second))
+	if !watchdog.Since().Equal(start.Add(51 * time.Millisecond)) {
+		t.Errorf("staying tripped moved since to %v", watchdog.Since())
+	}
+
+	watchdog.Beat(start.Add(2 * time.Second))
+	if watchdog.Check(start.Add(2*time.Second+10*time.Millisecond)) || watchdog.Tripped() {
+		t.Fatal("did not recover once frames resumed")
+	}
+	if !watchdog.Since().Equal(start.Add(2*time.Second + 10*time.Millisecond)) {
+		t.Errorf("since %v after recovering", watchdog.Since())
+	}
+}
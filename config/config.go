@@ -13,6 +13,12 @@ import (
 func GetConfig() Config {
 	cfg := Config{
 		AppCfg:               GetAppConfig(),
+		APICfg:               GetAPIConfig(),
+		RecorderCfg:          GetRecorderConfig(),
+		ArmingCfg:            GetArmingConfig(),
+		EStopCfg:             GetEStopConfig(),
+		TrainerCfg:           GetTrainerConfig(),
+		GyroCfg:              GetGyroConfig(),
 		ControllerManagerCfg: GetControllerManagerConfig(),
 		SbusCfgs:             GetSBusConfigs(),
 		CRSFCfgs:             GetCRSFConfigs(),
@@ -30,14 +36,99 @@ func GetAppConfig() AppConfig {
 		invertOutputs[i] = GetBoolEnv(varName, DefaultInvertOutputs[i])
 	}
 
+	mergePolicies := make([]string, sbus.MaxChannels)
+	for i := range mergePolicies {
+		mergePolicies[i] = GetStringEnv(fmt.Sprintf("MERGE_%d", i), DefaultMergePolicies[i])
+	}
+
 	return AppConfig{
-		UpdateRate:    AppUpdateRate, // value in milliseconds
-		InvertOutputs: invertOutputs,
+		UpdateRate:          AppUpdateRate, // value in milliseconds
+		InvertOutputs:       invertOutputs,
+		MergePolicies:       mergePolicies,
+		StateDir:            GetStringEnv("STATE_DIR", DefaultStateDir),
+		ShutdownNeutralTime: GetIntEnv("SHUTDOWN_NEUTRAL_TIME", DefaultShutdownNeutralTime),
+		ShutdownTimeout:     GetIntEnv("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout),
+		WatchdogTimeout:     GetIntEnv("WATCHDOG_TIMEOUT", DefaultWatchdogTimeout),
+	}
+}
+
+func GetAPIConfig() APIConfig {
+	return APIConfig{
+		Enabled:  GetBoolEnv("API_ENABLED", DefaultAPIEnabled),
+		Address:  GetStringEnv("API_ADDRESS", DefaultAPIAddress),
+		PushRate: GetIntEnv("API_PUSH_RATE", DefaultAPIPushRate),
+		Token:    GetPathEnv("API_TOKEN", ""), //case sensitive like a path
+	}
+}
+
+func GetRecorderConfig() RecorderConfig {
+	return RecorderConfig{
+		Enabled:     GetBoolEnv("RECORDER_ENABLED", DefaultRecorderEnabled),
+		Dir:         GetStringEnv("RECORDER_DIR", DefaultRecorderDir),
+		MaxFileSize: GetIntEnv("RECORDER_MAX_FILE_MB", DefaultRecorderMaxFileSize),
+		MaxFiles:    GetIntEnv("RECORDER_MAX_FILES", DefaultRecorderMaxFiles),
+	}
+}
+
+func GetArmingConfig() ArmingConfig {
+	return ArmingConfig{
+		Enabled:       GetBoolEnv("ARMING_ENABLED", DefaultArmingEnabled),
+		ArmButton:     GetStringEnv("ARM_BUTTON", DefaultArmButton),
+		ArmHold:       GetIntEnv("ARM_HOLD", DefaultArmHold),
+		KillButton:    GetStringEnv("KILL_BUTTON", DefaultKillButton),
+		CenterRange:   GetIntEnv("ARM_CENTER_RANGE", DefaultArmCenterRange),
+		ThrottleRange: GetIntEnv("ARM_THROTTLE_RANGE", DefaultArmThrottleRange),
+		SourceTimeout: GetIntEnv("ARM_SOURCE_TIMEOUT", DefaultArmSourceTimeout),
+	}
+}
+
+func GetEStopConfig() EStopConfig {
+	return EStopConfig{
+		Button:      GetStringEnv("ESTOP_BUTTON", DefaultEStopButton),
+		Device:      GetPathEnv("ESTOP_DEVICE", DefaultEStopDevice),
+		ResetButton: GetStringEnv("ESTOP_RESET_BUTTON", DefaultEStopResetButton),
+		ResetHold:   GetIntEnv("ESTOP_RESET_HOLD", DefaultEStopResetHold),
+	}
+}
+
+func GetTrainerConfig() TrainerConfig {
+	return TrainerConfig{
+		Enabled:            GetBoolEnv("TRAINER_ENABLED", DefaultTrainerEnabled),
+		Instructor:         GetStringEnv("TRAINER_INSTRUCTOR", DefaultTrainerInstructor),
+		Device:             GetPathEnv("TRAINER_DEVICE", DefaultTrainerDevice),
+		TakeoverButton:     GetStringEnv("TRAINER_TAKEOVER_BUTTON", DefaultTrainerTakeoverButton),
+		TakeoverChannel:    GetIntEnv("TRAINER_TAKEOVER_CHANNEL", DefaultTrainerTakeoverChannel),
+		TakeoverLatch:      GetBoolEnv("TRAINER_TAKEOVER_LATCH", DefaultTrainerTakeoverLatch),
+		InstructorChannels: GetChannelsEnv("TRAINER_INSTRUCTOR_CHANNELS", DefaultTrainerInstructorChannels),
+		StudentThrottle:    GetIntEnv("TRAINER_STUDENT_THROTTLE", DefaultTrainerStudentThrottle),
+	}
+}
+
+func GetGyroConfig() GyroConfig {
+	return GyroConfig{
+		Enabled:       GetBoolEnv("GYRO_ENABLED", DefaultGyroEnabled),
+		Mode:          GetStringEnv("GYRO_MODE", DefaultGyroMode),
+		Port:          GetIntEnv("GYRO_PORT", DefaultGyroPort),
+		RateGain:      GetFloatEnv("GYRO_RATE_GAIN", DefaultGyroRateGain),
+		HeadingGain:   GetFloatEnv("GYRO_HEADING_GAIN", DefaultGyroHeadingGain),
+		MaxCorrection: GetIntEnv("GYRO_MAX_CORRECTION", DefaultGyroMaxCorrection),
+		SteerDeadband: GetIntEnv("GYRO_STEER_DEADBAND", DefaultGyroSteerDeadband),
+		Timeout:       GetIntEnv("GYRO_TIMEOUT", DefaultGyroTimeout),
+		Reverse:       GetBoolEnv("GYRO_REVERSE", DefaultGyroReverse),
 	}
 }
 
 func GetControllerManagerConfig() ControllerManagerConfig {
-	return ControllerManagerConfig{}
+	inputMergePolicies := make(map[string]string, len(InputMergeLabels))
+	for _, label := range InputMergeLabels {
+		value := GetStringEnv("INPUT_MERGE_"+strings.ToUpper(label), "")
+		if value != "" {
+			inputMergePolicies[label] = value
+		}
+	}
+	return ControllerManagerConfig{
+		InputMergePolicies: inputMergePolicies,
+	}
 }
 
 func GetCRSFConfigs() []CRSFConfig {
@@ -50,7 +141,11 @@ func GetCRSFConfigs() []CRSFConfig {
 
 func GetCRSFConfig(portNum int) CRSFConfig {
 	return CRSFConfig{
-		CRSFPath: GetStringEnv(fmt.Sprintf("%d_CRSFPATH", portNum), DefaultCRSFPaths[portNum]),
+		CRSFPath:           GetStringEnv(fmt.Sprintf("%d_CRSFPATH", portNum), DefaultCRSFPaths[portNum]),
+		CRSFType:           GetStringEnv(fmt.Sprintf("%d_CRSFTYPE", portNum), DefaultCRSFTypes[portNum]),
+		CRSFChannels:       GetChannelsEnv(fmt.Sprintf("%d_CRSFCHANNELS", portNum), DefaultCRSFChannels[portNum]),
+		CRSFRemap:          GetStringEnv(fmt.Sprintf("%d_CRSFREMAP", portNum), DefaultCRSFRemaps[portNum]),
+		CRSFMinLinkQuality: GetIntEnv(fmt.Sprintf("%d_CRSFMINLQ", portNum), DefaultCRSFMinLinkQuality),
 	}
 }
 
@@ -81,5 +176,7 @@ func GetSBusConfig(portNum int) SBusConfig {
 		SBusRx:       GetBoolEnv(fmt.Sprintf("%d_SBUSRX", portNum), DefaultSBusRx[portNum]),
 		SBusTx:       GetBoolEnv(fmt.Sprintf("%d_SBUSTX", portNum), DefaultSBusTx[portNum]),
 		SBusChannels: intChannels,
+		SBus2Slots:   GetStringEnv(fmt.Sprintf("%d_SBUS2SLOTS", portNum), DefaultSBus2Slots[portNum]),
+		SBusRemap:    GetStringEnv(fmt.Sprintf("%d_SBUSREMAP", portNum), DefaultSBusRemaps[portNum]),
 	}
 }
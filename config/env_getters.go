@@ -5,6 +5,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/Speshl/pi_drift_wheel/sbus"
 )
 
 const (
@@ -50,6 +52,34 @@ func GetStringEnv(env string, defaultValue string) string {
 	}
 }
 
+// GetChannelsEnv reads a channel list like "0,1,4", entries that are not a channel are skipped
+func GetChannelsEnv(env string, defaultValue string) []int {
+	value := GetStringEnv(env, defaultValue)
+	channels := make([]int, 0, sbus.MaxChannels)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		channel, err := strconv.Atoi(entry)
+		if err != nil || channel < 0 || channel >= sbus.MaxChannels {
+			log.Printf("warning:%s entry %q is not a channel\n", env, entry)
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// GetPathEnv keeps the case of the value since device paths like /dev/input/by-id are case sensitive
+func GetPathEnv(env string, defaultValue string) string {
+	envValue, found := os.LookupEnv(AppEnvBase + env)
+	if !found {
+		return defaultValue
+	}
+	return strings.Trim(envValue, "\r")
+}
+
 func GetFloatEnv(env string, defaultValue float64) float64 {
 	envValue, found := os.LookupEnv(AppEnvBase + env)
 	if !found {
@@ -5,6 +5,55 @@ const (
 	MaxSbus       = 2
 	MaxCRSF       = 2
 	AppUpdateRate = 6
+
+	DefaultStateDir = "/var/lib/pi_drift_wheel" //profiles and other settings that survive a restart
+
+	DefaultShutdownNeutralTime = 500  //milliseconds of failsafe frames sent on every tx port when stopping
+	DefaultShutdownTimeout     = 3000 //milliseconds to wait for everything to stop before giving up
+	DefaultWatchdogTimeout     = 50   //milliseconds without a new output frame before outputs go to failsafe
+
+	DefaultAPIEnabled  = true
+	DefaultAPIAddress  = "127.0.0.1:8080" //use 0.0.0.0:8080 to reach it from other devices
+	DefaultAPIPushRate = 100              //websocket update period in milliseconds
+
+	DefaultRecorderEnabled     = true
+	DefaultRecorderDir         = "/var/lib/pi_drift_wheel/sessions"
+	DefaultRecorderMaxFileSize = 64 //megabytes before starting a new session log
+	DefaultRecorderMaxFiles    = 20 //oldest session logs are removed past this
+
+	DefaultArmingEnabled    = true
+	DefaultArmButton        = "red3" //held to arm, a button label from the controller key maps
+	DefaultArmHold          = 1000   //milliseconds the arm button must be held
+	DefaultKillButton       = "red4" //disarms immediately
+	DefaultArmCenterRange   = 60     //sbus steps steer and esc may be from center when arming
+	DefaultArmThrottleRange = 5      //percent of travel the throttle may be pressed when arming
+	DefaultArmSourceTimeout = 250    //milliseconds without a control frame before disarming
+
+	DefaultEStopButton      = ""         //button label that latches the e-stop, empty for none
+	DefaultEStopDevice      = ""         //input device name or /dev/input/event path where any key latches the e-stop
+	DefaultEStopResetButton = "b/circle" //held to release the e-stop
+	DefaultEStopResetHold   = 2000       //milliseconds the reset button must be held
+
+	DefaultCRSFMinLinkQuality = 30 //uplink quality percent below which a control crsf port counts as lost
+
+	DefaultTrainerEnabled            = false
+	DefaultTrainerInstructor         = "sbus1" //an sbus or crsf source name, or controller to use the wheel at TRAINER_DEVICE
+	DefaultTrainerDevice             = ""      //instructor wheel by /dev/input path or name
+	DefaultTrainerTakeoverButton     = "red1"  //button on the instructor wheel that takes over
+	DefaultTrainerTakeoverChannel    = 4       //channel on the instructor radio that takes over when its switch is high
+	DefaultTrainerTakeoverLatch      = false   //when true each press toggles takeover instead of holding it
+	DefaultTrainerInstructorChannels = ""      //channels the instructor always drives, like "1" to own the throttle
+	DefaultTrainerStudentThrottle    = 100     //percent of forward throttle the student gets
+
+	DefaultGyroEnabled       = false
+	DefaultGyroMode          = "rate" //rate damps yaw, heading also holds the heading while the wheel is centered
+	DefaultGyroPort          = 0      //crsf port the attitude telemetry comes in on
+	DefaultGyroRateGain      = 2.0    //sbus steps of counter steer per degree per second at full gain
+	DefaultGyroHeadingGain   = 8.0    //sbus steps of counter steer per degree off the held heading at full gain
+	DefaultGyroMaxCorrection = 400    //most the gyro moves the steer channel, in sbus steps
+	DefaultGyroSteerDeadband = 30     //steer steps from mid that count as centered for heading hold
+	DefaultGyroTimeout       = 250    //milliseconds without attitude before the gyro turns off
+	DefaultGyroReverse       = false  //for an imu mounted so yaw increases turning left
 )
 
 var (
@@ -13,6 +62,22 @@ var (
 		"",
 	}
 
+	DefaultCRSFTypes = []string{ //control for an elrs receiver wired to the pi
+		"telemetry",
+		"telemetry",
+	}
+
+	DefaultCRSFChannels = []string{
+		"",
+		"",
+	}
+
+	//see sbus.ParseRemap, empty passes CRSFChannels through unchanged
+	DefaultCRSFRemaps = []string{
+		"",
+		"",
+	}
+
 	DefaultSBusPaths = []string{
 		"/dev/ttyAMA0",
 		"",
@@ -38,6 +103,40 @@ var (
 		"",
 	}
 
+	//see sbus.ParseRemap, empty passes SBusChannels through unchanged
+	DefaultSBusRemaps = []string{
+		"",
+		"",
+	}
+
+	DefaultSBus2Slots = []string{
+		"voltage:1,temp:3,rpm:4,gps:8",
+		"voltage:1,temp:3,rpm:4,gps:8",
+	}
+
+	//controller inputs that can be given a merge policy with INPUT_MERGE_<LABEL>
+	InputMergeLabels = []string{"steer", "throttle", "brake", "clutch", "handbrake"}
+
+	//per output channel merge policy, see app.ParseMergePolicy. Empty is furthest from mid over every source
+	DefaultMergePolicies = []string{
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+	}
+
 	DefaultInvertOutputs = []bool{
 		false,
 		false,
@@ -60,17 +159,83 @@ var (
 
 type Config struct {
 	AppCfg               AppConfig
+	APICfg               APIConfig
+	RecorderCfg          RecorderConfig
+	ArmingCfg            ArmingConfig
+	EStopCfg             EStopConfig
+	TrainerCfg           TrainerConfig
+	GyroCfg              GyroConfig
 	ControllerManagerCfg ControllerManagerConfig
 	SbusCfgs             []SBusConfig
 	CRSFCfgs             []CRSFConfig
 }
 
 type AppConfig struct {
-	UpdateRate    int
-	InvertOutputs []bool
+	UpdateRate          int
+	InvertOutputs       []bool
+	MergePolicies       []string
+	StateDir            string
+	ShutdownNeutralTime int // value in milliseconds
+	ShutdownTimeout     int // value in milliseconds
+	WatchdogTimeout     int // value in milliseconds
+}
+
+type APIConfig struct {
+	Enabled  bool
+	Address  string
+	PushRate int    // value in milliseconds
+	Token    string //required on requests that change settings when set, empty allows any same origin request
+}
+
+type ArmingConfig struct {
+	Enabled       bool //when false outputs are live from start up like before arming existed
+	ArmButton     string
+	ArmHold       int // value in milliseconds
+	KillButton    string
+	CenterRange   int
+	ThrottleRange int
+	SourceTimeout int // value in milliseconds
+}
+
+type EStopConfig struct {
+	Button      string
+	Device      string
+	ResetButton string
+	ResetHold   int // value in milliseconds
+}
+
+type TrainerConfig struct {
+	Enabled            bool
+	Instructor         string
+	Device             string
+	TakeoverButton     string
+	TakeoverChannel    int
+	TakeoverLatch      bool
+	InstructorChannels []int
+	StudentThrottle    int // percent
+}
+
+type GyroConfig struct {
+	Enabled       bool
+	Mode          string
+	Port          int
+	RateGain      float64
+	HeadingGain   float64
+	MaxCorrection int
+	SteerDeadband int
+	Timeout       int // value in milliseconds
+	Reverse       bool
+}
+
+type RecorderConfig struct {
+	Enabled     bool
+	Dir         string
+	MaxFileSize int // value in megabytes
+	MaxFiles    int
 }
 
 type ControllerManagerConfig struct {
+	InputMergePolicies map[string]string //per input label, see app.ParseInputMergePolicies. Missing labels merge furthest from rest
 }
 
 type SBusConfig struct {
@@ -79,8 +244,14 @@ type SBusConfig struct {
 	SBusRx       bool
 	SBusTx       bool
 	SBusChannels []int
+	SBus2Slots   string //sensor kind:first slot list for sbus2 telemetry receivers
+	SBusRemap    string //in>out channel table, replaces SBusChannels when set
 }
 
 type CRSFConfig struct {
-	CRSFPath string
+	CRSFPath           string
+	CRSFType           string //control ports deliver channels, telemetry ports only telemetry
+	CRSFChannels       []int
+	CRSFRemap          string //in>out channel table, replaces CRSFChannels when set
+	CRSFMinLinkQuality int    // percent
 }
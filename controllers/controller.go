@@ -8,12 +8,19 @@ import (
 
 	"github.com/Speshl/pi_drift_wheel/controllers/models"
 	"github.com/Speshl/pi_drift_wheel/go-evdev"
+	"github.com/Speshl/pi_drift_wheel/metrics"
 )
 
+// EventHook sees every raw event read from a controller, it runs on the read goroutine so keep it quick
+type EventHook func(controller string, e *evdev.InputEvent)
+
+var ErrNoDevice = fmt.Errorf("controller has no device")
+
 type Controller struct {
 	device *evdev.InputDevice
 	Name   string
 	path   string
+	source string //merge source name, unique among the loaded controllers
 	keyMap map[string]models.Mapping
 
 	ffLock      sync.RWMutex
@@ -22,6 +29,9 @@ type Controller struct {
 
 	inputLock sync.RWMutex
 	rawInputs []models.Input
+
+	eventHook EventHook
+	events    metrics.Counter
 }
 
 func NewController(inputPath evdev.InputPath, device *evdev.InputDevice, keyMap map[string]models.Mapping) *Controller {
@@ -37,36 +47,58 @@ func NewController(inputPath evdev.InputPath, device *evdev.InputDevice, keyMap
 		Name:      inputPath.Name,
 		path:      inputPath.Path,
 		rawInputs: rawInputs,
+		events:    metrics.ControllerEvents.With(inputPath.Name),
 	}
 }
 
 func NewInput(keyMap models.Mapping) models.Input {
-	value := 0
-	switch keyMap.Rests {
-	case "high":
-		value = keyMap.Max
-	case "middle":
-		value = (keyMap.Max + keyMap.Min) / 2
-	case "low":
-		fallthrough
-	default:
-		value = keyMap.Min
-	}
-
 	return models.Input{
-		Value: value,
+		Value: restValue(keyMap.Rests, keyMap.Min, keyMap.Max),
 		Min:   keyMap.Min,
 		Max:   keyMap.Max,
 		Rests: keyMap.Rests,
+		Label: keyMap.Label,
+	}
+}
+
+func restValue(rests string, min int, max int) int {
+	switch rests {
+	case "high":
+		return max
+	case "middle":
+		return (max + min) / 2
+	default:
+		return min
 	}
 }
 
+// NewVirtualController has no device behind it, events are fed in with ApplyEvent. Used for replays and tests
+func NewVirtualController(name string, keyMap map[string]models.Mapping) *Controller {
+	return NewController(evdev.InputPath{Name: name}, nil, keyMap)
+}
+
 func (c *Controller) Sync() error {
+	e, err := c.ReadOne()
+	if err != nil {
+		return err
+	}
+	c.ApplyEvent(e)
+	return nil
+}
 
+func (c *Controller) ReadOne() (*evdev.InputEvent, error) {
+	if c.device == nil {
+		return nil, ErrNoDevice
+	}
 	e, err := c.device.ReadOne()
 	if err != nil {
-		return fmt.Errorf("failed reading from device: %w", err)
+		return nil, fmt.Errorf("failed reading from device: %w", err)
 	}
+	return e, nil
+}
+
+// ApplyEvent updates the raw inputs from a single device event
+func (c *Controller) ApplyEvent(e *evdev.InputEvent) {
 	// c.ffLock.Lock()
 	// ffLevel := c.ffLevel
 	// c.ffLock.Unlock()
@@ -79,22 +111,20 @@ func (c *Controller) Sync() error {
 	// 	c.lastFFLevel = ffLevel
 	// }
 
+	c.events.Inc()
+	if c.eventHook != nil {
+		c.eventHook(c.Name, e)
+	}
 	slog.Debug("event", "type", e.Type, "code", e.Code, "code_name", e.CodeName(), "value", e.Value)
 	mapping, ok := c.keyMap[fmt.Sprintf("%d:%d", e.Type, e.Code)]
 	if ok {
-		name, _ := c.device.Name()
+		name := c.Name //device name the controller was loaded with
 		slog.Debug("mapped event", "label", mapping.Label, "type", e.Type, "code", e.Code, "code_name", e.CodeName(), "value", e.Value, "device", name, "controller", c.Name)
 		updatedValue := int(e.Value)
 		if mapping.Inverted {
 			updatedValue = mapping.Max - updatedValue + mapping.Min
 		}
 
-		if mapping.Label == "handbrake" && name == "G27 Racing Wheel" {
-			slog.Warn("handbrake on g27!!!")
-		} else if mapping.Label == "handbrake" {
-			slog.Debug("got handbrake event", "device", name, "controller", c.Name)
-		}
-
 		//update raw input
 		c.inputLock.Lock()
 		c.rawInputs[mapping.RawInput] = models.Input{
@@ -106,7 +136,11 @@ func (c *Controller) Sync() error {
 		}
 		c.inputLock.Unlock()
 	}
-	return nil
+}
+
+// Source is the name merge policies use for this controller, see SourceName
+func (c *Controller) Source() string {
+	return c.source
 }
 
 func (c *Controller) GetRawInputs() []models.Input {
@@ -118,6 +152,9 @@ func (c *Controller) GetRawInputs() []models.Input {
 }
 
 func (c *Controller) ShowCaps() {
+	if c.device == nil {
+		return
+	}
 	for _, t := range c.device.CapableTypes() {
 		log.Printf("  Event type %d (%s)\n", t, evdev.TypeName(t))
 
@@ -157,14 +194,43 @@ func (c *Controller) ShowCaps() {
 }
 
 func (c *Controller) SetForceFeedback(level int16) error {
+	if c.device == nil {
+		return ErrNoDevice
+	}
 	// c.ffLock.Lock()
 	// defer c.ffLock.Unlock()
 	err := c.device.UploadEffect(level)
 	if err != nil {
+		metrics.FFUploads.With(c.Name, "error").Inc()
 		return err
 	}
+	metrics.FFUploads.With(c.Name, "ok").Inc()
 
 	// c.ffLevel = level
 
 	return nil
 }
+
+// StopForceFeedback stops and erases the uploaded effect so the wheel goes slack
+func (c *Controller) StopForceFeedback() error {
+	if c.device == nil {
+		return nil
+	}
+	err := c.device.StopEffect()
+	if err != nil {
+		return fmt.Errorf("failed stopping ff on %s: %w", c.Name, err)
+	}
+	err = c.device.EraseEffect()
+	if err != nil {
+		return fmt.Errorf("failed erasing ff on %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// Close releases the device, a blocked read returns an error
+func (c *Controller) Close() error {
+	if c.device == nil {
+		return nil
+	}
+	return c.device.Close()
+}
@@ -2,8 +2,13 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/Speshl/pi_drift_wheel/config"
 	"github.com/Speshl/pi_drift_wheel/controllers/g27"
@@ -20,10 +25,25 @@ const (
 	MaxControllers = 128
 )
 
+// InputSource is one controller's reading of an input, Name is the controller's merge source name
+type InputSource struct {
+	Name  string
+	Input models.Input
+}
+
+// InputMerge picks which source's reading of a labeled input the mixer uses, returning its index or -1 to leave the input at rest
+type InputMerge func(label string, sources []InputSource) int
+
 type ControllerManager struct {
 	Controllers []*Controller
 	mixer       models.Mixer
 	mixState    models.MixState
+	lastInputs  []models.Input //inputs used for the last mix
+	eventHook   EventHook
+	inputMerge  InputMerge //nil merges every input furthest from rest
+
+	instructor      *Controller //mixed on its own for trainer mode, nil when not set
+	instructorState models.MixState
 
 	models.ControllerOptions
 }
@@ -118,11 +138,47 @@ func (c *ControllerManager) LoadControllers() error {
 
 		controller := NewController(inputPath, device, keyMap)
 		controller.ShowCaps()
-		c.Controllers = append(c.Controllers, controller)
+		c.addController(controller)
 	}
 	return nil
 }
 
+// AddVirtualController adds a controller for a supported device name without opening a device
+func (c *ControllerManager) AddVirtualController(name string) (*Controller, error) {
+	keyMap, err := c.GetKeyMap(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting keymap for %s: %w", name, err)
+	}
+	controller := NewVirtualController(name, keyMap)
+	c.addController(controller)
+	return controller, nil
+}
+
+// addController names the controller as a merge source, a second controller of the same model gets a number
+func (c *ControllerManager) addController(controller *Controller) {
+	base := SourceName(controller.Name)
+	controller.source = base
+	for n := 2; slices.ContainsFunc(c.Controllers, func(loaded *Controller) bool { return loaded.source == controller.source }); n++ {
+		controller.source = fmt.Sprintf("%s%d", base, n)
+	}
+	controller.eventHook = c.eventHook
+	c.Controllers = append(c.Controllers, controller)
+}
+
+// SourceName is how merge policies name a controller model, like g27_racing_wheel
+func SourceName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+}
+
+// SourceNames are the merge source names of the loaded controllers, in load order
+func (c *ControllerManager) SourceNames() []string {
+	names := make([]string, len(c.Controllers))
+	for i := range c.Controllers {
+		names[i] = c.Controllers[i].source
+	}
+	return names
+}
+
 func (c *ControllerManager) isSupported(name string) bool {
 	_, err := c.GetKeyMap(name)
 	if err != nil {
@@ -135,6 +191,38 @@ func (c *ControllerManager) GetMixState() models.MixState {
 	return c.mixState
 }
 
+// GetInputs returns the merged raw inputs from the last mix
+func (c *ControllerManager) GetInputs() []models.Input {
+	returnSlice := make([]models.Input, len(c.lastInputs))
+	copy(returnSlice, c.lastInputs)
+	return returnSlice
+}
+
+// SetEventHook is called with every raw event from every controller, set it before Start
+func (c *ControllerManager) SetEventHook(hook EventHook) {
+	c.eventHook = hook
+	for i := range c.Controllers {
+		c.Controllers[i].eventHook = hook
+	}
+}
+
+// SetInputMerge sets how each input is picked when more than one controller is loaded
+func (c *ControllerManager) SetInputMerge(merge InputMerge) {
+	c.inputMerge = merge
+}
+
+func (c *ControllerManager) SetOptions(opts models.ControllerOptions) {
+	c.ControllerOptions = opts
+}
+
+// SetTrims replaces the mixer trims, the mixer keeps trims set before its first mix
+func (c *ControllerManager) SetTrims(trims map[string]int) {
+	c.mixState.Trims = make(map[string]int, 10)
+	for name, value := range trims {
+		c.mixState.Trims[name] = value
+	}
+}
+
 func (c *ControllerManager) GetKeyMap(name string) (map[string]models.Mapping, error) {
 	switch name {
 	case "G27 Racing Wheel":
@@ -148,33 +236,141 @@ func (c *ControllerManager) GetKeyMap(name string) (map[string]models.Mapping, e
 }
 
 func (c *ControllerManager) SetForceFeedback(level int16) error {
-	err := c.Controllers[0].SetForceFeedback(level)
-	if err != nil {
-		return err
+	for i := range c.Controllers {
+		if c.Controllers[i] != c.instructor { //feedback is for the student's wheel
+			return c.Controllers[i].SetForceFeedback(level)
+		}
+	}
+	return ErrNoDevice
+}
+
+// StopForceFeedback releases force feedback on every controller
+func (c *ControllerManager) StopForceFeedback() error {
+	var errs []error
+	for i := range c.Controllers {
+		errs = append(errs, c.Controllers[i].StopForceFeedback())
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases every controller device, call once Start has returned
+func (c *ControllerManager) Close() error {
+	var errs []error
+	for i := range c.Controllers {
+		errs = append(errs, c.Controllers[i].Close())
 	}
-	return err
+	return errors.Join(errs...)
 }
 
+// GetMixedFrame merges the raw inputs of every controller except the instructor, picking each input with the
+// input merge, then runs the mixer once. The wheel, pedals and handbrake share one gear and esc state so they
+// are merged before the mixer rather than as separate mixed frames
 func (c *ControllerManager) GetMixedFrame() (sbus.SBusFrame, error) {
 	if len(c.Controllers) == 0 {
 		return sbus.NewSBusFrame(), fmt.Errorf("no controllers loaded")
 	}
+	if c.mixer == nil {
+		return sbus.NewSBusFrame(), fmt.Errorf("no mixer loaded")
+	}
 
-	mixedInputs := c.Controllers[0].GetRawInputs()
-
-	for i := 1; i < len(c.Controllers); i++ {
-		inputs := c.Controllers[i].GetRawInputs()
-		for j := range inputs {
-			currInputChange := models.GetScaledInputChange(mixedInputs[j])
-			newInputChange := models.GetScaledInputChange(inputs[j])
+	mixed := make([]*Controller, 0, len(c.Controllers))
+	inputs := make([][]models.Input, 0, len(c.Controllers))
+	for i := range c.Controllers {
+		if c.Controllers[i] == c.instructor {
+			continue
+		}
+		mixed = append(mixed, c.Controllers[i])
+		inputs = append(inputs, c.Controllers[i].GetRawInputs())
+	}
+	if len(mixed) == 0 {
+		return sbus.NewSBusFrame(), fmt.Errorf("no controllers loaded besides the instructor")
+	}
 
-			if newInputChange > currInputChange {
-				mixedInputs[j] = inputs[j]
-			}
+	mixedInputs := inputs[0]
+	if len(mixed) > 1 {
+		for j := range mixedInputs {
+			mixedInputs[j] = c.mergeInput(j, mixed, inputs)
 		}
 	}
 
+	c.lastInputs = make([]models.Input, len(mixedInputs))
+	copy(c.lastInputs, mixedInputs)
+
 	frame, state := c.mixer(mixedInputs, c.mixState, c.ControllerOptions)
 	c.mixState = state
 	return frame, nil
 }
+
+// mergeInput picks one controller's reading of an input. Controllers whose key map does not have the input are left out
+func (c *ControllerManager) mergeInput(index int, mixed []*Controller, inputs [][]models.Input) models.Input {
+	if c.inputMerge == nil {
+		merged := inputs[0][index]
+		for i := 1; i < len(inputs); i++ {
+			if models.GetScaledInputChange(inputs[i][index]) > models.GetScaledInputChange(merged) {
+				merged = inputs[i][index]
+			}
+		}
+		return merged
+	}
+
+	sources := make([]InputSource, 0, len(mixed))
+	for i := range mixed {
+		input := inputs[i][index]
+		if input.Min == 0 && input.Max == 0 {
+			continue //not mapped on this controller
+		}
+		sources = append(sources, InputSource{Name: mixed[i].source, Input: input})
+	}
+	if len(sources) == 0 {
+		return inputs[0][index]
+	}
+	winner := c.inputMerge(sources[0].Input.Label, sources)
+	if winner < 0 || winner >= len(sources) {
+		rest := sources[0].Input
+		rest.Value = restValue(rest.Rests, rest.Min, rest.Max)
+		return rest
+	}
+	return sources[winner].Input
+}
+
+// SetInstructor keeps a controller out of the mix so it can be mixed on its own with GetInstructorFrame.
+// Match by /dev/input path, including by-id links, to tell apart two of the same wheel
+func (c *ControllerManager) SetInstructor(nameOrPath string) error {
+	path, err := filepath.EvalSymlinks(nameOrPath)
+	if err != nil {
+		path = nameOrPath
+	}
+	for i := range c.Controllers {
+		if c.Controllers[i].path != "" && c.Controllers[i].path == path {
+			c.instructor = c.Controllers[i]
+			return nil
+		}
+	}
+	for i := range c.Controllers {
+		if strings.EqualFold(c.Controllers[i].Name, nameOrPath) { //env values are lower cased
+			c.instructor = c.Controllers[i]
+			return nil
+		}
+	}
+	return fmt.Errorf("no controller %s", nameOrPath)
+}
+
+// GetInstructorFrame mixes the instructor controller with its own gears and esc state but the car's trims
+func (c *ControllerManager) GetInstructorFrame() (sbus.SBusFrame, []models.Input, error) {
+	if c.instructor == nil {
+		return sbus.NewSBusFrame(), nil, fmt.Errorf("no instructor controller")
+	}
+	if c.mixer == nil {
+		return sbus.NewSBusFrame(), nil, fmt.Errorf("no mixer loaded")
+	}
+
+	inputs := c.instructor.GetRawInputs()
+	trims := maps.Clone(c.mixState.Trims) //trim buttons on the instructor wheel do not stick
+	if trims == nil {
+		trims = make(map[string]int, 10)
+	}
+	c.instructorState.Trims = trims
+	frame, state := c.mixer(inputs, c.instructorState, c.ControllerOptions)
+	c.instructorState = state
+	return frame, c.instructor.GetRawInputs(), nil
+}
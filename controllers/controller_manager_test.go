@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/go-evdev"
+)
+
+func TestInstructorMixedOnItsOwn(t *testing.T) {
+	manager := NewControllerManager(config.ControllerManagerConfig{}, models.ControllerOptions{})
+	student, err := manager.AddVirtualController("G27 Racing Wheel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instructor, err := manager.AddVirtualController("G27 Racing Wheel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.instructor = instructor //virtual controllers have no path to match on
+
+	instructor.ApplyEvent(&evdev.InputEvent{Type: evdev.EV_ABS, Code: evdev.ABS_X, Value: 0}) //full lock left
+	studentFrame, err := manager.GetMixedFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	instructorFrame, _, err := manager.GetInstructorFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if studentFrame.Frame.Ch[0] == instructorFrame.Frame.Ch[0] {
+		t.Errorf("instructor steering %d reached the student mix", instructorFrame.Frame.Ch[0])
+	}
+
+	manager.instructor = student
+	manager.Controllers = manager.Controllers[:1]
+	if _, err := manager.GetMixedFrame(); err == nil {
+		t.Error("mixed with only the instructor loaded")
+	}
+}
@@ -0,0 +1,142 @@
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/controllers/uinput"
+	"github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// Runs virtual devices through the same load, read, mix and ff path as the real hardware
+func TestVirtualWheelEndToEnd(t *testing.T) {
+	if !uinput.Available() {
+		t.Skip("/dev/uinput not available")
+	}
+
+	wheel, err := uinput.NewG27()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wheel.Close()
+	handbrake, err := uinput.NewHandbrake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handbrake.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	go wheel.ServeFF(ctx)
+
+	for _, device := range []*uinput.Device{wheel, handbrake} {
+		err = device.WaitReady(5 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := controllers.NewControllerManager(config.ControllerManagerConfig{}, models.ControllerOptions{})
+	err = manager.LoadControllers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wheelController *controllers.Controller
+	loaded := make(map[string]bool, 2)
+	for _, controller := range manager.Controllers {
+		loaded[controller.Name] = true
+		if controller.Name == uinput.G27Name {
+			wheelController = controller
+		}
+	}
+	if !loaded[uinput.G27Name] || !loaded[uinput.HandbrakeName] {
+		t.Fatalf("virtual devices not loaded: %v", loaded)
+	}
+	go manager.Start(ctx)
+
+	tests := []struct {
+		name    string
+		device  *uinput.Device
+		steps   []uinput.Step
+		channel int
+		check   func(uint16) bool
+	}{
+		{
+			name:    "steer right",
+			device:  wheel,
+			steps:   []uinput.Step{{Label: "steer", Value: 16383}},
+			channel: 0,
+			check:   func(v uint16) bool { return int(v) > sbus.MaxValue-20 },
+		},
+		{
+			name:    "steer left",
+			device:  wheel,
+			steps:   []uinput.Step{{Label: "steer", Value: 8000}, {Label: "steer", Value: 0, Delay: 10 * time.Millisecond}},
+			channel: 0,
+			check:   func(v uint16) bool { return int(v) < sbus.MinValue+20 },
+		},
+		{
+			name:    "handbrake pulls esc below neutral",
+			device:  handbrake,
+			steps:   []uinput.Step{{Label: "handbrake", Value: 127}},
+			channel: 1,
+			check:   func(v uint16) bool { return int(v) < sbus.MidValue },
+		},
+	}
+	for _, tc := range tests {
+		err = tc.device.Play(ctx, tc.steps)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		var value uint16
+		ok := waitFor(func() bool {
+			frame, err := manager.GetMixedFrame()
+			if err != nil {
+				return false
+			}
+			value = frame.Frame.Ch[tc.channel]
+			return tc.check(value)
+		})
+		if !ok {
+			t.Errorf("%s: channel %d ended at %d", tc.name, tc.channel, value)
+		}
+	}
+
+	err = wheelController.SetForceFeedback(-12000)
+	if err != nil {
+		t.Fatalf("failed uploading ff: %s", err)
+	}
+	ok := waitFor(func() bool {
+		levels := wheel.FFLevels()
+		return len(levels) > 0 && levels[len(levels)-1] == -12000 && wheel.FFPlaying()
+	})
+	if !ok {
+		t.Errorf("virtual wheel did not get ff level, uploaded %v playing %t", wheel.FFLevels(), wheel.FFPlaying())
+	}
+
+	err = manager.StopForceFeedback()
+	if err != nil {
+		t.Fatalf("failed stopping ff: %s", err)
+	}
+	ok = waitFor(func() bool {
+		return !wheel.FFPlaying() && wheel.FFErases() == 1
+	})
+	if !ok {
+		t.Errorf("virtual wheel ff not released, playing %t erases %d", wheel.FFPlaying(), wheel.FFErases())
+	}
+}
+
+func waitFor(check func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if check() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
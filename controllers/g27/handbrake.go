@@ -0,0 +1,81 @@
+package g27
+
+import (
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+const (
+	handbrakeInput    = 4 //raw input the handbrake is mapped to
+	handbrakeDeadzone = 3 //percent of travel ignored so a resting handbrake does not brake
+)
+
+// handbrakeTravel is how far the handbrake is pulled, 0-100. Without a handbrake loaded it is 0
+func handbrakeTravel(input models.Input) int {
+	if input.Max == input.Min {
+		return 0
+	}
+	travel := min(max(models.GetInputChangeAmount(input)*100/(input.Max-input.Min), 0), 100)
+	if travel <= handbrakeDeadzone {
+		return 0
+	}
+	return travel
+}
+
+// applyHandbrake blends the handbrake into the brake and cuts the throttle before the esc is mixed
+func applyHandbrake(inputs []models.Input, travel int, opts models.Handbrake) {
+	if travel == 0 {
+		return
+	}
+
+	blend := opts.Brake
+	if blend == 0 {
+		blend = 100
+	}
+	if blend > 0 {
+		brakeTravel := travel * min(blend, 100) / 100
+		if brakeTravel > inputTravel(inputs[2]) {
+			inputs[2] = withTravel(inputs[2], brakeTravel)
+		}
+	}
+
+	if opts.ThrottleCut {
+		inputs[1] = withTravel(inputs[1], 0)
+	}
+}
+
+// applyHandbrakeOutputs drives the rear brake channel and drops the gyro gain once the frame is built
+func applyHandbrakeOutputs(frame sbus.SBusFrame, travel int, opts models.Handbrake) sbus.SBusFrame {
+	if opts.GyroCut > 0 {
+		gain := int(frame.Frame.Ch[2]) - sbus.MinValue
+		frame.Frame.Ch[2] = uint16(sbus.MinValue + gain*(100-min(opts.GyroCut, 100)*travel/100)/100)
+	}
+	if opts.Channel > 0 && opts.Channel < sbus.MaxChannels {
+		frame.Frame.Ch[opts.Channel] = uint16(models.MapToRange(travel, 0, 100, sbus.MinValue, sbus.MaxValue))
+	}
+	return frame
+}
+
+func inputTravel(input models.Input) int {
+	if input.Max == input.Min {
+		return 0
+	}
+	return models.GetInputChangeAmount(input) * 100 / (input.Max - input.Min)
+}
+
+// withTravel moves an input to a percent of its travel from rest. An input never seen gets a 0-100 range
+func withTravel(input models.Input, percent int) models.Input {
+	if input.Max == input.Min {
+		input.Min, input.Max, input.Rests = 0, 100, "low"
+	}
+	span := input.Max - input.Min
+	switch input.Rests {
+	case "high":
+		input.Value = input.Max - span*percent/100
+	case "middle":
+		input.Value = (input.Min+input.Max)/2 + span/2*percent/100
+	default:
+		input.Value = input.Min + span*percent/100
+	}
+	return input
+}
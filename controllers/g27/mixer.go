@@ -7,15 +7,19 @@ import (
 	sbus "github.com/Speshl/pi_drift_wheel/sbus"
 )
 
-//Mapping - 0 steer, 1 esc, 2 gyro gain
+//Mapping - 0 steer, 1 esc, 2 gyro gain, optional rear brake from the handbrake
 
 func Mixer(inputs []models.Input, mixState models.MixState, opts models.ControllerOptions) (sbus.SBusFrame, models.MixState) {
 	frame := sbus.NewSBusFrame()
 
 	if mixState.IsEmpty() {
+		trims := mixState.Trims //keep any trims restored before the first mix
 		mixState = models.NewMixState()
 		mixState.Esc = "forward"
 		mixState.Gear = 0
+		for name, value := range trims {
+			mixState.Trims[name] = value
+		}
 	}
 
 	//Check for button state changes
@@ -51,10 +55,31 @@ func Mixer(inputs []models.Input, mixState models.MixState, opts models.Controll
 			if mixState.Trims["gyro_gain"] < 100 {
 				mixState.Trims["gyro_gain"]++
 			}
+		case "mid_left":
+			if mixState.Trims["steer_trim"] > -100 {
+				mixState.Trims["steer_trim"]--
+			}
+		case "mid_right":
+			if mixState.Trims["steer_trim"] < 100 {
+				mixState.Trims["steer_trim"]++
+			}
+		case "bot_left":
+			if mixState.Trims["throttle_trim"] > -100 {
+				mixState.Trims["throttle_trim"]--
+			}
+		case "bot_right":
+			if mixState.Trims["throttle_trim"] < 100 {
+				mixState.Trims["throttle_trim"]++
+			}
 		}
 	}
 
 	//Build frame values based on current state/buttons
+	inputs[0] = models.ApplyCurve(inputs[0], opts.SteerCurve)
+	inputs[1] = models.ApplyCurve(inputs[1], opts.ThrottleCurve)
+
+	handbrake := handbrakeTravel(inputs[handbrakeInput])
+	applyHandbrake(inputs, handbrake, opts.Handbrake)
 
 	//Steer Value
 	frame.Frame.Ch[0] = uint16(models.MapToRangeWithDeadzoneMid(
@@ -66,7 +91,10 @@ func Mixer(inputs []models.Input, mixState models.MixState, opts models.Controll
 		2,
 	))
 
+	frame.Frame.Ch[0] = applyTrim(frame.Frame.Ch[0], mixState.Trims["steer_trim"])
+
 	frame.Frame.Ch[1], frame.Priority, mixState = getEscValue(inputs, mixState, opts)
+	frame.Frame.Ch[1] = applyTrim(frame.Frame.Ch[1], mixState.Trims["throttle_trim"])
 
 	//Gyro Gain
 	frame.Frame.Ch[2] = uint16(models.MapToRange(
@@ -77,11 +105,24 @@ func Mixer(inputs []models.Input, mixState models.MixState, opts models.Controll
 		sbus.MaxValue,
 	))
 
-	slog.Debug("mixed frame", "gear", mixState.Gear, "esc_state", mixState.Esc, "steer", frame.Frame.Ch[0], "esc", frame.Frame.Ch[1])
+	frame = applyHandbrakeOutputs(frame, handbrake, opts.Handbrake)
+
+	slog.Debug("mixed frame", "gear", mixState.Gear, "esc_state", mixState.Esc, "steer", frame.Frame.Ch[0], "esc", frame.Frame.Ch[1], "handbrake", handbrake)
 
 	return frame, mixState
 }
 
+// Offset a channel by a subtrim, keeping it inside the sbus range
+func applyTrim(value uint16, trim int) uint16 {
+	trimmed := int(value) + trim
+	if trimmed > sbus.MaxValue {
+		return uint16(sbus.MaxValue)
+	} else if trimmed < sbus.MinValue {
+		return uint16(sbus.MinValue)
+	}
+	return uint16(trimmed)
+}
+
 func getEscValue(inputs []models.Input, mixState models.MixState, opts models.ControllerOptions) (uint16, int, models.MixState) {
 	if opts.UseHPattern {
 		return getEscValueWithHPattern(inputs, mixState)
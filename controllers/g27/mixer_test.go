@@ -0,0 +1,321 @@
+package g27
+
+import (
+	"testing"
+
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// restingInputs are the mixer inputs with every control released
+func restingInputs() []models.Input {
+	inputs := make([]models.Input, 64)
+	for _, mapping := range GetKeyMap() {
+		value := mapping.Min
+		if mapping.Rests == "middle" {
+			value = (mapping.Min + mapping.Max) / 2
+		}
+		inputs[mapping.RawInput] = models.Input{
+			Label: mapping.Label,
+			Value: value,
+			Min:   mapping.Min,
+			Max:   mapping.Max,
+			Rests: mapping.Rests,
+		}
+	}
+	return inputs
+}
+
+// pressed returns resting inputs with the given raw inputs set
+func pressed(values map[int]int) []models.Input {
+	inputs := restingInputs()
+	for rawInput, value := range values {
+		inputs[rawInput].Value = value
+	}
+	return inputs
+}
+
+func stateWith(esc string, gear int) models.MixState {
+	state := models.NewMixState()
+	state.Esc = esc
+	state.Gear = gear
+	state.Buttons["init"] = 1 //keep the mixer from resetting the state
+	return state
+}
+
+const (
+	throttle = 1
+	brake    = 2
+	first    = 10
+	sixth    = 15
+	reverse  = 19
+)
+
+func TestMixerEscWithoutGears(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs map[int]int
+		want   uint16
+	}{
+		{name: "released", inputs: nil, want: uint16(sbus.MidValue)},
+		{name: "full throttle", inputs: map[int]int{throttle: 255}, want: uint16(sbus.MaxValue)},
+		{name: "full brake", inputs: map[int]int{brake: 255}, want: uint16(sbus.MinValue)},
+		{name: "throttle inside deadband", inputs: map[int]int{throttle: 10}, want: uint16(sbus.MidValue)},
+		{name: "brake inside deadband", inputs: map[int]int{brake: 10}, want: uint16(sbus.MidValue)},
+		{name: "both equal", inputs: map[int]int{throttle: 200, brake: 200}, want: uint16(sbus.MidValue)},
+		{name: "more throttle than brake", inputs: map[int]int{throttle: 255, brake: 100}, want: uint16(sbus.MaxValue)},
+		{name: "more brake than throttle", inputs: map[int]int{throttle: 100, brake: 255}, want: uint16(sbus.MinValue)},
+	}
+	for _, tc := range tests {
+		frame, state := Mixer(pressed(tc.inputs), stateWith("forward", 0), models.ControllerOptions{})
+		if frame.Frame.Ch[1] != tc.want {
+			t.Errorf("%s: esc got %d want %d", tc.name, frame.Frame.Ch[1], tc.want)
+		}
+		if frame.Priority != 0 || state.Esc != "forward" {
+			t.Errorf("%s: priority %d esc state %s changed without gears", tc.name, frame.Priority, state.Esc)
+		}
+	}
+}
+
+func TestMixerEscWithHPattern(t *testing.T) {
+	mid := uint16(sbus.MidValue)
+	tests := []struct {
+		name         string
+		esc          string
+		inputs       map[int]int
+		wantEsc      uint16
+		wantPriority int
+		wantState    string
+		wantGear     int
+	}{
+		//neutral
+		{name: "no gear", esc: "forward", inputs: map[int]int{throttle: 255}, wantEsc: mid, wantState: "forward", wantGear: 0},
+		{name: "unsupported gear", esc: "forward", inputs: map[int]int{16: 1, throttle: 255}, wantEsc: mid, wantState: "forward", wantGear: 0},
+
+		//forward gears
+		{name: "first full throttle", esc: "forward", inputs: map[int]int{first: 1, throttle: 255}, wantEsc: 1126, wantState: "forward", wantGear: 1},
+		{name: "sixth full throttle", esc: "forward", inputs: map[int]int{sixth: 1, throttle: 255}, wantEsc: uint16(sbus.MaxValue), wantState: "forward", wantGear: 6},
+		{name: "throttle from brake", esc: "brake", inputs: map[int]int{sixth: 1, throttle: 255}, wantEsc: uint16(sbus.MaxValue), wantPriority: 3, wantState: "forward", wantGear: 6},
+		{name: "brake from forward", esc: "forward", inputs: map[int]int{first: 1, brake: 255}, wantEsc: uint16(sbus.MinValue), wantPriority: 3, wantState: "brake", wantGear: 1},
+		{name: "brake inside deadband", esc: "forward", inputs: map[int]int{first: 1, brake: 5}, wantEsc: mid, wantState: "forward", wantGear: 1},
+		{name: "brake held", esc: "brake", inputs: map[int]int{first: 1, brake: 255}, wantEsc: uint16(sbus.MinValue), wantState: "brake", wantGear: 1},
+		{name: "brake from reverse", esc: "reverse", inputs: map[int]int{first: 1, brake: 255}, wantEsc: mid + 50, wantPriority: 3, wantState: "forward", wantGear: 1},
+		{name: "released from brake", esc: "brake", inputs: map[int]int{first: 1}, wantEsc: mid + 50, wantPriority: 3, wantState: "forward", wantGear: 1},
+		{name: "released in forward", esc: "forward", inputs: map[int]int{first: 1}, wantEsc: mid, wantState: "forward", wantGear: 1},
+
+		//reverse gear, throttle reverses
+		{name: "reverse throttle from forward", esc: "forward", inputs: map[int]int{reverse: 1, throttle: 255}, wantEsc: mid - 50, wantPriority: 10, wantState: "brake", wantGear: -1},
+		{name: "reverse throttle from brake", esc: "brake", inputs: map[int]int{reverse: 1, throttle: 255}, wantEsc: mid, wantPriority: 10, wantState: "reverse", wantGear: -1},
+		{name: "reverse full throttle", esc: "reverse", inputs: map[int]int{reverse: 1, throttle: 255}, wantEsc: uint16(sbus.MinValue), wantState: "reverse", wantGear: -1},
+		{name: "reverse brake from forward", esc: "forward", inputs: map[int]int{reverse: 1, brake: 255}, wantEsc: mid - 50, wantPriority: 3, wantState: "brake", wantGear: -1},
+		{name: "reverse brake held", esc: "brake", inputs: map[int]int{reverse: 1, brake: 255}, wantEsc: uint16(sbus.MinValue), wantState: "brake", wantGear: -1},
+		{name: "reverse brake from reverse", esc: "reverse", inputs: map[int]int{reverse: 1, brake: 255}, wantEsc: mid + 50, wantPriority: 3, wantState: "forward", wantGear: -1},
+		{name: "reverse released in forward", esc: "forward", inputs: map[int]int{reverse: 1}, wantEsc: mid, wantState: "forward", wantGear: -1},
+		{name: "reverse released from brake", esc: "brake", inputs: map[int]int{reverse: 1}, wantEsc: mid + 50, wantPriority: 20, wantState: "forward", wantGear: -1},
+		{name: "reverse released from reverse", esc: "reverse", inputs: map[int]int{reverse: 1}, wantEsc: mid + 100, wantPriority: 20, wantState: "forward", wantGear: -1},
+	}
+	for _, tc := range tests {
+		frame, state := Mixer(pressed(tc.inputs), stateWith(tc.esc, 0), models.ControllerOptions{UseHPattern: true})
+		if frame.Frame.Ch[1] != tc.wantEsc {
+			t.Errorf("%s: esc got %d want %d", tc.name, frame.Frame.Ch[1], tc.wantEsc)
+		}
+		if frame.Priority != tc.wantPriority {
+			t.Errorf("%s: priority got %d want %d", tc.name, frame.Priority, tc.wantPriority)
+		}
+		if state.Esc != tc.wantState {
+			t.Errorf("%s: esc state got %s want %s", tc.name, state.Esc, tc.wantState)
+		}
+		if state.Gear != tc.wantGear {
+			t.Errorf("%s: gear got %d want %d", tc.name, state.Gear, tc.wantGear)
+		}
+	}
+}
+
+// Reverse on the esc takes forward, brake, then reverse
+func TestMixerReverseSequence(t *testing.T) {
+	opts := models.ControllerOptions{UseHPattern: true}
+	state := models.MixState{}
+	wantStates := []string{"brake", "reverse", "reverse"}
+	for i, want := range wantStates {
+		_, state = Mixer(pressed(map[int]int{reverse: 1, throttle: 255}), state, opts)
+		if state.Esc != want {
+			t.Fatalf("step %d: esc state got %s want %s", i, state.Esc, want)
+		}
+	}
+	frame, state := Mixer(pressed(map[int]int{reverse: 1}), state, opts)
+	if state.Esc != "forward" || frame.Frame.Ch[1] != uint16(sbus.MidValue)+100 {
+		t.Errorf("release: esc state %s value %d", state.Esc, frame.Frame.Ch[1])
+	}
+}
+
+func TestMixerPaddleShifts(t *testing.T) {
+	opts := models.ControllerOptions{}
+	state := models.MixState{}
+	inputs := restingInputs()
+	shift := func(label string) {
+		inputs[20].Label = label
+		inputs[20].Value = 1
+		_, state = Mixer(append([]models.Input{}, inputs...), state, opts)
+		inputs[20].Value = 0
+		_, state = Mixer(append([]models.Input{}, inputs...), state, opts)
+	}
+
+	_, state = Mixer(restingInputs(), state, opts)
+	if state.Gear != 0 || state.Esc != "forward" {
+		t.Fatalf("first mix: gear %d esc %s", state.Gear, state.Esc)
+	}
+	shift("upshift")
+	shift("upshift")
+	if state.Gear != 2 {
+		t.Errorf("after two upshifts: gear %d", state.Gear)
+	}
+	shift("downshift")
+	if state.Gear != 1 {
+		t.Errorf("after downshift: gear %d", state.Gear)
+	}
+
+	//holding the paddle only shifts once
+	inputs[20].Label = "upshift"
+	inputs[20].Value = 1
+	for i := 0; i < 3; i++ {
+		_, state = Mixer(append([]models.Input{}, inputs...), state, opts)
+	}
+	if state.Gear != 2 {
+		t.Errorf("held upshift: gear %d", state.Gear)
+	}
+}
+
+func TestMixerTrims(t *testing.T) {
+	opts := models.ControllerOptions{}
+	centered, state := Mixer(restingInputs(), models.MixState{}, opts)
+
+	tests := []struct {
+		label   string
+		trim    string
+		channel int
+		change  int
+	}{
+		{label: "mid_right", trim: "steer_trim", channel: 0, change: 1},
+		{label: "mid_left", trim: "steer_trim", channel: 0, change: -1},
+		{label: "bot_right", trim: "throttle_trim", channel: 1, change: 1},
+		{label: "bot_left", trim: "throttle_trim", channel: 1, change: -1},
+		{label: "top_right", trim: "gyro_gain", channel: 2, change: 1},
+		{label: "top_left", trim: "gyro_gain", channel: 2, change: -1},
+	}
+	for _, tc := range tests {
+		var rawInput int
+		for _, mapping := range GetKeyMap() {
+			if mapping.Label == tc.label {
+				rawInput = mapping.RawInput
+			}
+		}
+		press := pressed(map[int]int{rawInput: 1})
+		frame, pressedState := Mixer(press, state.Copy(), opts)
+		if pressedState.Trims[tc.trim] != tc.change {
+			t.Errorf("%s: %s got %d want %d", tc.label, tc.trim, pressedState.Trims[tc.trim], tc.change)
+		}
+		if tc.trim != "gyro_gain" && int(frame.Frame.Ch[tc.channel])-int(centered.Frame.Ch[tc.channel]) != tc.change {
+			t.Errorf("%s: channel %d moved from %d to %d", tc.label, tc.channel, centered.Frame.Ch[tc.channel], frame.Frame.Ch[tc.channel])
+		}
+	}
+}
+
+func TestMixerKeepsRestoredTrims(t *testing.T) {
+	state := models.MixState{Trims: map[string]int{"steer_trim": 20}}
+	frame, state := Mixer(restingInputs(), state, models.ControllerOptions{})
+	if state.Trims["steer_trim"] != 20 {
+		t.Errorf("steer trim got %d want 20", state.Trims["steer_trim"])
+	}
+	if frame.Frame.Ch[0] != uint16((sbus.MinValue+sbus.MaxValue)/2+20) {
+		t.Errorf("steer got %d", frame.Frame.Ch[0])
+	}
+}
+
+func TestMixerSteer(t *testing.T) {
+	tests := []struct {
+		value int
+		want  uint16
+	}{
+		{value: 0, want: uint16(sbus.MinValue)},
+		{value: 16383, want: uint16(sbus.MaxValue)},
+		{value: 8191, want: uint16((sbus.MinValue + sbus.MaxValue) / 2)},
+		{value: 8200, want: uint16((sbus.MinValue + sbus.MaxValue) / 2)}, //inside the deadzone
+	}
+	for _, tc := range tests {
+		frame, _ := Mixer(pressed(map[int]int{0: tc.value}), models.MixState{}, models.ControllerOptions{})
+		if frame.Frame.Ch[0] != tc.want {
+			t.Errorf("steer %d: got %d want %d", tc.value, frame.Frame.Ch[0], tc.want)
+		}
+	}
+}
+
+// withHandbrake returns inputs with the diy handbrake pulled to value (-127 is released, 127 is full)
+func withHandbrake(inputs []models.Input, value int) []models.Input {
+	inputs[handbrakeInput] = models.Input{Label: "handbrake", Value: value, Min: -127, Max: 127, Rests: "low"}
+	return inputs
+}
+
+func TestMixerHandbrakeEsc(t *testing.T) {
+	mid := uint16(sbus.MidValue)
+	tests := []struct {
+		name      string
+		inputs    map[int]int
+		handbrake int
+		opts      models.Handbrake
+		want      uint16
+	}{
+		{name: "released", handbrake: -127, want: mid},
+		{name: "inside deadzone", handbrake: -120, want: mid},
+		{name: "full blends into brake", handbrake: 127, want: uint16(sbus.MinValue)},
+		{name: "half blend", handbrake: 127, opts: models.Handbrake{Brake: 50}, want: 584},
+		{name: "foot brake further than blend", inputs: map[int]int{brake: 255}, handbrake: 127, opts: models.Handbrake{Brake: 50}, want: uint16(sbus.MinValue)},
+		{name: "blend off", handbrake: 127, opts: models.Handbrake{Brake: -1}, want: mid},
+		{name: "throttle without cut", inputs: map[int]int{throttle: 255}, handbrake: 127, opts: models.Handbrake{Brake: -1}, want: uint16(sbus.MaxValue)},
+		{name: "throttle cut", inputs: map[int]int{throttle: 255}, handbrake: 127, opts: models.Handbrake{Brake: -1, ThrottleCut: true}, want: mid},
+		{name: "throttle cut brakes", inputs: map[int]int{throttle: 255}, handbrake: 127, opts: models.Handbrake{ThrottleCut: true}, want: uint16(sbus.MinValue)},
+		{name: "throttle cut released", inputs: map[int]int{throttle: 255}, handbrake: -127, opts: models.Handbrake{ThrottleCut: true}, want: uint16(sbus.MaxValue)},
+	}
+	for _, tc := range tests {
+		inputs := withHandbrake(pressed(tc.inputs), tc.handbrake)
+		frame, _ := Mixer(inputs, stateWith("forward", 0), models.ControllerOptions{Handbrake: tc.opts})
+		if frame.Frame.Ch[1] != tc.want {
+			t.Errorf("%s: esc got %d want %d", tc.name, frame.Frame.Ch[1], tc.want)
+		}
+	}
+}
+
+func TestMixerHandbrakeWithoutBrakePedal(t *testing.T) {
+	inputs := withHandbrake(make([]models.Input, 64), 127)
+	frame, _ := Mixer(inputs, stateWith("forward", 0), models.ControllerOptions{})
+	if frame.Frame.Ch[1] != uint16(sbus.MinValue) {
+		t.Errorf("esc got %d want %d", frame.Frame.Ch[1], sbus.MinValue)
+	}
+}
+
+func TestMixerHandbrakeOutputs(t *testing.T) {
+	tests := []struct {
+		name      string
+		handbrake int
+		opts      models.Handbrake
+		wantGyro  uint16
+		wantRear  uint16
+	}{
+		{name: "no outputs", handbrake: 127, wantGyro: 991, wantRear: uint16(sbus.MidValue)},
+		{name: "rear brake released", handbrake: -127, opts: models.Handbrake{Channel: 5}, wantGyro: 991, wantRear: uint16(sbus.MinValue)},
+		{name: "rear brake full", handbrake: 127, opts: models.Handbrake{Channel: 5}, wantGyro: 991, wantRear: uint16(sbus.MaxValue)},
+		{name: "gyro cut released", handbrake: -127, opts: models.Handbrake{GyroCut: 50}, wantGyro: 991, wantRear: uint16(sbus.MidValue)},
+		{name: "gyro cut half pull", handbrake: 0, opts: models.Handbrake{GyroCut: 50}, wantGyro: 786, wantRear: uint16(sbus.MidValue)},
+		{name: "gyro cut full pull", handbrake: 127, opts: models.Handbrake{GyroCut: 50}, wantGyro: 581, wantRear: uint16(sbus.MidValue)},
+		{name: "gyro cut to minimum", handbrake: 127, opts: models.Handbrake{GyroCut: 100}, wantGyro: uint16(sbus.MinValue), wantRear: uint16(sbus.MidValue)},
+	}
+	for _, tc := range tests {
+		inputs := withHandbrake(restingInputs(), tc.handbrake)
+		frame, _ := Mixer(inputs, stateWith("forward", 0), models.ControllerOptions{Handbrake: tc.opts})
+		if frame.Frame.Ch[2] != tc.wantGyro {
+			t.Errorf("%s: gyro got %d want %d", tc.name, frame.Frame.Ch[2], tc.wantGyro)
+		}
+		if frame.Frame.Ch[5] != tc.wantRear {
+			t.Errorf("%s: rear brake got %d want %d", tc.name, frame.Frame.Ch[5], tc.wantRear)
+		}
+	}
+}
@@ -11,7 +11,7 @@ func GetKeyMap() map[string]models.Mapping {
 		CodeName: "ABS_X",
 		Type:     3,
 		Code:     0,
-		RawInput: 2, //brake
+		RawInput: 4, //handbrake, blended into the brake by the mixer
 		Rests:    "low",
 		Min:      -127,
 		Max:      127,
@@ -0,0 +1,64 @@
+package models
+
+// Curve shapes an axis before it is mixed into a frame.
+// Expo is -100 to 100 (positive softens the center), Rate is 1 to 100 percent of travel (0 is treated as 100)
+type Curve struct {
+	Expo int `json:"expo"`
+	Rate int `json:"rate"`
+}
+
+func (c Curve) IsLinear() bool {
+	return c.Expo == 0 && (c.Rate == 0 || c.Rate == 100)
+}
+
+// ApplyCurve reshapes the input value around its resting point, keeping the input min/max
+func ApplyCurve(input Input, curve Curve) Input {
+	if curve.IsLinear() || input.Max == input.Min {
+		return input
+	}
+
+	expo := clampFloat(float64(curve.Expo)/100, -1, 1)
+	rate := 1.0
+	if curve.Rate > 0 && curve.Rate < 100 {
+		rate = float64(curve.Rate) / 100
+	}
+
+	switch input.Rests {
+	case "middle":
+		mid := float64(input.Max+input.Min) / 2
+		halfRange := float64(input.Max-input.Min) / 2
+		normalized := clampFloat((float64(input.Value)-mid)/halfRange, -1, 1)
+		input.Value = int(mid + shape(normalized, expo, rate)*halfRange)
+	case "low":
+		normalized := clampFloat(float64(input.Value-input.Min)/float64(input.Max-input.Min), 0, 1)
+		input.Value = input.Min + int(shape(normalized, expo, rate)*float64(input.Max-input.Min))
+	case "high":
+		normalized := clampFloat(float64(input.Max-input.Value)/float64(input.Max-input.Min), 0, 1)
+		input.Value = input.Max - int(shape(normalized, expo, rate)*float64(input.Max-input.Min))
+	}
+	return input
+}
+
+// blend linear and cubic response then scale by the rate
+func shape(value, expo, rate float64) float64 {
+	if expo >= 0 {
+		value = (1-expo)*value + expo*value*value*value
+	} else { //negative expo makes the center more sensitive
+		sign := 1.0
+		if value < 0 {
+			sign = -1.0
+		}
+		abs := value * sign
+		value = sign * ((1+expo)*abs + -expo*(1-(1-abs)*(1-abs)*(1-abs)))
+	}
+	return value * rate
+}
+
+func clampFloat(value, min, max float64) float64 {
+	if value > max {
+		return max
+	} else if value < min {
+		return min
+	}
+	return value
+}
@@ -1,6 +1,10 @@
 package models
 
-import "github.com/Speshl/pi_drift_wheel/sbus"
+import (
+	"maps"
+
+	"github.com/Speshl/pi_drift_wheel/sbus"
+)
 
 type Mixer func([]Input, MixState, ControllerOptions) (sbus.SBusFrame, MixState)
 
@@ -27,7 +31,18 @@ type Input struct {
 }
 
 type ControllerOptions struct {
-	UseHPattern bool
+	UseHPattern   bool
+	SteerCurve    Curve
+	ThrottleCurve Curve
+	Handbrake     Handbrake
+}
+
+// Handbrake is how the handbrake input mixes. The zero value blends it fully into the brake like the foot brake
+type Handbrake struct {
+	Brake       int  `json:"brake"`        //percent of handbrake travel blended into the brake (0 is treated as 100, negative leaves the brake alone)
+	ThrottleCut bool `json:"throttle_cut"` //ignore the throttle while the handbrake is pulled
+	Channel     int  `json:"channel"`      //mixed channel driven by handbrake travel for a rear brake servo, 0 for none
+	GyroCut     int  `json:"gyro_cut"`     //percent the gyro gain drops at full handbrake, scaled by travel
 }
 
 type MixState struct {
@@ -47,6 +62,14 @@ func NewMixState() MixState {
 	}
 }
 
+// Copy returns a MixState that does not share maps with the original
+func (m MixState) Copy() MixState {
+	returnState := m
+	returnState.Buttons = maps.Clone(m.Buttons)
+	returnState.Trims = maps.Clone(m.Trims)
+	return returnState
+}
+
 func (m *MixState) IsEmpty() bool {
 	if m.Esc == "" && len(m.Buttons) == 0 /*&& len(m.Aux) == 0*/ {
 		return true
@@ -62,6 +62,9 @@ func MapToRangeWithDeadzoneLow(value, min, max, minReturn, maxReturn, deadZone i
 }
 
 func MapToRange(value, min, max, minReturn, maxReturn int) int {
+	if max == min { //no travel to map from
+		return minReturn
+	}
 	mappedValue := (maxReturn-minReturn)*(value-min)/(max-min) + minReturn
 
 	if mappedValue > maxReturn {
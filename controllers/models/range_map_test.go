@@ -0,0 +1,139 @@
+package models
+
+import "testing"
+
+func TestMapToRange(t *testing.T) {
+	tests := []struct {
+		name                                  string
+		value, min, max, minReturn, maxReturn int
+		want                                  int
+	}{
+		{name: "min", value: 0, min: 0, max: 255, minReturn: 172, maxReturn: 1811, want: 172},
+		{name: "max", value: 255, min: 0, max: 255, minReturn: 172, maxReturn: 1811, want: 1811},
+		{name: "middle rounds down", value: 128, min: 0, max: 255, minReturn: 0, maxReturn: 100, want: 50},
+		{name: "below min clamps", value: -10, min: 0, max: 255, minReturn: 0, maxReturn: 100, want: 0},
+		{name: "above max clamps", value: 300, min: 0, max: 255, minReturn: 0, maxReturn: 100, want: 100},
+		{name: "signed input", value: 0, min: -127, max: 127, minReturn: 0, maxReturn: 100, want: 50},
+		{name: "min equals max", value: 5, min: 5, max: 5, minReturn: 0, maxReturn: 100, want: 0},
+		{name: "min equals max off value", value: 9, min: 5, max: 5, minReturn: 172, maxReturn: 1811, want: 172},
+	}
+	for _, tc := range tests {
+		got := MapToRange(tc.value, tc.min, tc.max, tc.minReturn, tc.maxReturn)
+		if got != tc.want {
+			t.Errorf("%s: got %d want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMapToRangeWithDeadzoneMid(t *testing.T) {
+	tests := []struct {
+		value int
+		want  int
+	}{
+		{value: 50, want: 50},
+		{value: 52, want: 50},
+		{value: 48, want: 50},
+		{value: 55, want: 55},
+		{value: 45, want: 45},
+		{value: 0, want: 0},
+		{value: 100, want: 100},
+		{value: 120, want: 100},
+	}
+	for _, tc := range tests {
+		got := MapToRangeWithDeadzoneMid(tc.value, 0, 100, 0, 100, 5)
+		if got != tc.want {
+			t.Errorf("value %d: got %d want %d", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestMapToRangeWithDeadzoneLow(t *testing.T) {
+	tests := []struct {
+		value int
+		want  int
+	}{
+		{value: 0, want: 0},
+		{value: 3, want: 0},
+		{value: 5, want: 5},
+		{value: 50, want: 50},
+		{value: 150, want: 100},
+		{value: -10, want: 0},
+	}
+	for _, tc := range tests {
+		got := MapToRangeWithDeadzoneLow(tc.value, 0, 100, 0, 100, 5)
+		if got != tc.want {
+			t.Errorf("value %d: got %d want %d", tc.value, got, tc.want)
+		}
+	}
+
+	if got := MapToRangeWithDeadzoneLow(7, 7, 7, 172, 992, 2); got != 172 {
+		t.Errorf("min equals max: got %d want 172", got)
+	}
+}
+
+func TestGetScaledInputChange(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Input
+		want  int
+	}{
+		{name: "zero value", input: Input{Value: 0, Min: 0, Max: 255, Rests: "high"}, want: 0},
+		{name: "no range", input: Input{Value: 3, Min: 0, Max: 0, Rests: "low"}, want: 0},
+		{name: "low half", input: Input{Value: 128, Min: 0, Max: 255, Rests: "low"}, want: 50},
+		{name: "middle full", input: Input{Value: 16383, Min: 0, Max: 16383, Rests: "middle"}, want: 50},
+		{name: "middle centered", input: Input{Value: 8191, Min: 0, Max: 16383, Rests: "middle"}, want: 1},
+		{name: "high at rest", input: Input{Value: 255, Min: 0, Max: 255, Rests: "high"}, want: 0},
+		{name: "high pressed", input: Input{Value: 64, Min: 0, Max: 255, Rests: "high"}, want: 75},
+		{name: "unknown rest", input: Input{Value: 1, Min: -1, Max: 1, Rests: "mid"}, want: 0},
+	}
+	for _, tc := range tests {
+		got := GetScaledInputChange(tc.input)
+		if got != tc.want {
+			t.Errorf("%s: got %d want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGetInputChangeAmount(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Input
+		want  int
+	}{
+		{name: "low", input: Input{Value: 100, Min: 0, Max: 255, Rests: "low"}, want: 100},
+		{name: "middle", input: Input{Value: -127, Min: -127, Max: 127, Rests: "middle"}, want: 127},
+		{name: "high", input: Input{Value: 55, Min: 0, Max: 255, Rests: "high"}, want: 200},
+		{name: "unknown rest", input: Input{Value: 1, Min: -1, Max: 1, Rests: "mid"}, want: 0},
+	}
+	for _, tc := range tests {
+		got := GetInputChangeAmount(tc.input)
+		if got != tc.want {
+			t.Errorf("%s: got %d want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func FuzzMapToRange(f *testing.F) {
+	f.Add(int16(0), int16(0), int16(255), int16(172), int16(1811))
+	f.Add(int16(5), int16(5), int16(5), int16(0), int16(100))
+	f.Add(int16(-300), int16(-127), int16(127), int16(-100), int16(100))
+	f.Fuzz(func(t *testing.T, value, min, max, minReturn, maxReturn int16) {
+		if minReturn > maxReturn {
+			minReturn, maxReturn = maxReturn, minReturn
+		}
+		got := MapToRange(int(value), int(min), int(max), int(minReturn), int(maxReturn))
+		if got < int(minReturn) || got > int(maxReturn) {
+			t.Errorf("MapToRange(%d, %d, %d, %d, %d) = %d outside the return range", value, min, max, minReturn, maxReturn, got)
+		}
+
+		got = MapToRangeWithDeadzoneLow(int(value), int(min), int(max), int(minReturn), int(maxReturn), 2)
+		if got < int(minReturn) || got > int(maxReturn) {
+			t.Errorf("MapToRangeWithDeadzoneLow(%d, %d, %d, %d, %d) = %d outside the return range", value, min, max, minReturn, maxReturn, got)
+		}
+
+		got = MapToRangeWithDeadzoneMid(int(value), int(min), int(max), int(minReturn), int(maxReturn), 2)
+		if got < int(minReturn) || got > int(maxReturn) {
+			t.Errorf("MapToRangeWithDeadzoneMid(%d, %d, %d, %d, %d) = %d outside the return range", value, min, max, minReturn, maxReturn, got)
+		}
+	})
+}
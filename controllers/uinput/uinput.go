@@ -0,0 +1,245 @@
+package uinput
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/controllers/g27"
+	"github.com/Speshl/pi_drift_wheel/controllers/handbrake_diy"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/go-evdev"
+)
+
+const (
+	G27Name       = "G27 Racing Wheel"
+	HandbrakeName = "Arduino LLC Arduino Micro"
+
+	ffEffectsMax  = 16
+	ffReadTimeout = 100 * time.Millisecond
+)
+
+var ErrUnknownLabel = fmt.Errorf("label not in keymap")
+
+// Step is one scripted input change. Value is the raw device value, before the keymap inverts it
+type Step struct {
+	Label string
+	Value int
+	Delay time.Duration //wait before sending
+}
+
+// Device is a virtual controller made with uinput that the app loads like the real hardware
+type Device struct {
+	Name   string
+	device *evdev.InputDevice
+	labels map[string]models.Mapping
+
+	ffLock    sync.RWMutex
+	ffLevels  []int16
+	ffPlaying bool
+	ffErases  int
+}
+
+// NewG27 creates a virtual G27 with every axis and button in the g27 keymap and constant force feedback
+func NewG27() (*Device, error) {
+	id := evdev.InputID{BusType: evdev.BUS_USB, Vendor: 0x046d, Product: 0xc29b, Version: 0x0111}
+	return NewDevice(G27Name, id, g27.GetKeyMap(), true)
+}
+
+// NewHandbrake creates a virtual diy handbrake (arduino micro)
+func NewHandbrake() (*Device, error) {
+	id := evdev.InputID{BusType: evdev.BUS_USB, Vendor: 0x2341, Product: 0x8037, Version: 0x0100}
+	return NewDevice(HandbrakeName, id, handbrake_diy.GetKeyMap(), false)
+}
+
+// NewDevice creates a virtual device whose capabilities and axis ranges come from a keymap
+func NewDevice(name string, id evdev.InputID, keyMap map[string]models.Mapping, forceFeedback bool) (*Device, error) {
+	capabilities := make(map[evdev.EvType][]evdev.EvCode, 3)
+	labels := make(map[string]models.Mapping, len(keyMap))
+	opts := evdev.UinputOptions{
+		AbsInfos: make(map[evdev.EvCode]evdev.AbsInfo, 4),
+	}
+	for _, mapping := range keyMap {
+		evType := evdev.EvType(mapping.Type)
+		evCode := evdev.EvCode(mapping.Code)
+		capabilities[evType] = append(capabilities[evType], evCode)
+		labels[mapping.Label] = mapping
+		if evType == evdev.EV_ABS {
+			opts.AbsInfos[evCode] = evdev.AbsInfo{
+				Minimum: int32(mapping.Min),
+				Maximum: int32(mapping.Max),
+			}
+		}
+	}
+	if forceFeedback {
+		capabilities[evdev.EV_FF] = []evdev.EvCode{evdev.FF_CONSTANT}
+		opts.EffectsMax = ffEffectsMax
+	}
+
+	device, err := evdev.CreateDeviceWithOptions(name, id, capabilities, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating %s: %w", name, err)
+	}
+	return &Device{
+		Name:   name,
+		device: device,
+		labels: labels,
+	}, nil
+}
+
+// Available reports if this machine lets us create uinput devices
+func Available() bool {
+	file, err := os.OpenFile("/dev/uinput", os.O_WRONLY, 0)
+	if err != nil {
+		return false
+	}
+	file.Close()
+	return true
+}
+
+// WaitReady blocks until the device shows up in /dev/input so LoadControllers can find it
+func (d *Device) WaitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		inputPaths, err := evdev.ListDevicePaths()
+		if err != nil {
+			return fmt.Errorf("failed listing device paths: %w", err)
+		}
+		for _, inputPath := range inputPaths {
+			if inputPath.Name == d.Name {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not listed after %s", d.Name, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Set sends a single input change followed by a sync report
+func (d *Device) Set(label string, value int) error {
+	mapping, ok := d.labels[label]
+	if !ok {
+		return fmt.Errorf("%s on %s: %w", label, d.Name, ErrUnknownLabel)
+	}
+	err := d.device.WriteOne(&evdev.InputEvent{
+		Type:  evdev.EvType(mapping.Type),
+		Code:  evdev.EvCode(mapping.Code),
+		Value: int32(value),
+	})
+	if err != nil {
+		return fmt.Errorf("failed writing %s: %w", label, err)
+	}
+	err = d.device.WriteOne(&evdev.InputEvent{
+		Type: evdev.EV_SYN,
+		Code: evdev.SYN_REPORT,
+	})
+	if err != nil {
+		return fmt.Errorf("failed writing sync: %w", err)
+	}
+	return nil
+}
+
+// Play sends a script of input changes in order
+func (d *Device) Play(ctx context.Context, steps []Step) error {
+	for _, step := range steps {
+		if step.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(step.Delay):
+			}
+		}
+		err := d.Set(step.Label, step.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeFF answers force feedback uploads and erases until ctx is done.
+// Uploads block the client until answered so this must run for SetForceFeedback to return
+func (d *Device) ServeFF(ctx context.Context) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := d.device.SetReadDeadline(time.Now().Add(ffReadTimeout))
+		if err != nil {
+			return fmt.Errorf("failed setting read deadline: %w", err)
+		}
+		e, err := d.device.ReadOne()
+		if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, syscall.EAGAIN) {
+			continue
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed reading ff request: %w", err)
+		}
+
+		switch {
+		case e.Type == evdev.EV_UINPUT && e.Code == evdev.UI_FF_UPLOAD:
+			effect, err := d.device.HandleFFUpload(uint32(e.Value))
+			if err != nil {
+				return err
+			}
+			slog.Debug("virtual ff upload", "device", d.Name, "id", effect.Id, "level", effect.EffectType.Constant.Level)
+			d.ffLock.Lock()
+			d.ffLevels = append(d.ffLevels, effect.EffectType.Constant.Level)
+			d.ffLock.Unlock()
+		case e.Type == evdev.EV_UINPUT && e.Code == evdev.UI_FF_ERASE:
+			_, err := d.device.HandleFFErase(uint32(e.Value))
+			if err != nil {
+				return err
+			}
+			d.ffLock.Lock()
+			d.ffErases++
+			d.ffLock.Unlock()
+		case e.Type == evdev.EV_FF:
+			d.ffLock.Lock()
+			d.ffPlaying = e.Value > 0
+			d.ffLock.Unlock()
+		}
+	}
+}
+
+// FFLevels returns every constant force level uploaded so far
+func (d *Device) FFLevels() []int16 {
+	d.ffLock.RLock()
+	defer d.ffLock.RUnlock()
+	returnSlice := make([]int16, len(d.ffLevels))
+	copy(returnSlice, d.ffLevels)
+	return returnSlice
+}
+
+// FFPlaying is true once a client has started an uploaded effect
+func (d *Device) FFPlaying() bool {
+	d.ffLock.RLock()
+	defer d.ffLock.RUnlock()
+	return d.ffPlaying
+}
+
+// FFErases counts effects a client has erased
+func (d *Device) FFErases() int {
+	d.ffLock.RLock()
+	defer d.ffLock.RUnlock()
+	return d.ffErases
+}
+
+// Close removes the virtual device from the system
+func (d *Device) Close() error {
+	err := evdev.DestroyDevice(d.device)
+	if err != nil {
+		d.device.Close()
+		return fmt.Errorf("failed destroying %s: %w", d.Name, err)
+	}
+	return d.device.Close()
+}
@@ -3,11 +3,16 @@ package crsf
 //Followed specification as defined on the wiki here: https://github.com/crsf-wg/crsf/wiki
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	"github.com/Speshl/pi_drift_wheel/transport"
 	"github.com/albenik/go-serial/v2"
 	"golang.org/x/sync/errgroup"
 )
@@ -18,12 +23,18 @@ type CRSF struct {
 	receiving bool
 	//transmitting bool
 
-	dataLock sync.RWMutex
-	data     CRSFData
+	dataLock     sync.RWMutex
+	data         CRSFData
+	lastReceived time.Time
+	channelsTime time.Time //last channels frame, for link loss on control ports
+	linkTime     time.Time //last link stats frame
+	attitudeTime time.Time //last attitude frame, for the software gyro
 }
 
 type CRSFOptions struct {
-	BaudRate int
+	BaudRate  int
+	OnFrame   func([]byte)        //called with the type, payload and crc of every valid frame, keep it quick
+	Transport transport.Transport //used instead of opening the path when set
 }
 
 func NewCRSF(path string, opts *CRSFOptions) *CRSF {
@@ -47,19 +58,28 @@ func (c *CRSF) String() string {
 }
 
 func (c *CRSF) Start(ctx context.Context) error {
-	port, err := serial.Open(c.path,
-		serial.WithBaudrate(c.opts.BaudRate), //Looks like this can be multiple baudrates
-		serial.WithDataBits(8),
-		serial.WithParity(serial.NoParity),
-		serial.WithStopBits(serial.OneStopBit),
-		serial.WithReadTimeout(1000),
-	)
-	if err != nil {
-		return fmt.Errorf("failed opening crsf %s: %w", c.path, err)
+	port := c.opts.Transport
+	if port == nil {
+		var err error
+		port, err = transport.Open(c.path,
+			serial.WithBaudrate(c.opts.BaudRate), //Looks like this can be multiple baudrates
+			serial.WithDataBits(8),
+			serial.WithParity(serial.NoParity),
+			serial.WithStopBits(serial.OneStopBit),
+			serial.WithReadTimeout(1000),
+		)
+		if err != nil {
+			return fmt.Errorf("failed opening crsf %s: %w", c.path, err)
+		}
 	}
 
 	crsfGroup, ctx := errgroup.WithContext(ctx)
 
+	crsfGroup.Go(func() error {
+		<-ctx.Done()
+		return port.Close() //unblocks reads on transports without a read timeout
+	})
+
 	readChan := make(chan byte, 4096)
 
 	crsfGroup.Go(func() error {
@@ -78,7 +98,15 @@ func (c *CRSF) Start(ctx context.Context) error {
 	return crsfGroup.Wait()
 }
 
-func (c *CRSF) startReader(ctx context.Context, port *serial.Port, readChan chan byte) error {
+func (c *CRSF) Path() string {
+	return c.path
+}
+
+func (c *CRSF) IsReceiving() bool {
+	return c.receiving
+}
+
+func (c *CRSF) startReader(ctx context.Context, port transport.Transport, readChan chan byte) error {
 	c.receiving = true
 	defer func() {
 		c.receiving = false
@@ -93,6 +121,9 @@ func (c *CRSF) startReader(ctx context.Context, port *serial.Port, readChan chan
 		}
 		n, err := port.Read(buff)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return fmt.Errorf("failed reading from %s: %w", c.path, err)
 		}
 		//slog.Info("read bytes", "num", n, "bytes", buff[:n] /*PrintBytes(buff[:n])*/)
@@ -103,6 +134,8 @@ func (c *CRSF) startReader(ctx context.Context, port *serial.Port, readChan chan
 }
 
 func (c *CRSF) startReadParser(ctx context.Context, readChan chan byte) error {
+	crcFailures := metrics.CRSFCRCFailures.With(c.path)
+	frameCounts := make(map[FrameType]metrics.Counter, 8) //series for each frame type, resolved the first time it is seen
 	for {
 		addressByte, err := c.getByte(ctx, readChan)
 		if err != nil {
@@ -136,41 +169,68 @@ func (c *CRSF) startReadParser(ctx context.Context, readChan chan byte) error {
 
 			//first byte of the full payload should be the frame type
 			//slog.Info("update looking for frame", "length", int(lengthByte), "frame", fullPayload[0], "type", FrameType(fullPayload[0]))
-			switch FrameType(fullPayload[0]) {
-			case FrameTypeChannels:
-				err = c.updateChannels(fullPayload)
-			//telemetry
-			case FrameTypeGPS:
-				err = c.updateGps(fullPayload)
-			case FrameTypeVario:
-				err = c.updateVario(fullPayload)
-			case FrameTypeBatterySensor:
-				err = c.updateBatterySensor(fullPayload)
-			case FrameTypeBarometer:
-				err = c.updateBarometer(fullPayload)
-			case FrameTypeLinkStats:
-				err = c.updateLinkStats(fullPayload)
-			case FrameTypeLinkRx:
-				err = c.updateLinkRx(fullPayload)
-			case FrameTypeLinkTx:
-				err = c.updateLinkTx(fullPayload)
-			case FrameTypeAttitude:
-				err = c.updateAttitude(fullPayload)
-			case FrameTypeFlightMode:
-				err = c.updateFlightMode(fullPayload)
-			default:
-				//slog.Warn("unsupported frame type", "type", fullPayload[0], "length", len(fullPayload))
-			}
+			err = c.UpdateFrame(fullPayload)
 			if err != nil {
+				if errors.Is(err, frames.ErrInvalidCRC8) {
+					crcFailures.Inc()
+				}
 				slog.Warn("failed parsing frame", "type", FrameType(fullPayload[0]).String(), "error", err)
 				continue
 			}
+			frameType := FrameType(fullPayload[0])
+			frameCount, ok := frameCounts[frameType]
+			if !ok {
+				frameCount = metrics.CRSFFrames.With(c.path, frameType.String())
+				frameCounts[frameType] = frameCount
+			}
+			frameCount.Inc()
+			c.setLastReceived(time.Now())
+			if c.opts.OnFrame != nil {
+				c.opts.OnFrame(fullPayload)
+			}
 		} else {
 			//slog.Warn("unsupported address", "byte", addressByte)
 		}
 	}
 }
 
+// UpdateFrame decodes one frame (type, payload and crc) into the latest data. Unsupported types are ignored
+func (c *CRSF) UpdateFrame(fullPayload []byte) error {
+	if len(fullPayload) == 0 {
+		return frames.ErrFrameLength
+	}
+	switch FrameType(fullPayload[0]) {
+	case FrameTypeChannels:
+		return c.updateChannels(fullPayload)
+	//telemetry
+	case FrameTypeGPS:
+		return c.updateGps(fullPayload)
+	case FrameTypeVario:
+		return c.updateVario(fullPayload)
+	case FrameTypeBatterySensor:
+		return c.updateBatterySensor(fullPayload)
+	case FrameTypeBarometer:
+		return c.updateBarometer(fullPayload)
+	case FrameTypeRPM:
+		return c.updateRpm(fullPayload)
+	case FrameTypeTemperature:
+		return c.updateTemperature(fullPayload)
+	case FrameTypeLinkStats:
+		return c.updateLinkStats(fullPayload)
+	case FrameTypeLinkRx:
+		return c.updateLinkRx(fullPayload)
+	case FrameTypeLinkTx:
+		return c.updateLinkTx(fullPayload)
+	case FrameTypeAttitude:
+		return c.updateAttitude(fullPayload)
+	case FrameTypeFlightMode:
+		return c.updateFlightMode(fullPayload)
+	default:
+		//slog.Warn("unsupported frame type", "type", fullPayload[0], "length", len(fullPayload))
+		return nil
+	}
+}
+
 func (c *CRSF) getBytes(ctx context.Context, readChan chan byte, n int) ([]byte, error) {
 	returnBytes := make([]byte, 0, n)
 
@@ -0,0 +1,135 @@
+package crsf
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+)
+
+// parse runs the stream parser over data until it runs out of bytes
+func parse(t *testing.T, data []byte) *CRSF {
+	c := NewCRSF("test", nil)
+	readChan := make(chan byte, len(data))
+	for _, b := range data {
+		readChan <- b
+	}
+	close(readChan)
+	err := c.startReadParser(context.Background(), readChan)
+	if err == nil {
+		t.Fatal("parser stopped without an error")
+	}
+	return c
+}
+
+func quietLogs(tb testing.TB) {
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tb.Cleanup(func() { slog.SetDefault(logger) })
+}
+
+func TestReadParserSkipsNoise(t *testing.T) {
+	quietLogs(t)
+	attitude := frames.AttitudeData{Pitch: 612, Roll: -20, Yaw: 3000}
+	gps := frames.GpsData{Lat: 476205000, Long: -1223493000, SatelliteCount: 9}
+	badCrc := EncodeFrame(AddressTypeFlightController, attitude.Marshal())
+	badCrc[len(badCrc)-1]++
+
+	var stream []byte
+	stream = append(stream, 0x00, 0xff, 0x13) //line noise
+	stream = append(stream, byte(AddressTypeFlightController), 0x00)
+	stream = append(stream, byte(AddressTypeFlightController), 0x7f)
+	stream = append(stream, EncodeFrame(AddressTypeFlightController, attitude.Marshal())...)
+	stream = append(stream, byte(AddressTypeFlightController), 0x01, byte(FrameTypeFlightMode))
+	stream = append(stream, EncodeFrame(AddressTypeFlightController, gps.Marshal())...)
+	stream = append(stream, badCrc...)
+
+	c := parse(t, stream)
+	if got := c.GetAttitude(); got != attitude {
+		t.Errorf("attitude got %+v want %+v", got, attitude)
+	}
+	if got := c.GetGps(); got != gps {
+		t.Errorf("gps got %+v want %+v", got, gps)
+	}
+}
+
+func TestUpdateFrameShortFrames(t *testing.T) {
+	for frameType := 0; frameType < 256; frameType++ {
+		for length := 0; length < 4; length++ {
+			data := make([]byte, length)
+			if length > 0 {
+				data[0] = byte(frameType)
+			}
+			NewCRSF("test", nil).UpdateFrame(data)
+		}
+	}
+}
+
+func FuzzUpdateFrame(f *testing.F) {
+	attitude := frames.AttitudeData{Pitch: 500}
+	f.Add(attitude.Marshal())
+	f.Add([]byte{byte(FrameTypeFlightMode)})
+	f.Add([]byte{byte(FrameTypeChannels), 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		NewCRSF("fuzz", nil).UpdateFrame(data)
+	})
+}
+
+func FuzzReadParser(f *testing.F) {
+	quietLogs(f)
+	attitude := frames.AttitudeData{Pitch: 500}
+	gps := frames.GpsData{Lat: 1, Long: 2}
+	f.Add(EncodeFrame(AddressTypeFlightController, attitude.Marshal()))
+	f.Add(append(EncodeFrame(AddressTypeFlightController, gps.Marshal()), 0xc8, 0x01, 0x21))
+	f.Add([]byte{0xc8, 0x02, 0x21, 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parse(t, data)
+	})
+}
+
+func TestFrameTypeNames(t *testing.T) {
+	want := map[FrameType]string{
+		0x02: "GPS", 0x07: "Vario", 0x08: "BatterySensor", 0x09: "Barometer",
+		0x0C: "RPM", 0x0D: "Temperature", 0x14: "LinkStats", 0x16: "Channels",
+		0x17: "ChannelSubSet", 0x1C: "LinkRx", 0x1D: "LinkTx", 0x1E: "Attitude", 0x21: "FlightMode",
+	}
+	for value, name := range want {
+		if value.String() != name {
+			t.Errorf("0x%02x: got %q want %q", byte(value), value.String(), name)
+		}
+		parsed, err := ParseFrameType(name)
+		if err != nil || parsed != value {
+			t.Errorf("%s: parsed 0x%02x %v", name, byte(parsed), err)
+		}
+	}
+}
+
+func TestChannelsAndLinkStatsReceived(t *testing.T) {
+	c := NewCRSF("test", nil)
+	if !c.ChannelsReceived().IsZero() || !c.LinkStatsReceived().IsZero() {
+		t.Fatal("received times set before any frame")
+	}
+	c.SetLinkStats(frames.LinkStatsData{UplinkQuality: 100})
+	if !c.ChannelsReceived().IsZero() || c.LinkStatsReceived().IsZero() {
+		t.Fatal("link stats should only set the link stats time")
+	}
+	c.SetChannels(frames.ChannelsData{Channels: make([]uint16, frames.MaxChannels)})
+	if c.ChannelsReceived().IsZero() {
+		t.Fatal("channels time not set")
+	}
+}
+
+func TestAttitudeSample(t *testing.T) {
+	c := NewCRSF("test", nil)
+	_, received := c.AttitudeSample()
+	if !received.IsZero() {
+		t.Fatal("attitude time set before any frame")
+	}
+	c.SetAttitude(frames.AttitudeData{Yaw: 1234})
+	attitude, received := c.AttitudeSample()
+	if received.IsZero() || attitude.Yaw != 1234 {
+		t.Fatalf("got yaw %d at %s", attitude.Yaw, received)
+	}
+}
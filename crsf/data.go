@@ -16,6 +16,8 @@ type CRSFTelemetry struct {
 	Vario         frames.VarioData
 	BatterySensor frames.BatterySensorData
 	Barometer     frames.BarometerData
+	Rpm           frames.RpmData
+	Temperature   frames.TemperatureData
 	LinkStats     frames.LinkStatsData
 	LinkRx        frames.LinkRxData
 	LinkTx        frames.LinkTxData
@@ -28,12 +30,14 @@ func NewCRSFData() CRSFData {
 }
 
 func (d *CRSFData) String() string {
-	return fmt.Sprintf("Channels: {%s}\nGPS: {%s}\nVario: {%s}\nBattery: {%s}\nBarometer: {%s}\nLinkStats: {%s}\nLinkRx: {%s}\nLinkTx: {%s}\nAttitude: {%s}\nFlightMode: {%s}",
+	return fmt.Sprintf("Channels: {%s}\nGPS: {%s}\nVario: {%s}\nBattery: {%s}\nBarometer: {%s}\nRpm: {%s}\nTemperature: {%s}\nLinkStats: {%s}\nLinkRx: {%s}\nLinkTx: {%s}\nAttitude: {%s}\nFlightMode: {%s}",
 		d.Channels.String(),
 		d.Gps.String(),
 		d.Vario.String(),
 		d.BatterySensor.String(),
 		d.Barometer.String(),
+		d.Rpm.String(),
+		d.Temperature.String(),
 		d.LinkStats.String(),
 		d.LinkRx.String(),
 		d.LinkTx.String(),
@@ -0,0 +1,9 @@
+package crsf
+
+// EncodeFrame wraps a marshaled frame (type, payload and crc) with the address and length bytes
+// so it can be written to a link. [sync] [len] [type] [payload] [crc8]
+func EncodeFrame(address AddressType, data []byte) []byte {
+	frame := make([]byte, 0, len(data)+2)
+	frame = append(frame, byte(address), byte(len(data)))
+	return append(frame, data...)
+}
@@ -8,6 +8,7 @@ import (
 
 const (
 	AttitudeFrameLength = 6 + 2 //Payload + Type + CRC
+	AttitudeFrameType   = 0x1E
 )
 
 // All values must be in the +/-180 degree +/-PI radian range
@@ -35,6 +36,15 @@ func UnmarshalAttitude(data []byte) (AttitudeData, error) {
 	return d, nil
 }
 
+func (d *AttitudeData) Marshal() []byte {
+	data := make([]byte, AttitudeFrameLength)
+	data[0] = AttitudeFrameType
+	binary.BigEndian.PutUint16(data[1:3], uint16(d.Pitch))
+	binary.BigEndian.PutUint16(data[3:5], uint16(d.Roll))
+	binary.BigEndian.PutUint16(data[5:7], uint16(d.Yaw))
+	return setCrc(data)
+}
+
 func (d *AttitudeData) String() string {
 	pitch := getAsDegree(d.Pitch)
 	roll := getAsDegree(d.Roll)
@@ -8,12 +8,13 @@ import (
 
 const (
 	BatterySensorFrameLength = 8 + 2 //Payload + Type + CRC
+	BatterySensorFrameType   = 0x08
 )
 
 type BatterySensorData struct {
 	Voltage   int16 // dv Big-Endian
 	Current   int16 // da Big Endian
-	Used      int32 //int24 mAh Little Endian
+	Used      int32 //int24 mAh Big Endian
 	Remaining int8  //percent (0-100)
 }
 
@@ -30,9 +31,7 @@ func UnmarshalBatterySensor(data []byte) (BatterySensorData, error) {
 	d.Voltage = int16(binary.BigEndian.Uint16(data[1:3]))
 	d.Current = int16(binary.BigEndian.Uint16(data[3:5]))
 
-	paddedInt24 := []byte{0} //add zero byte to front of 3 data bytes to pad out to 4 bytes for int32, little endian so 0 should go first
-	paddedInt24 = append(paddedInt24, data[5:8]...)
-	d.Used = int32(binary.LittleEndian.Uint32(paddedInt24))
+	d.Used = int32(data[5])<<16 | int32(data[6])<<8 | int32(data[7]) //int24 big-endian
 
 	d.Remaining = int8(data[8])
 
@@ -40,7 +39,19 @@ func UnmarshalBatterySensor(data []byte) (BatterySensorData, error) {
 	return d, nil
 }
 
+func (d *BatterySensorData) Marshal() []byte {
+	data := make([]byte, BatterySensorFrameLength)
+	data[0] = BatterySensorFrameType
+	binary.BigEndian.PutUint16(data[1:3], uint16(d.Voltage))
+	binary.BigEndian.PutUint16(data[3:5], uint16(d.Current))
+	data[5] = byte(d.Used >> 16)
+	data[6] = byte(d.Used >> 8)
+	data[7] = byte(d.Used)
+	data[8] = byte(d.Remaining)
+	return setCrc(data)
+}
+
 func (d *BatterySensorData) String() string {
-	voltage := int(d.Voltage) * 10
-	return fmt.Sprintf("Voltage: %dV Current: %dda Used: %dmAh Remaining: %d%%", voltage, d.Current, d.Used, d.Remaining)
+	voltage := float64(d.Voltage) / 10
+	return fmt.Sprintf("Voltage: %.1fV Current: %dda Used: %dmAh Remaining: %d%%", voltage, d.Current, d.Used, d.Remaining)
 }
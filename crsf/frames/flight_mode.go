@@ -15,7 +15,7 @@ type FlightModeData struct {
 
 func UnmarshalFlightMode(data []byte) (FlightModeData, error) {
 	d := FlightModeData{}
-	if len(data) > FlightModeFrameLength {
+	if len(data) < 2 || len(data) > FlightModeFrameLength {
 		return d, ErrFrameLength
 	}
 	if !ValidateFrame(data) {
@@ -23,11 +23,11 @@ func UnmarshalFlightMode(data []byte) (FlightModeData, error) {
 	}
 	//TODO check correct type?
 
-	for i := range data[1 : len(data)-1] {
-		if i == 0x00 { //null terminator for string
+	for _, b := range data[1 : len(data)-1] {
+		if b == 0x00 { //null terminator for string
 			break
 		}
-		d.FlightMode += string(data[i])
+		d.FlightMode += string(b)
 	}
 
 	//TODO CRC byte?
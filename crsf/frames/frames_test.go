@@ -0,0 +1,201 @@
+package frames
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// frame builds a type, payload and crc frame
+func frame(frameType byte, payload ...byte) []byte {
+	data := append([]byte{frameType}, payload...)
+	return setCrc(append(data, 0))
+}
+
+// fuzzDecoder checks a decoder never panics and that anything it accepts re-encodes to the same bytes
+func fuzzDecoder[T any](f *testing.F, length int, decode func([]byte) (T, error), marshal func(*T) []byte) {
+	f.Add([]byte{})
+	f.Add([]byte{0x00})
+	f.Add(make([]byte, length))
+	f.Add(setCrc(make([]byte, length)))
+	f.Add(setCrc(bytes.Repeat([]byte{0xff}, length)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decoded, err := decode(data)
+		if err != nil || marshal == nil {
+			return
+		}
+		got := marshal(&decoded)
+		if !bytes.Equal(got[1:len(got)-1], data[1:len(data)-1]) { //the type byte, and so the crc, is not checked on decode
+			t.Errorf("re-encoded % x from % x", got, data)
+		}
+	})
+}
+
+func FuzzUnmarshalAttitude(f *testing.F) {
+	fuzzDecoder(f, AttitudeFrameLength, UnmarshalAttitude, (*AttitudeData).Marshal)
+}
+
+func FuzzUnmarshalBarometer(f *testing.F) {
+	fuzzDecoder[BarometerData](f, BarometerFrameLength, UnmarshalBarometer, nil)
+}
+
+func FuzzUnmarshalBatterySensor(f *testing.F) {
+	fuzzDecoder(f, BatterySensorFrameLength, UnmarshalBatterySensor, (*BatterySensorData).Marshal)
+}
+
+func FuzzUnmarshalChannels(f *testing.F) {
+	fuzzDecoder[ChannelsData](f, ChannelsFrameLength, UnmarshalChannels, nil)
+}
+
+func FuzzUnmarshalFlightMode(f *testing.F) {
+	f.Add(frame(0x21, []byte("ACRO\x00")...))
+	fuzzDecoder[FlightModeData](f, FlightModeFrameLength, UnmarshalFlightMode, nil)
+}
+
+func FuzzUnmarshalGps(f *testing.F) {
+	fuzzDecoder(f, GpsFrameLength, UnmarshalGps, (*GpsData).Marshal)
+}
+
+func FuzzUnmarshalLinkRx(f *testing.F) {
+	fuzzDecoder[LinkRxData](f, LinkRxFrameLength, UnmarshalLinkRx, nil)
+}
+
+func FuzzUnmarshalLinkStats(f *testing.F) {
+	fuzzDecoder(f, LinkStatsFrameLength, UnmarshalLinkStats, (*LinkStatsData).Marshal)
+}
+
+func FuzzUnmarshalLinkTx(f *testing.F) {
+	fuzzDecoder[LinkTxData](f, LinkTxFrameLength, UnmarshalLinkTx, nil)
+}
+
+func FuzzUnmarshalRpm(f *testing.F) {
+	f.Add(frame(RpmFrameType, 0x01, 0xff, 0xff, 0x9c, 0x00, 0x10, 0x00))
+	fuzzDecoder(f, RpmMinFrameLength, UnmarshalRpm, (*RpmData).Marshal)
+}
+
+func FuzzUnmarshalTemperature(f *testing.F) {
+	f.Add(frame(TemperatureFrameType, 0x00, 0x01, 0x2c, 0xff, 0xd8))
+	fuzzDecoder(f, TemperatureMinFrameLength, UnmarshalTemperature, (*TemperatureData).Marshal)
+}
+
+func FuzzUnmarshalVario(f *testing.F) {
+	fuzzDecoder[VarioData](f, VarioFrameLength, UnmarshalVario, nil)
+}
+
+func TestValidateFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "empty", data: nil, want: false},
+		{name: "type only", data: []byte{0x1e}, want: false},
+		{name: "valid", data: frame(0x1e, 1, 2, 3, 4, 5, 6), want: true},
+		{name: "bad crc", data: []byte{0x1e, 0x01, 0x00}, want: false},
+	}
+	for _, tc := range tests {
+		got := ValidateFrame(tc.data)
+		if got != tc.want {
+			t.Errorf("%s: got %t want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUnmarshalFlightMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr error
+	}{
+		{name: "terminated", data: frame(0x21, []byte("ACRO\x00")...), want: "ACRO"},
+		{name: "unterminated", data: frame(0x21, []byte("ANGL")...), want: "ANGL"},
+		{name: "padding after terminator", data: frame(0x21, []byte("WAIT\x00!!!")...), want: "WAIT"},
+		{name: "no payload", data: frame(0x21), want: ""},
+		{name: "empty", data: nil, wantErr: ErrFrameLength},
+		{name: "too long", data: frame(0x21, []byte("FLIGHTMODE_LONG")...), wantErr: ErrFrameLength},
+		{name: "bad crc", data: []byte{0x21, 'A', 0x00}, wantErr: ErrInvalidCRC8},
+	}
+	for _, tc := range tests {
+		got, err := UnmarshalFlightMode(tc.data)
+		if err != tc.wantErr {
+			t.Errorf("%s: error got %v want %v", tc.name, err, tc.wantErr)
+			continue
+		}
+		if got.FlightMode != tc.want {
+			t.Errorf("%s: got %q want %q", tc.name, got.FlightMode, tc.want)
+		}
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	attitude := AttitudeData{Pitch: 500, Roll: -31415, Yaw: 12000}
+	gotAttitude, err := UnmarshalAttitude(attitude.Marshal())
+	if err != nil || gotAttitude != attitude {
+		t.Errorf("attitude: got %+v %v", gotAttitude, err)
+	}
+
+	gps := GpsData{Lat: 476205000, Long: -1223493000, Speed: 432, Course: -1, Altitude: 1050, SatelliteCount: 12}
+	gotGps, err := UnmarshalGps(gps.Marshal())
+	if err != nil || gotGps != gps {
+		t.Errorf("gps: got %+v %v", gotGps, err)
+	}
+
+	battery := BatterySensorData{Voltage: 84, Current: -12, Used: 0x123456, Remaining: 73}
+	gotBattery, err := UnmarshalBatterySensor(battery.Marshal())
+	if err != nil || gotBattery != battery {
+		t.Errorf("battery: got %+v %v", gotBattery, err)
+	}
+
+	linkStats := LinkStatsData{UplinkRssiAnt1: 45, UplinkRssiAnt2: 47, UplinkQuality: 100, UplinkSnr: -3, RfMode: 4, Power: 3, DownlinkRssi: 50, DownlinkQuality: 99, DownlinkSnr: 8}
+	gotLinkStats, err := UnmarshalLinkStats(linkStats.Marshal())
+	if err != nil || gotLinkStats != linkStats {
+		t.Errorf("link stats: got %+v %v", gotLinkStats, err)
+	}
+
+	rpm := RpmData{Source: 2, Rpm: []int32{12000, -100, 0x7fffff, -0x800000}}
+	gotRpm, err := UnmarshalRpm(rpm.Marshal())
+	if err != nil || gotRpm.Source != rpm.Source || !slices.Equal(gotRpm.Rpm, rpm.Rpm) {
+		t.Errorf("rpm: got %+v %v", gotRpm, err)
+	}
+
+	temperature := TemperatureData{Source: 1, Temperatures: []int16{300, -40}}
+	gotTemperature, err := UnmarshalTemperature(temperature.Marshal())
+	if err != nil || gotTemperature.Source != temperature.Source || !slices.Equal(gotTemperature.Temperatures, temperature.Temperatures) {
+		t.Errorf("temperature: got %+v %v", gotTemperature, err)
+	}
+}
+
+func TestUnmarshalBatterySensor(t *testing.T) {
+	//16.8V, 2.5A, 1000mAh used, 60% from the wire layout in the crsf spec, every field big-endian
+	data := frame(BatterySensorFrameType, 0x00, 0xa8, 0x00, 0x19, 0x00, 0x03, 0xe8, 0x3c)
+	got, err := UnmarshalBatterySensor(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BatterySensorData{Voltage: 168, Current: 25, Used: 1000, Remaining: 60}
+	if got != want {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+	if !bytes.Equal(want.Marshal(), data) {
+		t.Errorf("marshal got % x want % x", want.Marshal(), data)
+	}
+
+	wantString := "Voltage: 16.8V Current: 25da Used: 1000mAh Remaining: 60%"
+	if got.String() != wantString {
+		t.Errorf("string got %q want %q", got.String(), wantString)
+	}
+}
+
+func TestUnmarshalRpmLength(t *testing.T) {
+	for _, data := range [][]byte{
+		frame(RpmFrameType, 0x00),
+		frame(RpmFrameType, 0x00, 0x01, 0x02),
+		frame(RpmFrameType, append([]byte{0x00}, make([]byte, 3*(RpmMaxValues+1))...)...),
+	} {
+		_, err := UnmarshalRpm(data)
+		if err != ErrFrameLength {
+			t.Errorf("% x: got %v want %v", data, err, ErrFrameLength)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 const (
 	GpsFrameLength = 15 + 2 //Payload + Type + CRC
+	GpsFrameType   = 0x02
 )
 
 type GpsData struct {
@@ -41,6 +42,18 @@ func UnmarshalGps(data []byte) (GpsData, error) {
 	return d, nil
 }
 
+func (d *GpsData) Marshal() []byte {
+	data := make([]byte, GpsFrameLength)
+	data[0] = GpsFrameType
+	binary.BigEndian.PutUint32(data[1:5], uint32(d.Lat))
+	binary.BigEndian.PutUint32(data[5:9], uint32(d.Long))
+	binary.BigEndian.PutUint16(data[9:11], uint16(d.Speed))
+	binary.BigEndian.PutUint16(data[11:13], uint16(d.Course))
+	binary.BigEndian.PutUint16(data[13:15], d.Altitude)
+	data[15] = d.SatelliteCount
+	return setCrc(data)
+}
+
 func (d *GpsData) String() string {
 	lat := float32(d.Lat) / 10000000
 	long := float32(d.Long) / 10000000
@@ -7,6 +7,7 @@ import (
 
 const (
 	LinkStatsFrameLength = 10 + 2 //Payload + Type + CRC
+	LinkStatsFrameType   = 0x14
 )
 
 type LinkStatsData struct {
@@ -46,6 +47,24 @@ func UnmarshalLinkStats(data []byte) (LinkStatsData, error) {
 	return d, nil
 }
 
+func (d *LinkStatsData) Marshal() []byte {
+	data := []byte{
+		LinkStatsFrameType,
+		d.UplinkRssiAnt1,
+		d.UplinkRssiAnt2,
+		d.UplinkQuality,
+		byte(d.UplinkSnr),
+		d.DiversifyActiveAnt,
+		d.RfMode,
+		d.Power,
+		d.DownlinkRssi,
+		d.DownlinkQuality,
+		d.DownlinkSnr,
+		0, //crc
+	}
+	return setCrc(data)
+}
+
 func (d *LinkStatsData) String() string {
 	txRssiAnt1 := int8(d.UplinkRssiAnt1) * -1
 	txRssiAnt2 := int8(d.UplinkRssiAnt2) * -1
@@ -0,0 +1,49 @@
+// https://github.com/crsf-wg/crsf/wiki/CRSF_FRAMETYPE_RPM
+package frames
+
+import (
+	"fmt"
+)
+
+const (
+	RpmMinFrameLength = 1 + 3 + 2 //Source + one value + Type + CRC
+	RpmMaxValues      = 19
+	RpmFrameType      = 0x0C
+)
+
+type RpmData struct {
+	Source uint8   //which motor or sensor this is
+	Rpm    []int32 //int24 big-endian, one per motor, negative when reversing
+}
+
+func UnmarshalRpm(data []byte) (RpmData, error) {
+	d := RpmData{}
+	if len(data) < RpmMinFrameLength || (len(data)-3)%3 != 0 || (len(data)-3)/3 > RpmMaxValues {
+		return d, ErrFrameLength
+	}
+	if !ValidateFrame(data) {
+		return d, ErrInvalidCRC8
+	}
+	//TODO check correct type?
+
+	d.Source = data[1]
+	d.Rpm = make([]int32, 0, (len(data)-3)/3)
+	for i := 2; i+3 < len(data); i += 3 {
+		value := int32(data[i])<<16 | int32(data[i+1])<<8 | int32(data[i+2])
+		d.Rpm = append(d.Rpm, value<<8>>8) //sign extend the int24
+	}
+	return d, nil
+}
+
+func (d *RpmData) Marshal() []byte {
+	data := make([]byte, 0, 3+3*len(d.Rpm))
+	data = append(data, RpmFrameType, d.Source)
+	for _, value := range d.Rpm {
+		data = append(data, byte(value>>16), byte(value>>8), byte(value))
+	}
+	return setCrc(append(data, 0))
+}
+
+func (d *RpmData) String() string {
+	return fmt.Sprintf("Source: %d Rpm: %v", d.Source, d.Rpm)
+}
@@ -0,0 +1,53 @@
+// https://github.com/crsf-wg/crsf/wiki/CRSF_FRAMETYPE_TEMP
+package frames
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	TemperatureMinFrameLength = 1 + 2 + 2 //Source + one value + Type + CRC
+	TemperatureMaxValues      = 20
+	TemperatureFrameType      = 0x0D
+)
+
+type TemperatureData struct {
+	Source       uint8   //which sensor this is
+	Temperatures []int16 //deci-degrees celsius big-endian
+}
+
+func UnmarshalTemperature(data []byte) (TemperatureData, error) {
+	d := TemperatureData{}
+	if len(data) < TemperatureMinFrameLength || (len(data)-3)%2 != 0 || (len(data)-3)/2 > TemperatureMaxValues {
+		return d, ErrFrameLength
+	}
+	if !ValidateFrame(data) {
+		return d, ErrInvalidCRC8
+	}
+	//TODO check correct type?
+
+	d.Source = data[1]
+	d.Temperatures = make([]int16, 0, (len(data)-3)/2)
+	for i := 2; i+2 < len(data); i += 2 {
+		d.Temperatures = append(d.Temperatures, int16(binary.BigEndian.Uint16(data[i:i+2])))
+	}
+	return d, nil
+}
+
+func (d *TemperatureData) Marshal() []byte {
+	data := make([]byte, 0, 3+2*len(d.Temperatures))
+	data = append(data, TemperatureFrameType, d.Source)
+	for _, value := range d.Temperatures {
+		data = binary.BigEndian.AppendUint16(data, uint16(value))
+	}
+	return setCrc(append(data, 0))
+}
+
+func (d *TemperatureData) String() string {
+	temperatures := make([]float64, len(d.Temperatures))
+	for i := range d.Temperatures {
+		temperatures[i] = float64(d.Temperatures[i]) / 10
+	}
+	return fmt.Sprintf("Source: %d Temperatures: %vC", d.Source, temperatures)
+}
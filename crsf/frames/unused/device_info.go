@@ -3,11 +3,10 @@ package frames
 
 import (
 	"encoding/binary"
-	"fmt"
 )
 
 const (
-	DeviceInfoFrameLength = 2 + 2 + 2 //Payload + Type + CRC + dest + src
+	DeviceInfoMinFrameLength = 1 + 2 + 1 + 14 + 1 //Type + dest + src + name terminator + fields + CRC
 )
 
 type DeviceInfoData struct {
@@ -24,8 +23,8 @@ type DeviceInfoData struct {
 
 func UnmarshalDeviceInfo(data []byte) (DeviceInfoData, error) {
 	d := DeviceInfoData{}
-	if len(data) != DeviceInfoFrameLength {
-		return d, fmt.Errorf("incorrect frame length")
+	if len(data) < DeviceInfoMinFrameLength {
+		return d, ErrFrameLength
 	}
 	//TODO check correct type?
 
@@ -33,14 +32,17 @@ func UnmarshalDeviceInfo(data []byte) (DeviceInfoData, error) {
 	d.Source = data[2]
 
 	i := 3
-	for i = 3; i < len(data)-1; i++ {
-		if i == 0x00 { //null terminator for string
+	for ; i < len(data)-1; i++ {
+		if data[i] == 0x00 { //null terminator for string
 			break
 		}
 		d.Name += string(data[i])
 	}
 
 	nextByte := i + 1
+	if len(data)-1-nextByte < 14 { //name left no room for the fields
+		return d, ErrFrameLength
+	}
 
 	d.Serial = binary.LittleEndian.Uint32(data[nextByte : nextByte+4])
 	d.HWVersion = binary.LittleEndian.Uint32(data[nextByte+4 : nextByte+8])
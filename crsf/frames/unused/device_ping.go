@@ -1,10 +1,6 @@
 // https://github.com/crsf-wg/crsf/wiki/CRSF_FRAMETYPE_DEVICE_PING
 package frames
 
-import (
-	"fmt"
-)
-
 const (
 	DevicePingFrameLength = 2 + 2 //Payload + Type + CRC
 )
@@ -17,7 +13,7 @@ type DevicePingData struct {
 func UnmarshalDevicePing(data []byte) (DevicePingData, error) {
 	d := DevicePingData{}
 	if len(data) != DevicePingFrameLength {
-		return d, fmt.Errorf("incorrect frame length")
+		return d, ErrFrameLength
 	}
 	//TODO check correct type?
 
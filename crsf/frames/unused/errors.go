@@ -0,0 +1,5 @@
+package frames
+
+import "fmt"
+
+var ErrFrameLength = fmt.Errorf("incorrect frame length")
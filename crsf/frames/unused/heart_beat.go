@@ -3,7 +3,6 @@ package frames
 
 import (
 	"encoding/binary"
-	"fmt"
 )
 
 const (
@@ -17,7 +16,7 @@ type HeartBeatData struct {
 func UnmarshalHeartBeat(data []byte) (HeartBeatData, error) {
 	d := HeartBeatData{}
 	if len(data) != HeartBeatFrameLength {
-		return d, fmt.Errorf("incorrect frame length")
+		return d, ErrFrameLength
 	}
 	//TODO check correct type?
 
@@ -0,0 +1,83 @@
+package frames
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func FuzzUnmarshalDeviceInfo(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(make([]byte, DeviceInfoMinFrameLength))
+	f.Add(deviceInfoFrame("ELRS RX"))
+	f.Add(append([]byte{0x29, 0xea, 0xee}, []byte("NO TERMINATOR AT ALL")...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		UnmarshalDeviceInfo(data)
+	})
+}
+
+func FuzzUnmarshalDevicePing(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x28, 0xea, 0xee, 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		UnmarshalDevicePing(data)
+	})
+}
+
+func FuzzUnmarshalHeartBeat(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x0b, 0x00, 0xc8, 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		UnmarshalHeartBeat(data)
+	})
+}
+
+func FuzzUnmarshalOpenTxSync(f *testing.F) {
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		UnmarshalOpenTxSync(data)
+	})
+}
+
+func FuzzUnmarshalRequestSettings(f *testing.F) {
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		UnmarshalRequestSettings(data)
+	})
+}
+
+// deviceInfoFrame builds a device info frame with a fixed serial and versions, the crc is left as 0
+func deviceInfoFrame(name string) []byte {
+	data := append([]byte{0x29, 0xea, 0xee}, []byte(name)...)
+	data = append(data, 0x00)
+	data = binary.LittleEndian.AppendUint32(data, 0x454c5253)
+	data = binary.LittleEndian.AppendUint32(data, 1)
+	data = binary.LittleEndian.AppendUint32(data, 0x030201)
+	return append(data, 12, 3, 0x00)
+}
+
+func TestUnmarshalDeviceInfo(t *testing.T) {
+	got, err := UnmarshalDeviceInfo(deviceInfoFrame("ELRS RX"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeviceInfoData{
+		Destination:  0xea,
+		Source:       0xee,
+		Name:         "ELRS RX",
+		Serial:       0x454c5253,
+		HWVersion:    1,
+		SWVersion:    0x030201,
+		ParamCount:   12,
+		ProtoVersion: 3,
+	}
+	if got != want {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+
+	short := deviceInfoFrame("ELRS RX")
+	short = append(short[:len(short)-5], 0x00)
+	_, err = UnmarshalDeviceInfo(short)
+	if err != ErrFrameLength {
+		t.Errorf("short fields: got %v want %v", err, ErrFrameLength)
+	}
+}
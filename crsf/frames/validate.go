@@ -29,6 +29,15 @@ func GenerateCrc8Value(data []uint8) uint8 {
 
 func ValidateFrame(frame []uint8) bool {
 	frameSize := len(frame)
+	if frameSize < 2 { //needs at least a type and crc
+		return false
+	}
 	crc := GenerateCrc8Value(frame[0 : frameSize-1])
 	return crc == frame[frameSize-1]
 }
+
+// setCrc fills the last byte of a frame with the crc of everything before it
+func setCrc(frame []uint8) []uint8 {
+	frame[len(frame)-1] = GenerateCrc8Value(frame[:len(frame)-1])
+	return frame
+}
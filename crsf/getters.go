@@ -1,6 +1,10 @@
 package crsf
 
-import "github.com/Speshl/pi_drift_wheel/crsf/frames"
+import (
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+)
 
 func (c *CRSF) GetData() CRSFData {
 	c.dataLock.RLock()
@@ -32,6 +36,18 @@ func (c *CRSF) GetBarometer() frames.BarometerData {
 	return c.data.Barometer
 }
 
+func (c *CRSF) GetRpm() frames.RpmData {
+	c.dataLock.RLock()
+	defer c.dataLock.RUnlock()
+	return c.data.Rpm
+}
+
+func (c *CRSF) GetTemperature() frames.TemperatureData {
+	c.dataLock.RLock()
+	defer c.dataLock.RUnlock()
+	return c.data.Temperature
+}
+
 func (c *CRSF) GetLinkStats() frames.LinkStatsData {
 	c.dataLock.RLock()
 	defer c.dataLock.RUnlock()
@@ -67,3 +83,31 @@ func (c *CRSF) GetFlightMode() frames.FlightModeData {
 	defer c.dataLock.RUnlock()
 	return c.data.FlightMode
 }
+
+// LastReceived is when the last frame parsed successfully, zero if none have
+func (c *CRSF) LastReceived() time.Time {
+	c.dataLock.RLock()
+	defer c.dataLock.RUnlock()
+	return c.lastReceived
+}
+
+// ChannelsReceived is when the last channels frame arrived, zero if none have
+func (c *CRSF) ChannelsReceived() time.Time {
+	c.dataLock.RLock()
+	defer c.dataLock.RUnlock()
+	return c.channelsTime
+}
+
+// LinkStatsReceived is when the last link stats frame arrived, zero if none have
+func (c *CRSF) LinkStatsReceived() time.Time {
+	c.dataLock.RLock()
+	defer c.dataLock.RUnlock()
+	return c.linkTime
+}
+
+// AttitudeSample is the last attitude frame and when it arrived, zero if none have
+func (c *CRSF) AttitudeSample() (frames.AttitudeData, time.Time) {
+	c.dataLock.RLock()
+	defer c.dataLock.RUnlock()
+	return c.data.Attitude, c.attitudeTime
+}
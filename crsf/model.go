@@ -19,6 +19,8 @@ GPS = 0x02
 Vario = 0x07
 BatterySensor = 0x08
 Barometer = 0x09
+RPM = 0x0C
+Temperature = 0x0D
 LinkStats = 0x14
 Channels = 0x16
 ChannelSubSet = 0x17
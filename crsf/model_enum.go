@@ -74,38 +74,44 @@ const (
 	FrameTypeBatterySensor
 	// FrameTypeBarometer is a FrameType of type Barometer.
 	FrameTypeBarometer
+	// FrameTypeRPM is a FrameType of type RPM.
+	FrameTypeRPM FrameType = iota + 8
+	// FrameTypeTemperature is a FrameType of type Temperature.
+	FrameTypeTemperature
 	// FrameTypeLinkStats is a FrameType of type LinkStats.
-	FrameTypeLinkStats FrameType = iota + 16
+	FrameTypeLinkStats FrameType = iota + 14
 	// FrameTypeChannels is a FrameType of type Channels.
-	FrameTypeChannels FrameType = iota + 17
+	FrameTypeChannels FrameType = iota + 15
 	// FrameTypeChannelSubSet is a FrameType of type ChannelSubSet.
 	FrameTypeChannelSubSet
 	// FrameTypeLinkRx is a FrameType of type LinkRx.
-	FrameTypeLinkRx FrameType = iota + 21
+	FrameTypeLinkRx FrameType = iota + 19
 	// FrameTypeLinkTx is a FrameType of type LinkTx.
 	FrameTypeLinkTx
 	// FrameTypeAttitude is a FrameType of type Attitude.
 	FrameTypeAttitude
 	// FrameTypeFlightMode is a FrameType of type FlightMode.
-	FrameTypeFlightMode FrameType = iota + 23
+	FrameTypeFlightMode FrameType = iota + 21
 )
 
 var ErrInvalidFrameType = errors.New("not a valid FrameType")
 
-const _FrameTypeName = "GPSVarioBatterySensorBarometerLinkStatsChannelsChannelSubSetLinkRxLinkTxAttitudeFlightMode"
+const _FrameTypeName = "GPSVarioBatterySensorBarometerRPMTemperatureLinkStatsChannelsChannelSubSetLinkRxLinkTxAttitudeFlightMode"
 
 var _FrameTypeMap = map[FrameType]string{
 	FrameTypeGPS:           _FrameTypeName[0:3],
 	FrameTypeVario:         _FrameTypeName[3:8],
 	FrameTypeBatterySensor: _FrameTypeName[8:21],
 	FrameTypeBarometer:     _FrameTypeName[21:30],
-	FrameTypeLinkStats:     _FrameTypeName[30:39],
-	FrameTypeChannels:      _FrameTypeName[39:47],
-	FrameTypeChannelSubSet: _FrameTypeName[47:60],
-	FrameTypeLinkRx:        _FrameTypeName[60:66],
-	FrameTypeLinkTx:        _FrameTypeName[66:72],
-	FrameTypeAttitude:      _FrameTypeName[72:80],
-	FrameTypeFlightMode:    _FrameTypeName[80:90],
+	FrameTypeRPM:           _FrameTypeName[30:33],
+	FrameTypeTemperature:   _FrameTypeName[33:44],
+	FrameTypeLinkStats:     _FrameTypeName[44:53],
+	FrameTypeChannels:      _FrameTypeName[53:61],
+	FrameTypeChannelSubSet: _FrameTypeName[61:74],
+	FrameTypeLinkRx:        _FrameTypeName[74:80],
+	FrameTypeLinkTx:        _FrameTypeName[80:86],
+	FrameTypeAttitude:      _FrameTypeName[86:94],
+	FrameTypeFlightMode:    _FrameTypeName[94:104],
 }
 
 // String implements the Stringer interface.
@@ -124,17 +130,19 @@ func (x FrameType) IsValid() bool {
 }
 
 var _FrameTypeValue = map[string]FrameType{
-	_FrameTypeName[0:3]:   FrameTypeGPS,
-	_FrameTypeName[3:8]:   FrameTypeVario,
-	_FrameTypeName[8:21]:  FrameTypeBatterySensor,
-	_FrameTypeName[21:30]: FrameTypeBarometer,
-	_FrameTypeName[30:39]: FrameTypeLinkStats,
-	_FrameTypeName[39:47]: FrameTypeChannels,
-	_FrameTypeName[47:60]: FrameTypeChannelSubSet,
-	_FrameTypeName[60:66]: FrameTypeLinkRx,
-	_FrameTypeName[66:72]: FrameTypeLinkTx,
-	_FrameTypeName[72:80]: FrameTypeAttitude,
-	_FrameTypeName[80:90]: FrameTypeFlightMode,
+	_FrameTypeName[0:3]:    FrameTypeGPS,
+	_FrameTypeName[3:8]:    FrameTypeVario,
+	_FrameTypeName[8:21]:   FrameTypeBatterySensor,
+	_FrameTypeName[21:30]:  FrameTypeBarometer,
+	_FrameTypeName[30:33]:  FrameTypeRPM,
+	_FrameTypeName[33:44]:  FrameTypeTemperature,
+	_FrameTypeName[44:53]:  FrameTypeLinkStats,
+	_FrameTypeName[53:61]:  FrameTypeChannels,
+	_FrameTypeName[61:74]:  FrameTypeChannelSubSet,
+	_FrameTypeName[74:80]:  FrameTypeLinkRx,
+	_FrameTypeName[80:86]:  FrameTypeLinkTx,
+	_FrameTypeName[86:94]:  FrameTypeAttitude,
+	_FrameTypeName[94:104]: FrameTypeFlightMode,
 }
 
 // ParseFrameType attempts to convert a string to a FrameType.
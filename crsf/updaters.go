@@ -2,6 +2,7 @@ package crsf
 
 import (
 	"log/slog"
+	"time"
 
 	"github.com/Speshl/pi_drift_wheel/crsf/frames"
 )
@@ -12,6 +13,12 @@ func (c *CRSF) SetData(data CRSFData) {
 	c.data = data
 }
 
+func (c *CRSF) setLastReceived(t time.Time) {
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+	c.lastReceived = t
+}
+
 func (c *CRSF) updateGps(data []byte) error {
 	dataStruct, err := frames.UnmarshalGps(data)
 	if err != nil {
@@ -72,6 +79,36 @@ func (c *CRSF) SetBarometer(data frames.BarometerData) {
 	c.data.Barometer = data
 }
 
+func (c *CRSF) updateRpm(data []byte) error {
+	dataStruct, err := frames.UnmarshalRpm(data)
+	if err != nil {
+		return err
+	}
+	c.SetRpm(dataStruct)
+	return nil
+}
+
+func (c *CRSF) SetRpm(data frames.RpmData) {
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+	c.data.Rpm = data
+}
+
+func (c *CRSF) updateTemperature(data []byte) error {
+	dataStruct, err := frames.UnmarshalTemperature(data)
+	if err != nil {
+		return err
+	}
+	c.SetTemperature(dataStruct)
+	return nil
+}
+
+func (c *CRSF) SetTemperature(data frames.TemperatureData) {
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+	c.data.Temperature = data
+}
+
 // func (c *CRSF) updateOpenTxSync(data []byte) error {
 // 	dataStruct, err := frames.UnmarshalOpenTxSync(data)
 // 	if err != nil {
@@ -100,6 +137,7 @@ func (c *CRSF) SetLinkStats(data frames.LinkStatsData) {
 	c.dataLock.Lock()
 	defer c.dataLock.Unlock()
 	c.data.LinkStats = data
+	c.linkTime = time.Now()
 }
 
 func (c *CRSF) updateChannels(data []byte) error {
@@ -112,10 +150,11 @@ func (c *CRSF) updateChannels(data []byte) error {
 }
 
 func (c *CRSF) SetChannels(data frames.ChannelsData) {
-	slog.Info("setting channels", "data", data.String())
+	slog.Debug("setting channels", "data", data.String())
 	c.dataLock.Lock()
 	defer c.dataLock.Unlock()
 	c.data.Channels = data
+	c.channelsTime = time.Now()
 }
 
 func (c *CRSF) updateLinkRx(data []byte) error {
@@ -161,6 +200,7 @@ func (c *CRSF) SetAttitude(data frames.AttitudeData) {
 	c.dataLock.Lock()
 	defer c.dataLock.Unlock()
 	c.data.Attitude = data
+	c.attitudeTime = time.Now()
 }
 
 func (c *CRSF) updateFlightMode(data []byte) error {
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/recorder"
+	"github.com/Speshl/pi_drift_wheel/replay"
+)
+
+// RunCommand replays a session log and writes a csv row per tick plus a gpx track of the gps samples
+func RunCommand(ctx context.Context, args []string) error {
+	cfg := config.GetConfig()
+
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi_drift_wheel export [flags] session.pdwrec")
+		flags.PrintDefaults()
+	}
+	profileName := flags.String("profile", "", "profile to mix with, defaults to the selected profile")
+	stateDir := flags.String("state-dir", cfg.AppCfg.StateDir, "directory holding profiles and trims")
+	csvPath := flags.String("csv", "", "csv output, defaults to the session path with .csv")
+	gpxPath := flags.String("gpx", "", "gpx output, defaults to the session path with .gpx")
+	replayed := flags.Bool("replayed", false, "add columns with the session re-mixed using the profile and trims")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one session log")
+	}
+	sessionPath := flags.Arg(0)
+	basePath := strings.TrimSuffix(sessionPath, recorder.FileExtension)
+	if *csvPath == "" {
+		*csvPath = basePath + ".csv"
+	}
+	if *gpxPath == "" {
+		*gpxPath = basePath + ".gpx"
+	}
+
+	cfg.AppCfg.StateDir = *stateDir
+	opts, err := replay.LoadOptions(cfg, *profileName)
+	if err != nil {
+		return err
+	}
+	opts.Controllers, err = replay.ScanControllers(sessionPath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(sessionPath)
+	if err != nil {
+		return fmt.Errorf("failed opening session: %w", err)
+	}
+	defer file.Close()
+	reader, err := recorder.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed reading session %s: %w", sessionPath, err)
+	}
+
+	csvFile, err := os.Create(*csvPath)
+	if err != nil {
+		return fmt.Errorf("failed creating csv: %w", err)
+	}
+	defer csvFile.Close()
+	csvBuffer := bufio.NewWriter(csvFile)
+	csvWriter, err := NewCSVWriter(csvBuffer, *replayed)
+	if err != nil {
+		return err
+	}
+
+	track := NewGPXTrack(filepath.Base(basePath))
+	var lastGps time.Time
+	ticks := 0
+	err = replay.NewPlayer(reader, opts).Run(ctx, func(tick replay.Tick) error {
+		//every recorded output gets a row, even when it could not be re-mixed
+		ticks++
+		if !tick.GpsTime.IsZero() && tick.GpsTime != lastGps { //one point per gps frame, not per tick
+			lastGps = tick.GpsTime
+			track.Add(tick.GpsTime, tick.Telemetry.Gps)
+		}
+		return csvWriter.WriteTick(tick)
+	})
+	if err != nil {
+		return err
+	}
+	err = csvWriter.Flush()
+	if err != nil {
+		return fmt.Errorf("failed writing csv: %w", err)
+	}
+	err = csvBuffer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed writing csv: %w", err)
+	}
+
+	gpxFile, err := os.Create(*gpxPath)
+	if err != nil {
+		return fmt.Errorf("failed creating gpx: %w", err)
+	}
+	defer gpxFile.Close()
+	_, err = track.WriteTo(gpxFile)
+	if err != nil {
+		return fmt.Errorf("failed writing gpx: %w", err)
+	}
+
+	slog.Info("exported session", "path", sessionPath, "ticks", ticks, "gps_points", track.Len(), "csv", *csvPath, "gpx", *gpxPath)
+	return nil
+}
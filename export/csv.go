@@ -0,0 +1,116 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/replay"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+// CSVWriter writes one row per processing tick. Channel columns are the frames the car was sent
+type CSVWriter struct {
+	writer   *csv.Writer
+	replayed bool //also write the frames re-mixed with the current profile
+}
+
+func NewCSVWriter(w io.Writer, replayed bool) (*CSVWriter, error) {
+	c := &CSVWriter{
+		writer:   csv.NewWriter(w),
+		replayed: replayed,
+	}
+	header := []string{"time", "offset_ms", "steer", "throttle", "brake", "gear", "esc"}
+	for i := 0; i < sbus.MaxChannels; i++ {
+		header = append(header, fmt.Sprintf("ch%d", i))
+	}
+	if replayed {
+		for i := 0; i < sbus.MaxChannels; i++ {
+			header = append(header, fmt.Sprintf("replayed_ch%d", i))
+		}
+		header = append(header, "match")
+	}
+	header = append(header,
+		"lat", "long", "speed_kmh", "course", "altitude_m", "satellites",
+		"pitch", "roll", "yaw",
+		"uplink_quality", "uplink_rssi", "uplink_snr", "downlink_quality", "downlink_rssi",
+	)
+	err := c.writer.Write(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed writing csv header: %w", err)
+	}
+	return c, nil
+}
+
+func (c *CSVWriter) WriteTick(tick replay.Tick) error {
+	row := make([]string, 0, 65)
+	row = append(row,
+		tick.Time.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(float64(tick.Offset.Microseconds())/1000, 'f', 3, 64),
+		strconv.Itoa(inputPercent(tick.Inputs, "steer", -100)),
+		strconv.Itoa(inputPercent(tick.Inputs, "throttle", 0)),
+		strconv.Itoa(inputPercent(tick.Inputs, "brake", 0)),
+		strconv.Itoa(tick.MixState.Gear),
+		tick.MixState.Esc,
+	)
+	for _, value := range tick.Recorded.Frame.Ch {
+		row = append(row, strconv.Itoa(int(value)))
+	}
+	if c.replayed {
+		for _, value := range tick.Replayed.Frame.Ch { //all 0 when the tick could not be re-mixed
+			row = append(row, strconv.Itoa(int(value)))
+		}
+		row = append(row, strconv.FormatBool(tick.Match))
+	}
+
+	gps := tick.Telemetry.Gps
+	attitude := tick.Telemetry.Attitude
+	link := tick.Telemetry.LinkStats
+	row = append(row,
+		formatDegrees(gps.Lat),
+		formatDegrees(gps.Long),
+		strconv.FormatFloat(float64(gps.Speed)/10, 'f', 1, 64),
+		strconv.FormatFloat(float64(gps.Course)/100, 'f', 2, 64),
+		strconv.Itoa(int(gps.Altitude)-1000),
+		strconv.Itoa(int(gps.SatelliteCount)),
+		formatRadians(attitude.Pitch),
+		formatRadians(attitude.Roll),
+		formatRadians(attitude.Yaw),
+		strconv.Itoa(int(link.UplinkQuality)),
+		strconv.Itoa(-int(link.UplinkRssiAnt1)),
+		strconv.Itoa(int(link.UplinkSnr)),
+		strconv.Itoa(int(link.DownlinkQuality)),
+		strconv.Itoa(-int(link.DownlinkRssi)),
+	)
+	return c.writer.Write(row)
+}
+
+func (c *CSVWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// inputPercent scales the labeled input to minReturn..100
+func inputPercent(inputs []models.Input, label string, minReturn int) int {
+	for i := range inputs {
+		if inputs[i].Label != label {
+			continue
+		}
+		if inputs[i].Max == inputs[i].Min {
+			return minReturn
+		}
+		return models.MapToRange(inputs[i].Value, inputs[i].Min, inputs[i].Max, minReturn, 100)
+	}
+	return minReturn
+}
+
+func formatDegrees(value int32) string {
+	return strconv.FormatFloat(float64(value)/10000000, 'f', 7, 64)
+}
+
+func formatRadians(value int16) string {
+	return strconv.FormatFloat(float64(value)/10000, 'f', 4, 64)
+}
@@ -0,0 +1,60 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"testing"
+
+	"github.com/Speshl/pi_drift_wheel/replay"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+func TestCSVWriterUsesRecordedFrames(t *testing.T) {
+	recorded := sbus.NewSBusFrame()
+	recorded.Frame.Ch[0] = 1500
+	replayed := sbus.NewSBusFrame()
+	replayed.Frame.Ch[0] = 1200
+
+	for _, withReplayed := range []bool{false, true} {
+		var buf bytes.Buffer
+		writer, err := NewCSVWriter(&buf, withReplayed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.WriteTick(replay.Tick{Recorded: recorded, Replayed: replayed})
+		if err == nil {
+			err = writer.WriteTick(replay.Tick{Recorded: recorded, Err: errors.New("no controllers loaded")})
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 {
+			t.Fatalf("replayed %t: got %d rows want a header and 2 ticks", withReplayed, len(rows))
+		}
+		column := make(map[string]int, len(rows[0]))
+		for i, name := range rows[0] {
+			column[name] = i
+		}
+		for _, row := range rows[1:] {
+			if row[column["ch0"]] != "1500" {
+				t.Errorf("replayed %t: ch0 got %s want the recorded 1500", withReplayed, row[column["ch0"]])
+			}
+		}
+		_, ok := column["replayed_ch0"]
+		if ok != withReplayed {
+			t.Errorf("replayed %t: replayed columns present %t", withReplayed, ok)
+		}
+		if withReplayed && rows[1][column["replayed_ch0"]] != "1200" {
+			t.Errorf("replayed_ch0 got %s want 1200", rows[1][column["replayed_ch0"]])
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+)
+
+// https://www.topografix.com/GPX/1/1/
+type gpx struct {
+	XMLName xml.Name `xml:"gpx"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Track   gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name    string          `xml:"name"`
+	Segment gpxTrackSegment `xml:"trkseg"`
+}
+
+type gpxTrackSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat       float64 `xml:"lat,attr"`
+	Lon       float64 `xml:"lon,attr"`
+	Elevation int     `xml:"ele"`
+	Time      string  `xml:"time"`
+	Sats      uint8   `xml:"sat"` //speed and course are not part of gpx 1.1, they are in the csv
+}
+
+// GPXTrack collects gps samples into a single track segment
+type GPXTrack struct {
+	name   string
+	points []gpxPoint
+}
+
+func NewGPXTrack(name string) *GPXTrack {
+	return &GPXTrack{
+		name:   name,
+		points: make([]gpxPoint, 0, 1024),
+	}
+}
+
+// Add skips samples without a fix
+func (g *GPXTrack) Add(t time.Time, gps frames.GpsData) {
+	if gps.SatelliteCount == 0 || (gps.Lat == 0 && gps.Long == 0) {
+		return
+	}
+	g.points = append(g.points, gpxPoint{
+		Lat:       float64(gps.Lat) / 10000000,
+		Lon:       float64(gps.Long) / 10000000,
+		Elevation: int(gps.Altitude) - 1000,
+		Time:      t.UTC().Format(time.RFC3339Nano),
+		Sats:      gps.SatelliteCount,
+	})
+}
+
+func (g *GPXTrack) Len() int {
+	return len(g.points)
+}
+
+func (g *GPXTrack) WriteTo(w io.Writer) (int64, error) {
+	doc := gpx{
+		Version: "1.1",
+		Creator: "pi_drift_wheel",
+		XMLNS:   "http://www.topografix.com/GPX/1/1",
+		Track: gpxTrack{
+			Name:    g.name,
+			Segment: gpxTrackSegment{Points: g.points},
+		},
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed encoding gpx: %w", err)
+	}
+	n, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(append(data, '\n'))
+	return int64(n + m), err
+}
@@ -1,7 +1,7 @@
 package evdev
 
 /*
-  #include "ff.c"
+  #include "ff.h"
 */
 import "C"
 
@@ -19,6 +19,7 @@ type InputDevice struct {
 	file          *os.File
 	driverVersion int32
 	firstFF       bool
+	ffID          int16
 }
 
 // Open creates a new InputDevice from the given path. Returns an error if
@@ -268,13 +269,37 @@ func (d *InputDevice) WriteOne(event *InputEvent) error {
 
 // TESTING forcefeedback
 func (d *InputDevice) UploadEffect(level int16) error {
-	_, err := C.upload_effect(C.uintptr_t(d.file.Fd()), C.int16_t(level), C.bool(d.firstFF))
+	id, err := C.upload_effect(C.uintptr_t(d.file.Fd()), C.int16_t(level), C.bool(d.firstFF))
 	if err != nil {
 		return err
 	}
+	if id >= 0 {
+		d.ffID = int16(id)
+	}
 
 	if !d.firstFF {
 		d.firstFF = true
 	}
 	return err
 }
+
+// StopEffect stops the effect started by UploadEffect
+func (d *InputDevice) StopEffect() error {
+	if !d.firstFF {
+		return nil
+	}
+	return d.WriteOne(&InputEvent{Type: EV_FF, Code: EvCode(d.ffID), Value: 0})
+}
+
+// EraseEffect removes the effect uploaded by UploadEffect from the device, the next upload creates a new one
+func (d *InputDevice) EraseEffect() error {
+	if !d.firstFF {
+		return nil
+	}
+	err := ioctlEVIOCRMFF(d.file.Fd(), d.ffID)
+	if err != nil {
+		return err
+	}
+	d.firstFF = false
+	return nil
+}
@@ -287,3 +287,14 @@ func ioctlUIDEVDESTROY(fd uintptr) error {
 	code := ioctlMakeCode(ioctlDirNone, 'U', 2, 0)
 	return doIoctl(fd, code, nil)
 }
+
+// ioctlEVIOCRMFF takes the effect id as the argument itself, not a pointer to it
+func ioctlEVIOCRMFF(fd uintptr, id int16) error {
+	var p int32
+	code := ioctlMakeCode(ioctlDirWrite, 'E', 0x81, unsafe.Sizeof(p))
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(code), uintptr(id))
+	if errno != 0 {
+		return errors.New(errno.Error())
+	}
+	return nil
+}
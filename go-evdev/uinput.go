@@ -17,7 +17,23 @@ const (
 // If set up fails the device will be removed from the system,
 // once set up it can be removed by calling dev.Close
 func CreateDevice(name string, id InputID, capabilities map[EvType][]EvCode) (*InputDevice, error) {
-	deviceFile, err := os.OpenFile("/dev/uinput", syscall.O_WRONLY|syscall.O_NONBLOCK, 0660)
+	return CreateDeviceWithOptions(name, id, capabilities, UinputOptions{})
+}
+
+// UinputOptions are the optional parts of a created device
+type UinputOptions struct {
+	AbsInfos   map[EvCode]AbsInfo //axis ranges, axes left out report 0-0
+	EffectsMax uint32             //force feedback effect slots, requests are then read back with ReadOne
+}
+
+// CreateDeviceWithOptions is CreateDevice with axis ranges and force feedback slots.
+// A device with force feedback is opened read/write so upload and erase requests can be answered
+func CreateDeviceWithOptions(name string, id InputID, capabilities map[EvType][]EvCode, opts UinputOptions) (*InputDevice, error) {
+	flags := syscall.O_WRONLY | syscall.O_NONBLOCK
+	if opts.EffectsMax > 0 {
+		flags = syscall.O_RDWR | syscall.O_NONBLOCK
+	}
+	deviceFile, err := os.OpenFile("/dev/uinput", flags, 0660)
 	if err != nil {
 		return nil, err
 	}
@@ -38,10 +54,23 @@ func CreateDevice(name string, id InputID, capabilities map[EvType][]EvCode) (*I
 		}
 	}
 
-	if _, err = createInputDevice(newDev.file, UinputUserDevice{
-		Name: toUinputName([]byte(name)),
-		ID:   id,
-	}); err != nil {
+	userDevice := UinputUserDevice{
+		Name:       toUinputName([]byte(name)),
+		ID:         id,
+		EffectsMax: opts.EffectsMax,
+	}
+	for code, info := range opts.AbsInfos {
+		if int(code) >= absSize {
+			DestroyDevice(newDev)
+			return nil, fmt.Errorf("abs code out of range: %d", code)
+		}
+		userDevice.Absmin[code] = info.Minimum
+		userDevice.Absmax[code] = info.Maximum
+		userDevice.Absfuzz[code] = info.Fuzz
+		userDevice.Absflat[code] = info.Flat
+	}
+
+	if _, err = createInputDevice(newDev.file, userDevice); err != nil {
 		DestroyDevice(newDev)
 		return nil, fmt.Errorf("failed to create device: %w", err)
 	}
@@ -0,0 +1,91 @@
+package evdev
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// Events a uinput device reads back when a client uploads or erases an effect
+const (
+	EV_UINPUT    = 0x0101
+	UI_FF_UPLOAD = 1
+	UI_FF_ERASE  = 2
+)
+
+// struct ff_effect is 16 bytes of header then a union whose biggest member ends in a pointer
+const ffEffectSize = 16 + 24 + int(unsafe.Sizeof(uintptr(0)))
+
+type uinputFFUpload struct {
+	RequestID uint32
+	Retval    int32
+	Effect    [ffEffectSize]byte
+	Old       [ffEffectSize]byte
+}
+
+type uinputFFErase struct {
+	RequestID uint32
+	Retval    int32
+	EffectID  uint32
+}
+
+// HandleFFUpload answers a UI_FF_UPLOAD request (the event value is the request id) and returns the effect.
+// Only the constant level is decoded from the effect union
+func (d *InputDevice) HandleFFUpload(requestID uint32) (Effect, error) {
+	upload := uinputFFUpload{RequestID: requestID}
+	code := ioctlMakeCode(ioctlDirRead|ioctlDirWrite, 'U', 200, unsafe.Sizeof(upload))
+	err := doIoctl(d.file.Fd(), code, unsafe.Pointer(&upload))
+	if err != nil {
+		return Effect{}, fmt.Errorf("failed beginning ff upload: %w", err)
+	}
+
+	raw := upload.Effect[:]
+	effect := Effect{
+		Type:      binary.LittleEndian.Uint16(raw[0:2]),
+		Id:        int16(binary.LittleEndian.Uint16(raw[2:4])),
+		Direction: binary.LittleEndian.Uint16(raw[4:6]),
+		Trigger: Trigger{
+			Button:   binary.LittleEndian.Uint16(raw[6:8]),
+			Interval: binary.LittleEndian.Uint16(raw[8:10]),
+		},
+		Replay: Replay{
+			Length: binary.LittleEndian.Uint16(raw[10:12]),
+			Delay:  binary.LittleEndian.Uint16(raw[12:14]),
+		},
+	}
+	if effect.Type == FF_CONSTANT {
+		effect.EffectType.Constant.Level = int16(binary.LittleEndian.Uint16(raw[16:18]))
+	}
+
+	upload.Retval = 0
+	code = ioctlMakeCode(ioctlDirWrite, 'U', 201, unsafe.Sizeof(upload))
+	err = doIoctl(d.file.Fd(), code, unsafe.Pointer(&upload))
+	if err != nil {
+		return effect, fmt.Errorf("failed ending ff upload: %w", err)
+	}
+	return effect, nil
+}
+
+// HandleFFErase answers a UI_FF_ERASE request and returns the erased effect id
+func (d *InputDevice) HandleFFErase(requestID uint32) (int16, error) {
+	erase := uinputFFErase{RequestID: requestID}
+	code := ioctlMakeCode(ioctlDirRead|ioctlDirWrite, 'U', 202, unsafe.Sizeof(erase))
+	err := doIoctl(d.file.Fd(), code, unsafe.Pointer(&erase))
+	if err != nil {
+		return 0, fmt.Errorf("failed beginning ff erase: %w", err)
+	}
+
+	erase.Retval = 0
+	code = ioctlMakeCode(ioctlDirWrite, 'U', 203, unsafe.Sizeof(erase))
+	err = doIoctl(d.file.Fd(), code, unsafe.Pointer(&erase))
+	if err != nil {
+		return int16(erase.EffectID), fmt.Errorf("failed ending ff erase: %w", err)
+	}
+	return int16(erase.EffectID), nil
+}
+
+// SetReadDeadline lets ReadOne give up so a reader can check for shutdown
+func (d *InputDevice) SetReadDeadline(t time.Time) error {
+	return d.file.SetReadDeadline(t)
+}
@@ -2,7 +2,11 @@ module github.com/Speshl/pi_drift_wheel
 
 go 1.21.1
 
-require golang.org/x/sync v0.5.0
+require (
+	golang.org/x/net v0.19.0
+	golang.org/x/sync v0.5.0
+	golang.org/x/sys v0.15.0
+)
 
 require (
 	//github.com/Speshl/go-sbus v0.0.0-20231226015654-ecc618c72cef
@@ -12,8 +16,6 @@ require (
 
 require (
 	github.com/creack/goselect v0.1.2 // indirect
-	go.bug.st/serial v1.6.1 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.9.0 // indirect
-	golang.org/x/sys v0.5.0 // indirect
 )
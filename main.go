@@ -3,13 +3,21 @@ package main
 import (
 	"context"
 	"log/slog"
+	"os"
 
 	"github.com/Speshl/pi_drift_wheel/app"
 	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/export"
+	"github.com/Speshl/pi_drift_wheel/replay"
+	"github.com/Speshl/pi_drift_wheel/sim"
 )
 
-// go build --ldflags '-extldflags "-Wl,--allow-multiple-definition"'
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	cfg := config.GetConfig()
 
 	app := app.NewApp(cfg)
@@ -22,4 +30,24 @@ func main() {
 	}
 }
 
+// Tools that run instead of driving the car
+func runCommand(name string, args []string) {
+	var err error
+	switch name {
+	case "replay":
+		err = replay.RunCommand(context.Background(), args)
+	case "export":
+		err = export.RunCommand(context.Background(), args)
+	case "sim":
+		err = sim.RunCommand(context.Background(), args)
+	default:
+		slog.Error("unknown command", "command", name, "commands", []string{"replay", "export", "sim"})
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error("command failed", "command", name, "error", err.Error())
+		os.Exit(1)
+	}
+}
+
 //https://www.kernel.org/doc/html/v4.12/input/ff.html
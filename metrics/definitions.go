@@ -0,0 +1,82 @@
+package metrics
+
+var (
+	ProcessLoopInterval = Default.NewHistogram("pdw_process_loop_interval_seconds",
+		"Time between processData ticks",
+		[]float64{0.005, 0.006, 0.007, 0.008, 0.009, 0.010, 0.012, 0.015, 0.020, 0.050, 0.100},
+	)
+	ProcessLoopJitter = Default.NewGauge("pdw_process_loop_jitter_seconds",
+		"Difference between the last processData tick interval and the target interval",
+	)
+	ProcessLoopSlow = Default.NewCounter("pdw_process_loop_slow_total",
+		"processData ticks that ran later than allowed",
+	)
+
+	Armed = Default.NewGauge("pdw_armed",
+		"1 when outputs are armed, 0 when they are held neutral",
+	)
+	Disarms = Default.NewCounterVec("pdw_disarms_total",
+		"Times outputs were disarmed", "reason",
+	)
+	EStopLatched = Default.NewGauge("pdw_estop_latched",
+		"1 while the emergency stop holds every output neutral",
+	)
+	EStops = Default.NewCounterVec("pdw_estops_total",
+		"Times the emergency stop latched", "reason",
+	)
+
+	TrainerTakeover = Default.NewGauge("pdw_trainer_takeover",
+		"1 while the trainer instructor has full control",
+	)
+	TrainerTakeovers = Default.NewCounter("pdw_trainer_takeovers_total",
+		"Times the trainer instructor took over",
+	)
+	GyroActive = Default.NewGauge("pdw_gyro_active",
+		"1 while the software gyro has fresh attitude telemetry",
+	)
+	GyroStale = Default.NewCounter("pdw_gyro_stale_total",
+		"Times attitude telemetry went stale and turned the software gyro off",
+	)
+	WatchdogTripped = Default.NewGauge("pdw_watchdog_tripped",
+		"1 while outputs are in failsafe because processing stopped sending frames",
+	)
+	WatchdogTrips = Default.NewCounter("pdw_watchdog_trips_total",
+		"Times processing stalled long enough to put outputs in failsafe",
+	)
+
+	SBusFramesRead = Default.NewCounterVec("pdw_sbus_frames_read_total",
+		"Complete sbus frames read", "port",
+	)
+	SBusFramesWritten = Default.NewCounterVec("pdw_sbus_frames_written_total",
+		"Sbus frames written", "port",
+	)
+	SBusFrameErrors = Default.NewCounterVec("pdw_sbus_frame_errors_total",
+		"Sbus frames that started but did not end or parse correctly", "port",
+	)
+	SBusFrameLost = Default.NewCounterVec("pdw_sbus_frame_lost_total",
+		"Sbus frames read with the frame lost flag", "port",
+	)
+	SBusFailsafe = Default.NewCounterVec("pdw_sbus_failsafe_total",
+		"Sbus frames read with the failsafe flag", "port",
+	)
+	SBusStartByteMisses = Default.NewCounterVec("pdw_sbus_start_byte_misses_total",
+		"Bytes read outside a frame that were not a start byte", "port",
+	)
+	SBusPriorityQueueDepth = Default.NewGaugeVec("pdw_sbus_priority_queue_depth",
+		"Frames waiting in the sbus priority queue", "port",
+	)
+
+	CRSFFrames = Default.NewCounterVec("pdw_crsf_frames_total",
+		"Crsf frames parsed", "port", "type",
+	)
+	CRSFCRCFailures = Default.NewCounterVec("pdw_crsf_crc_failures_total",
+		"Crsf frames that failed crc validation", "port",
+	)
+
+	ControllerEvents = Default.NewCounterVec("pdw_controller_events_total",
+		"Input events read from controllers", "controller",
+	)
+	FFUploads = Default.NewCounterVec("pdw_ff_uploads_total",
+		"Force feedback effect uploads", "controller", "result",
+	)
+)
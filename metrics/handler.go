@@ -0,0 +1,17 @@
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// Handler serves the registry for scraping
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		err := r.WriteText(w)
+		if err != nil {
+			slog.Warn("failed writing metrics", "error", err)
+		}
+	})
+}
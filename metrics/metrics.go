@@ -0,0 +1,248 @@
+package metrics
+
+// Minimal counters, gauges and histograms written in the prometheus text exposition format
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+type Registry struct {
+	lock    sync.RWMutex
+	metrics []*metric
+}
+
+// Default is the registry the package level metrics are registered with
+var Default = &Registry{}
+
+type metric struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	buckets    []float64
+
+	lock   sync.RWMutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       atomic.Uint64 //float64 bits for gauges, count for counters
+	bucketHits  []atomic.Uint64
+	sum         atomic.Uint64 //float64 bits
+	count       atomic.Uint64
+}
+
+type Counter struct{ s *series }
+type Gauge struct{ s *series }
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+type CounterVec struct{ m *metric }
+type GaugeVec struct{ m *metric }
+type HistogramVec struct{ m *metric }
+
+func (r *Registry) register(m *metric) *metric {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	m.series = make(map[string]*series, 1)
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{r.register(&metric{name: name, help: help, metricType: typeCounter, labelNames: labelNames})}
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{r.register(&metric{name: name, help: help, metricType: typeGauge, labelNames: labelNames})}
+}
+
+// NewHistogramVec buckets are upper bounds in ascending order, +Inf is added automatically
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{r.register(&metric{name: name, help: help, metricType: typeHistogram, labelNames: labelNames, buckets: buckets})}
+}
+
+func (r *Registry) NewCounter(name, help string) Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+func (r *Registry) NewGauge(name, help string) Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+func (m *metric) with(labelValues []string) *series {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d labels, got %d", m.name, len(m.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	m.lock.RLock()
+	s, ok := m.series[key]
+	m.lock.RUnlock()
+	if ok {
+		return s
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if s, ok = m.series[key]; ok {
+		return s
+	}
+	s = &series{
+		labelValues: append([]string(nil), labelValues...),
+		bucketHits:  make([]atomic.Uint64, len(m.buckets)),
+	}
+	m.series[key] = s
+	return s
+}
+
+// With returns the series for the label values, callers on hot paths should keep the result
+func (v *CounterVec) With(labelValues ...string) Counter {
+	return Counter{v.m.with(labelValues)}
+}
+
+func (v *GaugeVec) With(labelValues ...string) Gauge {
+	return Gauge{v.m.with(labelValues)}
+}
+
+func (v *HistogramVec) With(labelValues ...string) Histogram {
+	return Histogram{s: v.m.with(labelValues), buckets: v.m.buckets}
+}
+
+func (c Counter) Inc() {
+	c.s.value.Add(1)
+}
+
+func (c Counter) Add(n uint64) {
+	c.s.value.Add(n)
+}
+
+func (g Gauge) Set(value float64) {
+	g.s.value.Store(math.Float64bits(value))
+}
+
+func (g Gauge) Add(delta float64) {
+	addFloat(&g.s.value, delta)
+}
+
+func (h Histogram) Observe(value float64) {
+	for i := range h.buckets {
+		if value <= h.buckets[i] {
+			h.s.bucketHits[i].Add(1)
+		}
+	}
+	addFloat(&h.s.sum, value)
+	h.s.count.Add(1)
+}
+
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// WriteText writes every registered metric in the text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.RLock()
+	metrics := append([]*metric(nil), r.metrics...)
+	r.lock.RUnlock()
+
+	for _, m := range metrics {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.metricType)
+		if err != nil {
+			return err
+		}
+
+		m.lock.RLock()
+		allSeries := make([]*series, 0, len(m.series))
+		for _, s := range m.series {
+			allSeries = append(allSeries, s)
+		}
+		m.lock.RUnlock()
+		sort.Slice(allSeries, func(i, j int) bool {
+			return strings.Join(allSeries[i].labelValues, ",") < strings.Join(allSeries[j].labelValues, ",")
+		})
+
+		for _, s := range allSeries {
+			err = m.writeSeries(w, s)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *metric) writeSeries(w io.Writer, s *series) error {
+	labels := formatLabels(m.labelNames, s.labelValues)
+	switch m.metricType {
+	case typeCounter:
+		_, err := fmt.Fprintf(w, "%s%s %d\n", m.name, labels, s.value.Load())
+		return err
+	case typeGauge:
+		_, err := fmt.Fprintf(w, "%s%s %s\n", m.name, labels, formatFloat(math.Float64frombits(s.value.Load())))
+		return err
+	}
+
+	//histogram buckets are cumulative already since observe counts every bucket the value fits in
+	for i := range m.buckets {
+		bucketLabels := formatLabels(appendCopy(m.labelNames, "le"), appendCopy(s.labelValues, formatFloat(m.buckets[i])))
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, bucketLabels, s.bucketHits[i].Load())
+		if err != nil {
+			return err
+		}
+	}
+	count := s.count.Load()
+	infLabels := formatLabels(appendCopy(m.labelNames, "le"), appendCopy(s.labelValues, "+Inf"))
+	_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+		m.name, infLabels, count,
+		m.name, labels, formatFloat(math.Float64frombits(s.sum.Load())),
+		m.name, labels, count,
+	)
+	return err
+}
+
+// appendCopy never writes into the backing array of the original slice
+func appendCopy(values []string, value string) []string {
+	returnSlice := make([]string, len(values), len(values)+1)
+	copy(returnSlice, values)
+	return append(returnSlice, value)
+}
+
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i := range names {
+		value := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(values[i])
+		pairs[i] = fmt.Sprintf(`%s="%s"`, names[i], value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	return fmt.Sprintf("%g", value)
+}
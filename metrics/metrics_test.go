@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := &Registry{}
+
+	frames := r.NewCounterVec("test_frames_total", "Frames received.", "port", "type")
+	frames.With("ttyAMA1", "rc_channels").Add(3)
+	frames.With("ttyAMA0", "link_stats").Inc()
+	frames.With("ttyAMA0", "battery").Add(2)
+	frames.With(`C:\ "odd"`+"\nport", "battery").Inc()
+
+	r.NewGauge("test_connected", "Whether connected.").Set(1.5)
+
+	latency := r.NewHistogramVec("test_latency_seconds", "Tick latency.", []float64{0.001, 0.01, 0.1}, "loop")
+	for _, value := range []float64{0.0005, 0.005, 0.005, 0.05, 2} {
+		latency.With("main").Observe(value)
+	}
+	latency.With("empty")
+
+	expected := `# HELP test_frames_total Frames received.
+# TYPE test_frames_total counter
+test_frames_total{port="C:\\ \"odd\"\nport",type="battery"} 1
+test_frames_total{port="ttyAMA0",type="battery"} 2
+test_frames_total{port="ttyAMA0",type="link_stats"} 1
+test_frames_total{port="ttyAMA1",type="rc_channels"} 3
+# HELP test_connected Whether connected.
+# TYPE test_connected gauge
+test_connected 1.5
+# HELP test_latency_seconds Tick latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{loop="empty",le="0.001"} 0
+test_latency_seconds_bucket{loop="empty",le="0.01"} 0
+test_latency_seconds_bucket{loop="empty",le="0.1"} 0
+test_latency_seconds_bucket{loop="empty",le="+Inf"} 0
+test_latency_seconds_sum{loop="empty"} 0
+test_latency_seconds_count{loop="empty"} 0
+test_latency_seconds_bucket{loop="main",le="0.001"} 1
+test_latency_seconds_bucket{loop="main",le="0.01"} 3
+test_latency_seconds_bucket{loop="main",le="0.1"} 4
+test_latency_seconds_bucket{loop="main",le="+Inf"} 5
+test_latency_seconds_sum{loop="main"} 2.0605
+test_latency_seconds_count{loop="main"} 5
+`
+
+	var buf bytes.Buffer
+	err := r.WriteText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("unexpected output\ngot:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWithPanicsOnLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for the wrong number of labels")
+		}
+	}()
+	r := &Registry{}
+	r.NewCounterVec("test_total", "Test.", "port").With()
+}
@@ -0,0 +1,238 @@
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	profilesFile = "profiles.json"
+	selectedFile = "selected_profile"
+)
+
+var (
+	ErrNotFound  = fmt.Errorf("profile not found")
+	ErrNotLoaded = fmt.Errorf("profiles on disk could not be loaded, not saving over them")
+)
+
+type ProfileManager struct {
+	dir string
+
+	lock     sync.RWMutex
+	profiles []Profile
+	active   int
+	version  uint64
+	trims    map[string]map[string]int //keyed by profile name
+	readOnly bool                      //the profile list on disk could not be read or moved aside, saving would lose it
+}
+
+// NewProfileManager starts with only the default profile. If dir is empty nothing is persisted
+func NewProfileManager(dir string, defaultProfile Profile) *ProfileManager {
+	return &ProfileManager{
+		dir:      dir,
+		profiles: []Profile{defaultProfile},
+		version:  1,
+	}
+}
+
+// Load reads the profile list and the last selected profile from disk.
+// If no profile list exists yet the current list is written out so it can be edited.
+// A list that does not parse is moved aside so saving the defaults does not erase it
+func (p *ProfileManager) Load() error {
+	if p.dir == "" {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	path := filepath.Join(p.dir, profilesFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("no profiles found, writing defaults", "dir", p.dir)
+		p.readOnly = false
+		return p.saveProfiles(p.profiles)
+	} else if err != nil {
+		p.readOnly = true
+		return fmt.Errorf("failed reading profiles: %w", err)
+	}
+
+	loaded := make([]Profile, 0, 8)
+	err = json.Unmarshal(data, &loaded)
+	if err == nil {
+		err = validateAll(loaded)
+	}
+	if err != nil {
+		renameErr := os.Rename(path, path+badSuffix)
+		if renameErr != nil {
+			p.readOnly = true
+			return fmt.Errorf("failed loading profiles: %w", errors.Join(err, renameErr))
+		}
+		p.readOnly = false
+		return fmt.Errorf("failed loading profiles, moved to %s: %w", path+badSuffix, err)
+	}
+	p.readOnly = false
+	p.profiles = loaded
+	p.active = 0
+
+	selected, err := os.ReadFile(filepath.Join(p.dir, selectedFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed reading selected profile: %w", err)
+	}
+	if index := p.indexOf(strings.TrimSpace(string(selected))); index >= 0 {
+		p.active = index
+	}
+	p.version++
+	slog.Info("loaded profiles", "count", len(p.profiles), "active", p.profiles[p.active].Name)
+	return nil
+}
+
+func (p *ProfileManager) Active() Profile {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.profiles[p.active]
+}
+
+// Version changes every time the active profile or its settings change
+func (p *ProfileManager) Version() uint64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.version
+}
+
+func (p *ProfileManager) Profiles() []Profile {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	returnSlice := make([]Profile, len(p.profiles))
+	copy(returnSlice, p.profiles)
+	return returnSlice
+}
+
+// Select makes the named profile active and remembers it across restarts
+func (p *ProfileManager) Select(name string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	index := p.indexOf(name)
+	if index < 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return p.setActive(index)
+}
+
+// Cycle moves the active profile forward or backward through the list, wrapping at the ends
+func (p *ProfileManager) Cycle(offset int) (Profile, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	count := len(p.profiles)
+	index := ((p.active+offset)%count + count) % count
+	err := p.setActive(index)
+	return p.profiles[p.active], err
+}
+
+// Update replaces the profile with the same name, or adds it if it is new. Nothing changes if it can not be saved
+func (p *ProfileManager) Update(profile Profile) error {
+	err := profile.Validate()
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	index := p.indexOf(profile.Name)
+	updated := slices.Clone(p.profiles)
+	if index < 0 {
+		updated = append(updated, profile)
+	} else {
+		updated[index] = profile
+	}
+	err = p.saveProfiles(updated)
+	if err != nil {
+		return err
+	}
+	p.profiles = updated
+	if index == p.active {
+		p.version++
+	}
+	return nil
+}
+
+// Delete removes a profile, the active profile can not be removed
+func (p *ProfileManager) Delete(name string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	index := p.indexOf(name)
+	if index < 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if index == p.active {
+		return fmt.Errorf("can not delete active profile %s", name)
+	}
+	updated := slices.Delete(slices.Clone(p.profiles), index, index+1)
+	err := p.saveProfiles(updated)
+	if err != nil {
+		return err
+	}
+	p.profiles = updated
+	if index < p.active {
+		p.active--
+	}
+	return nil
+}
+
+func (p *ProfileManager) setActive(index int) error {
+	if index != p.active {
+		p.active = index
+		p.version++
+	}
+	if p.dir == "" {
+		return nil
+	}
+	return writeFileAtomic(filepath.Join(p.dir, selectedFile), []byte(p.profiles[p.active].Name+"\n"))
+}
+
+// saveProfiles writes a profile list, caller must hold the lock
+func (p *ProfileManager) saveProfiles(profiles []Profile) error {
+	if p.dir == "" {
+		return nil
+	}
+	if p.readOnly {
+		return ErrNotLoaded
+	}
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding profiles: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(p.dir, profilesFile), data)
+}
+
+func (p *ProfileManager) indexOf(name string) int {
+	for i := range p.profiles {
+		if p.profiles[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func validateAll(profiles []Profile) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("no profiles defined")
+	}
+	names := make(map[string]bool, len(profiles))
+	for i := range profiles {
+		err := profiles[i].Validate()
+		if err != nil {
+			return err
+		}
+		if names[profiles[i].Name] {
+			return fmt.Errorf("duplicate profile name %s", profiles[i].Name)
+		}
+		names[profiles[i].Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package profiles
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testManager(t *testing.T, dir string, names ...string) *ProfileManager {
+	t.Helper()
+	manager := NewProfileManager(dir, Profile{Name: "default"})
+	for _, name := range names {
+		err := manager.Update(Profile{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return manager
+}
+
+func TestSelect(t *testing.T) {
+	manager := testManager(t, "", "drift", "grip")
+	version := manager.Version()
+
+	err := manager.Select("grip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.Active().Name != "grip" || manager.Version() == version {
+		t.Errorf("active %s version %d", manager.Active().Name, manager.Version())
+	}
+	err = manager.Select("rally")
+	if !errors.Is(err, ErrNotFound) || manager.Active().Name != "grip" {
+		t.Errorf("selecting a missing profile got %v, active %s", err, manager.Active().Name)
+	}
+}
+
+func TestCycleWraps(t *testing.T) {
+	manager := testManager(t, "", "drift", "grip")
+	for _, tc := range []struct {
+		offset int
+		want   string
+	}{
+		{offset: -1, want: "grip"},
+		{offset: 1, want: "default"},
+		{offset: 1, want: "drift"},
+		{offset: 5, want: "default"},
+	} {
+		profile, err := manager.Cycle(tc.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.Name != tc.want || manager.Active().Name != tc.want {
+			t.Errorf("cycle %d got %s want %s", tc.offset, profile.Name, tc.want)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	manager := testManager(t, "", "drift", "grip")
+	err := manager.Select("grip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = manager.Delete("grip")
+	if err == nil {
+		t.Error("deleted the active profile")
+	}
+	err = manager.Delete("rally")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting a missing profile got %v", err)
+	}
+	err = manager.Delete("drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.Active().Name != "grip" || len(manager.Profiles()) != 2 {
+		t.Errorf("active %s profiles %v", manager.Active().Name, manager.Profiles())
+	}
+}
+
+func TestSelectionPersists(t *testing.T) {
+	dir := t.TempDir()
+	manager := testManager(t, dir, "drift", "grip")
+	err := manager.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.Select("drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewProfileManager(dir, Profile{Name: "default"})
+	err = reloaded.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Active().Name != "drift" || len(reloaded.Profiles()) != 3 {
+		t.Errorf("active %s profiles %v", reloaded.Active().Name, reloaded.Profiles())
+	}
+}
+
+// A profile list that does not load is moved aside rather than overwritten by the next save
+func TestCorruptProfilesKept(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, profilesFile)
+	corrupt := []byte(`[{"name": "drift"}, {"name": "grip", "esc_mode": "auto"}]`)
+	err := os.WriteFile(path, corrupt, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewProfileManager(dir, Profile{Name: "default"})
+	err = manager.Load()
+	if err == nil {
+		t.Fatal("loaded an invalid profile list")
+	}
+	if manager.Active().Name != "default" {
+		t.Errorf("active %s", manager.Active().Name)
+	}
+	err = manager.Update(Profile{Name: "default", GyroGain: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := os.ReadFile(path + badSuffix)
+	if err != nil || string(bad) != string(corrupt) {
+		t.Errorf("corrupt profiles not kept: %q %v", bad, err)
+	}
+}
+
+func TestFailedSaveChangesNothing(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(dir, nil, 0644) //a file where the state dir should be so every write fails
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := NewProfileManager(dir, Profile{Name: "default"})
+	manager.profiles = append(manager.profiles, Profile{Name: "drift"})
+	version := manager.Version()
+
+	err = manager.Update(Profile{Name: "grip"})
+	if err == nil {
+		t.Error("update saved into a file")
+	}
+	err = manager.Update(Profile{Name: "default", GyroGain: 10})
+	if err == nil {
+		t.Error("update saved into a file")
+	}
+	err = manager.Delete("drift")
+	if err == nil {
+		t.Error("delete saved into a file")
+	}
+	if len(manager.Profiles()) != 2 || manager.Active().GyroGain != 0 || manager.Version() != version {
+		t.Errorf("memory changed without saving: %v version %d", manager.Profiles(), manager.Version())
+	}
+}
+
+func TestUnreadableProfilesNotOverwritten(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, profilesFile), 0755) //reading a directory fails
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := NewProfileManager(dir, Profile{Name: "default"})
+	err = manager.Load()
+	if err == nil {
+		t.Fatal("loaded a directory")
+	}
+	err = manager.Update(Profile{Name: "drift"})
+	if !errors.Is(err, ErrNotLoaded) {
+		t.Errorf("update got %v want %v", err, ErrNotLoaded)
+	}
+}
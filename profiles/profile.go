@@ -0,0 +1,80 @@
+package profiles
+
+import (
+	"fmt"
+
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+const (
+	EscModeHPattern = "h_pattern"
+	EscModeNoGears  = "no_gears"
+)
+
+// Profile bundles everything that changes between cars
+type Profile struct {
+	Name          string           `json:"name"`
+	OutputMap     []int            `json:"output_map"`     //index is the mixed channel, value is the output channel. empty is 1:1
+	InvertOutputs []bool           `json:"invert_outputs"` //indexed by output channel
+	EscMode       string           `json:"esc_mode"`
+	SteerCurve    models.Curve     `json:"steer_curve"`
+	ThrottleCurve models.Curve     `json:"throttle_curve"`
+	GyroGain      int              `json:"gyro_gain"` //starting gyro gain trim (-100 to 100)
+	Handbrake     models.Handbrake `json:"handbrake"`
+	FF            FFCalibration    `json:"ff"`
+}
+
+// Servo feedback values seen at the steering endpoints, used to build the force feedback level
+type FFCalibration struct {
+	MinPitch int `json:"min_pitch"`
+	MidPitch int `json:"mid_pitch"`
+	MaxPitch int `json:"max_pitch"`
+}
+
+func (p Profile) ControllerOptions() models.ControllerOptions {
+	return models.ControllerOptions{
+		UseHPattern:   p.EscMode != EscModeNoGears,
+		SteerCurve:    p.SteerCurve,
+		ThrottleCurve: p.ThrottleCurve,
+		Handbrake:     p.Handbrake,
+	}
+}
+
+func (p *Profile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile has no name")
+	}
+	if p.EscMode != "" && p.EscMode != EscModeHPattern && p.EscMode != EscModeNoGears {
+		return fmt.Errorf("profile %s has unknown esc mode %s", p.Name, p.EscMode)
+	}
+	if len(p.OutputMap) > sbus.MaxChannels {
+		return fmt.Errorf("profile %s maps %d channels, max is %d", p.Name, len(p.OutputMap), sbus.MaxChannels)
+	}
+	mappedFrom := make(map[int]int, len(p.OutputMap))
+	for i := range p.OutputMap {
+		if p.OutputMap[i] < 0 || p.OutputMap[i] >= sbus.MaxChannels {
+			return fmt.Errorf("profile %s maps channel %d to invalid output %d", p.Name, i, p.OutputMap[i])
+		}
+		if from, ok := mappedFrom[p.OutputMap[i]]; ok {
+			return fmt.Errorf("profile %s maps channels %d and %d both to output %d", p.Name, from, i, p.OutputMap[i])
+		}
+		mappedFrom[p.OutputMap[i]] = i
+	}
+	if len(p.InvertOutputs) > sbus.MaxChannels {
+		return fmt.Errorf("profile %s inverts %d channels, max is %d", p.Name, len(p.InvertOutputs), sbus.MaxChannels)
+	}
+	if p.GyroGain < -100 || p.GyroGain > 100 {
+		return fmt.Errorf("profile %s gyro gain %d out of range", p.Name, p.GyroGain)
+	}
+	if p.Handbrake.Brake > 100 {
+		return fmt.Errorf("profile %s handbrake brake blend %d out of range", p.Name, p.Handbrake.Brake)
+	}
+	if p.Handbrake.Channel != 0 && (p.Handbrake.Channel < 3 || p.Handbrake.Channel >= sbus.MaxChannels) { //0-2 are steer, esc and gyro
+		return fmt.Errorf("profile %s handbrake channel %d is not a free channel", p.Name, p.Handbrake.Channel)
+	}
+	if p.Handbrake.GyroCut < 0 || p.Handbrake.GyroCut > 100 {
+		return fmt.Errorf("profile %s handbrake gyro cut %d out of range", p.Name, p.Handbrake.GyroCut)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package profiles
+
+import (
+	"testing"
+
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		wantErr bool
+	}{
+		{name: "defaults", profile: Profile{Name: "default"}},
+		{name: "no name", profile: Profile{}, wantErr: true},
+		{name: "output swap", profile: Profile{Name: "swap", OutputMap: []int{1, 0}}},
+		{name: "output out of range", profile: Profile{Name: "range", OutputMap: []int{16}}, wantErr: true},
+		{name: "two channels on one output", profile: Profile{Name: "dup", OutputMap: []int{3, 1, 3}}, wantErr: true},
+		{name: "rear brake channel", profile: Profile{Name: "rear", Handbrake: models.Handbrake{Channel: 5}}},
+		{name: "rear brake on esc", profile: Profile{Name: "rear", Handbrake: models.Handbrake{Channel: 1}}, wantErr: true},
+		{name: "gyro cut over 100", profile: Profile{Name: "cut", Handbrake: models.Handbrake{GyroCut: 101}}, wantErr: true},
+	}
+	for _, tc := range tests {
+		err := tc.profile.Validate()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package profiles
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes to a temp file in the same directory then renames it over the target,
+// so a power cut leaves either the old or the new file but never a partial one
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed creating %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed creating temp file for %s: %w", path, err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) //no-op once renamed
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed writing %s: %w", tmpPath, err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed closing %s: %w", tmpPath, closeErr)
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("failed renaming %s: %w", tmpPath, err)
+	}
+
+	//sync the directory so the rename itself survives a power cut
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed opening %s: %w", dir, err)
+	}
+	defer dirFile.Close()
+	return dirFile.Sync()
+}
@@ -0,0 +1,97 @@
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+const (
+	trimsFile = "trims.json"
+	badSuffix = ".bad" //added to a file that could not be parsed
+
+	TrimGyroGain = "gyro_gain"
+	TrimSteer    = "steer_trim"
+	TrimThrottle = "throttle_trim"
+)
+
+// Trims returns the saved trims for a profile, falling back to the profile defaults
+func (p *ProfileManager) Trims(name string) map[string]int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	trims := map[string]int{
+		TrimGyroGain: 0,
+		TrimSteer:    0,
+		TrimThrottle: 0,
+	}
+	if index := p.indexOf(name); index >= 0 {
+		trims[TrimGyroGain] = p.profiles[index].GyroGain
+	}
+
+	err := p.loadTrims()
+	if err != nil {
+		slog.Warn("failed loading trims, using defaults", "profile", name, "error", err)
+		return trims
+	}
+	maps.Copy(trims, p.trims[name])
+	return trims
+}
+
+// SaveTrims stores the trims for a profile, the file is replaced atomically
+func (p *ProfileManager) SaveTrims(name string, trims map[string]int) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	err := p.loadTrims()
+	if err != nil {
+		return err
+	}
+	p.trims[name] = maps.Clone(trims)
+
+	if p.dir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(p.trims, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding trims: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(p.dir, trimsFile), data)
+}
+
+// loadTrims reads the trims file the first time it is needed, caller must hold the lock
+func (p *ProfileManager) loadTrims() error {
+	if p.trims != nil {
+		return nil
+	}
+	p.trims = make(map[string]map[string]int, len(p.profiles))
+	if p.dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.dir, trimsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		p.trims = nil //try again next time rather than write over the file
+		return fmt.Errorf("failed reading trims: %w", err)
+	}
+
+	err = json.Unmarshal(data, &p.trims)
+	if err != nil {
+		//keep the unreadable file so saving one profile's trims does not erase the rest
+		path := filepath.Join(p.dir, trimsFile)
+		renameErr := os.Rename(path, path+badSuffix)
+		if renameErr != nil {
+			p.trims = nil //try again next time rather than write over the file
+			return fmt.Errorf("failed parsing trims: %w", errors.Join(err, renameErr))
+		}
+		slog.Warn("failed parsing trims, moved aside and starting fresh", "path", path+badSuffix, "error", err)
+		p.trims = make(map[string]map[string]int, len(p.profiles))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrimsSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewProfileManager(dir, Profile{Name: "default", GyroGain: 20})
+	err := manager.SaveTrims("default", map[string]int{TrimSteer: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewProfileManager(dir, Profile{Name: "default", GyroGain: 20})
+	trims := reloaded.Trims("default")
+	if trims[TrimSteer] != 5 || trims[TrimGyroGain] != 20 || trims[TrimThrottle] != 0 {
+		t.Errorf("got %v", trims)
+	}
+}
+
+// A trims file that does not parse is moved aside instead of being overwritten with one profile's trims
+func TestTrimsCorruptFileKept(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, trimsFile)
+	corrupt := []byte(`{"other": {"steer_trim": 3}`)
+	err := os.WriteFile(path, corrupt, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewProfileManager(dir, Profile{Name: "default"})
+	if trims := manager.Trims("default"); trims[TrimSteer] != 0 {
+		t.Errorf("got %v from a corrupt file", trims)
+	}
+	err = manager.SaveTrims("default", map[string]int{TrimSteer: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad, err := os.ReadFile(path + badSuffix)
+	if err != nil {
+		t.Fatalf("corrupt trims not kept: %s", err)
+	}
+	if string(bad) != string(corrupt) {
+		t.Errorf("kept %q want %q", bad, corrupt)
+	}
+	reloaded := NewProfileManager(dir, Profile{Name: "default"})
+	if trims := reloaded.Trims("default"); trims[TrimSteer] != 7 {
+		t.Errorf("got %v after saving", trims)
+	}
+}
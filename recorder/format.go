@@ -0,0 +1,318 @@
+package recorder
+
+/*
+Session log layout, all values little endian
+
+Header: magic "PDWREC" | version uint16 | session start unix nanos int64
+Record: type uint8 | unix nanos int64 | payload length uint16 | payload
+
+Payloads by type
+	Input:  source length uint8 | source | event type uint16 | event code uint16 | event value int32
+	Output: priority uint8 | marshaled sbus frame (25 bytes)
+	SBusRX: port uint8 | marshaled sbus frame (25 bytes)
+	CRSF:   port uint8 | crsf frame type + payload + crc as passed to the frame decoders
+	Profile: profile applied to the mixer as json
+	Trims:   trims applied to the mixer as a json object
+	Arming:  armed uint8 | disarm reason
+	EStop:   latched uint8 | latch reason
+
+Profile, trims, arming and e-stop records are written again at the start of every rotated log so
+each log replays on its own. Readers skip types they do not know so these need no version bump
+*/
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+const (
+	Magic   = "PDWREC"
+	Version = 1
+
+	headerLength       = len(Magic) + 2 + 8
+	recordHeaderLength = 1 + 8 + 2
+	maxSourceLength    = 255
+	sbusFrameLength    = 25
+)
+
+type RecordType uint8
+
+const (
+	RecordTypeInput  RecordType = 1
+	RecordTypeOutput RecordType = 2
+	RecordTypeSBusRX RecordType = 3
+	RecordTypeCRSF   RecordType = 4
+
+	//state changes, repeated at the start of every log
+	RecordTypeProfile RecordType = 5
+	RecordTypeTrims   RecordType = 6
+	RecordTypeArming  RecordType = 7
+	RecordTypeEStop   RecordType = 8
+)
+
+// stateTypes are written again at the start of every rotated log, in this order
+var stateTypes = []RecordType{RecordTypeProfile, RecordTypeTrims, RecordTypeArming, RecordTypeEStop}
+
+var (
+	ErrBadMagic       = fmt.Errorf("not a session log")
+	ErrBadVersion     = fmt.Errorf("unsupported session log version")
+	ErrInvalidPayload = fmt.Errorf("invalid record payload")
+)
+
+func (t RecordType) String() string {
+	switch t {
+	case RecordTypeInput:
+		return "input"
+	case RecordTypeOutput:
+		return "output"
+	case RecordTypeSBusRX:
+		return "sbus_rx"
+	case RecordTypeCRSF:
+		return "crsf"
+	case RecordTypeProfile:
+		return "profile"
+	case RecordTypeTrims:
+		return "trims"
+	case RecordTypeArming:
+		return "arming"
+	case RecordTypeEStop:
+		return "estop"
+	default:
+		return fmt.Sprintf("RecordType(%d)", t)
+	}
+}
+
+// Record is one decoded entry, only the fields for its type are set
+type Record struct {
+	Type RecordType
+	Time time.Time
+
+	Source     string //controller name for inputs
+	EventType  uint16
+	EventCode  uint16
+	EventValue int32
+
+	Port     int //sbus or crsf port index
+	Frame    sbus.Frame
+	Priority int
+	Data     []byte //crsf frame
+
+	Profile profiles.Profile
+	Trims   map[string]int
+	Armed   bool
+	Latched bool   //e-stop latched
+	Reason  string //why outputs were disarmed or the e-stop latched
+}
+
+type Header struct {
+	Version uint16
+	Start   time.Time
+}
+
+// WriteHeader starts a session log, records follow as written by MarshalRecord
+func WriteHeader(w io.Writer, start time.Time) error {
+	buf := make([]byte, headerLength)
+	copy(buf, Magic)
+	binary.LittleEndian.PutUint16(buf[len(Magic):], Version)
+	binary.LittleEndian.PutUint64(buf[len(Magic)+2:], uint64(start.UnixNano()))
+	_, err := w.Write(buf)
+	return err
+}
+
+// MarshalRecord encodes the record including its type, time and length prefix
+func MarshalRecord(r Record) ([]byte, error) {
+	payload := make([]byte, 0, 64)
+	switch r.Type {
+	case RecordTypeInput:
+		if len(r.Source) > maxSourceLength {
+			return nil, fmt.Errorf("%w: source name too long", ErrInvalidPayload)
+		}
+		payload = append(payload, uint8(len(r.Source)))
+		payload = append(payload, r.Source...)
+		payload = binary.LittleEndian.AppendUint16(payload, r.EventType)
+		payload = binary.LittleEndian.AppendUint16(payload, r.EventCode)
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(r.EventValue))
+	case RecordTypeOutput:
+		payload = append(payload, clampUint8(r.Priority))
+		payload = append(payload, r.Frame.Marshal()...)
+	case RecordTypeSBusRX:
+		payload = append(payload, clampUint8(r.Port))
+		payload = append(payload, r.Frame.Marshal()...)
+	case RecordTypeCRSF:
+		payload = append(payload, clampUint8(r.Port))
+		payload = append(payload, r.Data...)
+	case RecordTypeProfile:
+		data, err := json.Marshal(r.Profile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+		}
+		payload = append(payload, data...)
+	case RecordTypeTrims:
+		data, err := json.Marshal(r.Trims)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+		}
+		payload = append(payload, data...)
+	case RecordTypeArming:
+		payload = append(payload, boolUint8(r.Armed))
+		payload = append(payload, r.Reason...)
+	case RecordTypeEStop:
+		payload = append(payload, boolUint8(r.Latched))
+		payload = append(payload, r.Reason...)
+	default:
+		return nil, fmt.Errorf("%w: unknown type %d", ErrInvalidPayload, r.Type)
+	}
+	if len(payload) > math.MaxUint16 {
+		return nil, fmt.Errorf("%w: %d byte payload", ErrInvalidPayload, len(payload))
+	}
+
+	buf := make([]byte, recordHeaderLength, recordHeaderLength+len(payload))
+	buf[0] = byte(r.Type)
+	binary.LittleEndian.PutUint64(buf[1:9], uint64(r.Time.UnixNano()))
+	binary.LittleEndian.PutUint16(buf[9:11], uint16(len(payload)))
+	return append(buf, payload...), nil
+}
+
+func unmarshalPayload(r *Record, payload []byte) error {
+	switch r.Type {
+	case RecordTypeInput:
+		if len(payload) < 1 || len(payload) != 1+int(payload[0])+8 {
+			return ErrInvalidPayload
+		}
+		sourceEnd := 1 + int(payload[0])
+		r.Source = string(payload[1:sourceEnd])
+		r.EventType = binary.LittleEndian.Uint16(payload[sourceEnd : sourceEnd+2])
+		r.EventCode = binary.LittleEndian.Uint16(payload[sourceEnd+2 : sourceEnd+4])
+		r.EventValue = int32(binary.LittleEndian.Uint32(payload[sourceEnd+4 : sourceEnd+8]))
+	case RecordTypeOutput, RecordTypeSBusRX:
+		if len(payload) != 1+sbusFrameLength {
+			return ErrInvalidPayload
+		}
+		frame, err := sbus.UnmarshalFrame(payload[1:])
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+		}
+		r.Frame = frame
+		if r.Type == RecordTypeOutput {
+			r.Priority = int(payload[0])
+		} else {
+			r.Port = int(payload[0])
+		}
+	case RecordTypeCRSF:
+		if len(payload) < 1 {
+			return ErrInvalidPayload
+		}
+		r.Port = int(payload[0])
+		r.Data = append([]byte(nil), payload[1:]...)
+	case RecordTypeProfile:
+		err := json.Unmarshal(payload, &r.Profile)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+		}
+	case RecordTypeTrims:
+		err := json.Unmarshal(payload, &r.Trims)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+		}
+	case RecordTypeArming, RecordTypeEStop:
+		if len(payload) < 1 {
+			return ErrInvalidPayload
+		}
+		r.Armed = r.Type == RecordTypeArming && payload[0] != 0
+		r.Latched = r.Type == RecordTypeEStop && payload[0] != 0
+		r.Reason = string(payload[1:])
+	}
+	return nil
+}
+
+type Reader struct {
+	reader *bufio.Reader
+	header Header
+}
+
+// NewReader checks the session header, records are then read with Next
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := bufio.NewReader(r)
+	buf := make([]byte, headerLength)
+	_, err := io.ReadFull(reader, buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading header: %w", err)
+	}
+	if string(buf[:len(Magic)]) != Magic {
+		return nil, ErrBadMagic
+	}
+	version := binary.LittleEndian.Uint16(buf[len(Magic):])
+	if version != Version {
+		return nil, fmt.Errorf("%w: %d", ErrBadVersion, version)
+	}
+	return &Reader{
+		reader: reader,
+		header: Header{
+			Version: version,
+			Start:   time.Unix(0, int64(binary.LittleEndian.Uint64(buf[len(Magic)+2:]))),
+		},
+	}, nil
+}
+
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next returns io.EOF at the end of the log. A record cut short by a crash also ends the log.
+// Unknown record types are skipped so newer logs can still be read
+func (r *Reader) Next() (Record, error) {
+	for {
+		recordHeader := make([]byte, recordHeaderLength)
+		_, err := io.ReadFull(r.reader, recordHeader)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Record{}, io.EOF
+		} else if err != nil {
+			return Record{}, err
+		}
+
+		record := Record{
+			Type: RecordType(recordHeader[0]),
+			Time: time.Unix(0, int64(binary.LittleEndian.Uint64(recordHeader[1:9]))),
+		}
+		payload := make([]byte, binary.LittleEndian.Uint16(recordHeader[9:11]))
+		_, err = io.ReadFull(r.reader, payload)
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return Record{}, io.EOF
+		} else if err != nil {
+			return Record{}, err
+		}
+
+		switch record.Type {
+		case RecordTypeInput, RecordTypeOutput, RecordTypeSBusRX, RecordTypeCRSF,
+			RecordTypeProfile, RecordTypeTrims, RecordTypeArming, RecordTypeEStop:
+			err = unmarshalPayload(&record, payload)
+			return record, err
+		default:
+			continue
+		}
+	}
+}
+
+func boolUint8(value bool) uint8 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func clampUint8(value int) uint8 {
+	if value < 0 {
+		return 0
+	} else if value > 255 {
+		return 255
+	}
+	return uint8(value)
+}
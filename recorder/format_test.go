@@ -0,0 +1,143 @@
+package recorder
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+func testRecords() []Record {
+	start := time.Unix(0, 1700000000123456789)
+	frame := sbus.NewFrame()
+	frame.Ch[0] = 172
+	frame.Ch[15] = 1811
+	return []Record{
+		{Type: RecordTypeInput, Time: start, Source: "g27", EventType: 3, EventCode: 2, EventValue: -1200},
+		{Type: RecordTypeOutput, Time: start.Add(time.Millisecond), Frame: frame, Priority: 2},
+		{Type: RecordTypeSBusRX, Time: start.Add(2 * time.Millisecond), Port: 1, Frame: frame},
+		{Type: RecordTypeCRSF, Time: start.Add(3 * time.Millisecond), Port: 0, Data: []byte{0x1e, 0x01, 0x02, 0x03}},
+		{Type: RecordTypeProfile, Time: start.Add(4 * time.Millisecond), Profile: profiles.Profile{Name: "drift", OutputMap: []int{1, 0}, EscMode: profiles.EscModeNoGears, GyroGain: 20}},
+		{Type: RecordTypeTrims, Time: start.Add(5 * time.Millisecond), Trims: map[string]int{"steer_trim": -12, "gyro_gain": 30}},
+		{Type: RecordTypeArming, Time: start.Add(6 * time.Millisecond), Reason: "kill button"},
+		{Type: RecordTypeArming, Time: start.Add(7 * time.Millisecond), Armed: true},
+		{Type: RecordTypeEStop, Time: start.Add(8 * time.Millisecond), Latched: true, Reason: "button"},
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	start := time.Unix(0, 1700000000000000000)
+	buf := &bytes.Buffer{}
+	err := WriteHeader(buf, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := testRecords()
+	for _, record := range records {
+		data, err := MarshalRecord(record)
+		if err != nil {
+			t.Fatalf("%s: %s", record.Type, err)
+		}
+		buf.Write(data)
+	}
+
+	reader, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := reader.Header(); header.Version != Version || !header.Start.Equal(start) {
+		t.Errorf("header got %+v", header)
+	}
+	for _, want := range records {
+		got, err := reader.Next()
+		if err != nil {
+			t.Fatalf("%s: %s", want.Type, err)
+		}
+		if !got.Time.Equal(want.Time) {
+			t.Errorf("%s: time got %s want %s", want.Type, got.Time, want.Time)
+		}
+		got.Time = want.Time
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v want %+v", want.Type, got, want)
+		}
+	}
+	_, err = reader.Next()
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("end got %v want EOF", err)
+	}
+}
+
+func TestMarshalRecordInvalid(t *testing.T) {
+	_, err := MarshalRecord(Record{Type: RecordType(99)})
+	if !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("unknown type got %v", err)
+	}
+	_, err = MarshalRecord(Record{Type: RecordTypeInput, Source: string(make([]byte, 256))})
+	if !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("long source got %v", err)
+	}
+	_, err = MarshalRecord(Record{Type: RecordTypeEStop, Reason: string(make([]byte, 1<<16))})
+	if !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("long payload got %v", err)
+	}
+}
+
+func TestNewReaderBadHeader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := WriteHeader(buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := buf.Bytes()
+
+	badMagic := append([]byte("NOTREC"), header[len(Magic):]...)
+	_, err = NewReader(bytes.NewReader(badMagic))
+	if !errors.Is(err, ErrBadMagic) {
+		t.Errorf("bad magic got %v", err)
+	}
+
+	badVersion := append([]byte(nil), header...)
+	badVersion[len(Magic)] = Version + 1
+	_, err = NewReader(bytes.NewReader(badVersion))
+	if !errors.Is(err, ErrBadVersion) {
+		t.Errorf("bad version got %v", err)
+	}
+
+	_, err = NewReader(bytes.NewReader(header[:4]))
+	if err == nil {
+		t.Error("short header read")
+	}
+}
+
+func TestReaderTruncatedAndUnknown(t *testing.T) {
+	records := testRecords()
+	buf := &bytes.Buffer{}
+	err := WriteHeader(buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := MarshalRecord(records[0])
+	buf.Write(first)
+	unknown := []byte{99, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0xaa, 0xbb} //a newer record type with a 2 byte payload
+	buf.Write(unknown)
+	last, _ := MarshalRecord(records[1])
+	buf.Write(last[:len(last)-5]) //cut short by a crash
+
+	reader, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reader.Next()
+	if err != nil || got.Type != RecordTypeInput {
+		t.Fatalf("first record got %+v %v", got, err)
+	}
+	_, err = reader.Next()
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("truncated record got %v want EOF", err)
+	}
+}
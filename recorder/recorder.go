@@ -0,0 +1,277 @@
+package recorder
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+const (
+	FileExtension = ".pdwrec"
+
+	queueSize     = 4096
+	flushInterval = 250 * time.Millisecond //most that is lost if the pi loses power
+)
+
+var (
+	recordsWritten = metrics.Default.NewCounter("pdw_recorder_records_total", "Records written to the session log")
+	recordsDropped = metrics.Default.NewCounter("pdw_recorder_dropped_total", "Records dropped because the writer fell behind")
+)
+
+// Recorder writes timestamped inputs, outputs and telemetry to rotating session logs.
+// Record methods never block the caller, a nil Recorder ignores everything
+type Recorder struct {
+	cfg   config.RecorderConfig
+	queue chan Record
+
+	file    *os.File
+	writer  *bufio.Writer
+	written int64
+	state   map[RecordType]Record //latest state records, written again at the start of each log
+}
+
+func NewRecorder(cfg config.RecorderConfig) *Recorder {
+	return &Recorder{
+		cfg:   cfg,
+		queue: make(chan Record, queueSize),
+		state: make(map[RecordType]Record, len(stateTypes)),
+	}
+}
+
+func (r *Recorder) RecordInput(source string, eventType uint16, eventCode uint16, eventValue int32) {
+	r.record(Record{Type: RecordTypeInput, Source: source, EventType: eventType, EventCode: eventCode, EventValue: eventValue})
+}
+
+func (r *Recorder) RecordOutput(frame sbus.SBusFrame) {
+	r.record(Record{Type: RecordTypeOutput, Frame: frame.Frame, Priority: frame.Priority})
+}
+
+func (r *Recorder) RecordSBusRX(port int, frame sbus.Frame) {
+	r.record(Record{Type: RecordTypeSBusRX, Port: port, Frame: frame})
+}
+
+// RecordCRSF copies data so callers may reuse their buffer
+func (r *Recorder) RecordCRSF(port int, data []byte) {
+	r.record(Record{Type: RecordTypeCRSF, Port: port, Data: append([]byte(nil), data...)})
+}
+
+// RecordProfile is called whenever the mixer picks up a profile
+func (r *Recorder) RecordProfile(profile profiles.Profile) {
+	r.record(Record{Type: RecordTypeProfile, Profile: profile})
+}
+
+// RecordTrims copies trims so callers may keep changing theirs
+func (r *Recorder) RecordTrims(trims map[string]int) {
+	r.record(Record{Type: RecordTypeTrims, Trims: maps.Clone(trims)})
+}
+
+func (r *Recorder) RecordArming(armed bool, reason string) {
+	r.record(Record{Type: RecordTypeArming, Armed: armed, Reason: reason})
+}
+
+func (r *Recorder) RecordEStop(latched bool, reason string) {
+	r.record(Record{Type: RecordTypeEStop, Latched: latched, Reason: reason})
+}
+
+func (r *Recorder) record(record Record) {
+	if r == nil {
+		return
+	}
+	record.Time = time.Now()
+	select {
+	case r.queue <- record:
+	default:
+		recordsDropped.Inc()
+	}
+}
+
+func (r *Recorder) Start(ctx context.Context) error {
+	err := os.MkdirAll(r.cfg.Dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed creating recorder dir %s: %w", r.cfg.Dir, err)
+	}
+	err = r.rotate()
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.drain()
+			return ctx.Err()
+		case <-flushTicker.C:
+			err = r.writer.Flush()
+			if err != nil {
+				return fmt.Errorf("failed flushing session log: %w", err)
+			}
+		case record := <-r.queue:
+			err = r.write(record)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// drain writes whatever was queued before shutdown
+func (r *Recorder) drain() {
+	for {
+		select {
+		case record := <-r.queue:
+			err := r.write(record)
+			if err != nil {
+				slog.Warn("failed writing queued record", "error", err)
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (r *Recorder) write(record Record) error {
+	data, err := MarshalRecord(record)
+	if err != nil {
+		slog.Warn("skipping record", "type", record.Type.String(), "error", err)
+		return nil
+	}
+	if r.written+int64(len(data)) > r.maxFileSize() {
+		err = r.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	if slices.Contains(stateTypes, record.Type) {
+		r.state[record.Type] = record
+	}
+	return r.writeData(data)
+}
+
+func (r *Recorder) writeData(data []byte) error {
+	n, err := r.writer.Write(data)
+	r.written += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed writing session log: %w", err)
+	}
+	recordsWritten.Inc()
+	return nil
+}
+
+// writeState starts a new log with the state the last one ended in
+func (r *Recorder) writeState(start time.Time) error {
+	for _, recordType := range stateTypes {
+		record, ok := r.state[recordType]
+		if !ok {
+			continue
+		}
+		record.Time = start
+		data, err := MarshalRecord(record)
+		if err != nil {
+			return fmt.Errorf("failed writing %s state: %w", recordType.String(), err)
+		}
+		err = r.writeData(data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotate closes the current log, starts a new one and removes the oldest logs over the limit
+func (r *Recorder) rotate() error {
+	r.close()
+
+	start := time.Now()
+	path := filepath.Join(r.cfg.Dir, "session-"+start.UTC().Format("20060102T150405.000000000Z")+FileExtension)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed creating session log: %w", err)
+	}
+	r.file = file
+	r.writer = bufio.NewWriterSize(file, 64*1024)
+	err = WriteHeader(r.writer, start)
+	if err != nil {
+		return fmt.Errorf("failed writing session header: %w", err)
+	}
+	r.written = int64(headerLength)
+	slog.Info("recording session", "path", path)
+	err = r.writeState(start)
+	if err != nil {
+		return err
+	}
+
+	r.removeOldLogs()
+	return nil
+}
+
+func (r *Recorder) close() {
+	if r.file == nil {
+		return
+	}
+	err := r.writer.Flush()
+	if err != nil {
+		slog.Warn("failed flushing session log", "path", r.file.Name(), "error", err)
+	}
+	err = r.file.Close()
+	if err != nil {
+		slog.Warn("failed closing session log", "path", r.file.Name(), "error", err)
+	}
+	r.file = nil
+}
+
+func (r *Recorder) removeOldLogs() {
+	if r.cfg.MaxFiles <= 0 {
+		return
+	}
+	logs, err := ListLogs(r.cfg.Dir)
+	if err != nil {
+		slog.Warn("failed listing session logs", "error", err)
+		return
+	}
+	for i := 0; i < len(logs)-r.cfg.MaxFiles; i++ {
+		err = os.Remove(logs[i])
+		if err != nil {
+			slog.Warn("failed removing old session log", "path", logs[i], "error", err)
+		}
+	}
+}
+
+func (r *Recorder) maxFileSize() int64 {
+	if r.cfg.MaxFileSize <= 0 {
+		return 1 << 62
+	}
+	return int64(r.cfg.MaxFileSize) * 1024 * 1024
+}
+
+// ListLogs returns the session logs in a directory, oldest first
+func ListLogs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), FileExtension) {
+			logs = append(logs, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(logs) //names start with the session time
+	return logs, nil
+}
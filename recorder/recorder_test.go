@@ -0,0 +1,152 @@
+package recorder
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+)
+
+// writeLogs writes crsf records straight through the recorder, about a megabyte every 18
+func writeLogs(t *testing.T, r *Recorder, count int) {
+	t.Helper()
+	err := r.rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	data := make([]byte, 60000)
+	for i := 0; i < count; i++ {
+		data[0] = byte(i)
+		err = r.write(Record{Type: RecordTypeCRSF, Time: time.Now(), Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readAll(t *testing.T, path string) []Record {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make([]Record, 0, 32)
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return records
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestRecorderRotates(t *testing.T) {
+	dir := t.TempDir()
+	writeLogs(t, NewRecorder(config.RecorderConfig{Dir: dir, MaxFileSize: 1}), 40)
+
+	logs, err := ListLogs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 3 {
+		t.Fatalf("got %d logs want 3", len(logs))
+	}
+	total := 0
+	for _, path := range logs {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 1024*1024 {
+			t.Errorf("%s is %d bytes, over the limit", path, info.Size())
+		}
+		for _, record := range readAll(t, path) {
+			if int(record.Data[0]) != total {
+				t.Fatalf("record %d found out of order in %s", total, path)
+			}
+			total++
+		}
+	}
+	if total != 40 {
+		t.Errorf("read %d records want 40", total)
+	}
+}
+
+func TestRecorderRemovesOldLogs(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(dir+"/notes.txt", []byte("kept"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLogs(t, NewRecorder(config.RecorderConfig{Dir: dir, MaxFileSize: 1, MaxFiles: 2}), 80)
+
+	logs, err := ListLogs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("got %d logs want 2", len(logs))
+	}
+	records := readAll(t, logs[1])
+	if len(records) == 0 || records[len(records)-1].Data[0] != 79 {
+		t.Error("newest log was not kept")
+	}
+	_, err = os.Stat(dir + "/notes.txt")
+	if err != nil {
+		t.Errorf("other files removed: %s", err)
+	}
+}
+
+// A rotated log starts with the profile, trims, arming and e-stop state the last one ended in
+func TestRecorderRepeatsStateAfterRotating(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRecorder(config.RecorderConfig{Dir: dir, MaxFileSize: 1})
+	err := r.rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := []Record{
+		{Type: RecordTypeEStop, Latched: true, Reason: "button"},
+		{Type: RecordTypeProfile, Profile: profiles.Profile{Name: "drift"}},
+		{Type: RecordTypeTrims, Trims: map[string]int{"steer_trim": 4}},
+		{Type: RecordTypeTrims, Trims: map[string]int{"steer_trim": 8}},
+	}
+	for _, record := range state {
+		record.Time = time.Now()
+		err = r.write(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.close()
+	writeLogs(t, r, 20)
+
+	logs, err := ListLogs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 3 {
+		t.Fatalf("got %d logs want 3", len(logs))
+	}
+	for _, path := range logs[1:] {
+		records := readAll(t, path)
+		if len(records) < 3 {
+			t.Fatalf("%s: got %d records", path, len(records))
+		}
+		if records[0].Profile.Name != "drift" || records[1].Trims["steer_trim"] != 8 || !records[2].Latched {
+			t.Errorf("%s: starts with %+v", path, records[:3])
+		}
+	}
+}
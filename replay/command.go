@@ -0,0 +1,208 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/app"
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/recorder"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+var ErrMismatch = fmt.Errorf("replayed frames differ from the recording")
+
+// RunCommand replays a session log and writes the resulting frames as csv.
+// Returns ErrMismatch if any replayed output differs from the recorded one
+func RunCommand(ctx context.Context, args []string) error {
+	cfg := config.GetConfig()
+
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi_drift_wheel replay [flags] session.pdwrec")
+		flags.PrintDefaults()
+	}
+	realtime := flags.Bool("realtime", false, "replay at recorded speed instead of as fast as possible")
+	profileName := flags.String("profile", "", "profile to mix with, defaults to the selected profile")
+	stateDir := flags.String("state-dir", cfg.AppCfg.StateDir, "directory holding profiles and trims")
+	outPath := flags.String("out", "", "write frames here instead of stdout")
+	diffOnly := flags.Bool("diff", false, "only write ticks where the replayed output differs")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one session log")
+	}
+	sessionPath := flags.Arg(0)
+
+	cfg.AppCfg.StateDir = *stateDir
+	opts, err := LoadOptions(cfg, *profileName)
+	if err != nil {
+		return err
+	}
+	opts.Realtime = *realtime
+	opts.Controllers, err = ScanControllers(sessionPath)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *outPath != "" {
+		out, err = os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("failed creating output: %w", err)
+		}
+		defer out.Close()
+	}
+	writer := bufio.NewWriter(out)
+	defer writer.Flush()
+
+	file, err := os.Open(sessionPath)
+	if err != nil {
+		return fmt.Errorf("failed opening session: %w", err)
+	}
+	defer file.Close()
+	reader, err := recorder.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed reading session %s: %w", sessionPath, err)
+	}
+
+	slog.Info("replaying session", "path", sessionPath, "start", reader.Header().Start, "profile", opts.Profile.Name, "controllers", opts.Controllers, "realtime", opts.Realtime)
+	err = writeFrameHeader(writer)
+	if err != nil {
+		return err
+	}
+
+	ticks := 0
+	mismatches := 0
+	stalls := 0
+	err = NewPlayer(reader, opts).Run(ctx, func(tick Tick) error {
+		ticks++
+		if tick.Stalled {
+			stalls++
+		}
+		if !tick.Match {
+			if mismatches == 0 {
+				slog.Warn("first mismatch", "offset", tick.Offset, "replayed", tick.Replayed.Frame.Ch, "recorded", tick.Recorded.Frame.Ch, "error", tick.Err)
+			}
+			mismatches++
+		} else if *diffOnly {
+			return nil
+		}
+		return writeFrameRow(writer, tick)
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("replay finished", "ticks", ticks, "mismatches", mismatches, "watchdog_trips", stalls)
+	if mismatches > 0 {
+		return fmt.Errorf("%w: %d of %d ticks", ErrMismatch, mismatches, ticks)
+	}
+	return nil
+}
+
+// LoadOptions picks the profile and its saved trims from the state dir without changing the selection.
+// Sessions that record the profile and trims the app applied replay with those instead
+func LoadOptions(cfg config.Config, profileName string) (Options, error) {
+	profileManager := profiles.NewProfileManager(cfg.AppCfg.StateDir, app.DefaultProfile(cfg))
+	err := profileManager.Load()
+	if err != nil {
+		slog.Warn("failed loading profiles, using default", "error", err)
+	}
+
+	profile := profileManager.Active()
+	if profileName != "" {
+		found := false
+		for _, p := range profileManager.Profiles() {
+			if p.Name == profileName {
+				profile = p
+				found = true
+				break
+			}
+		}
+		if !found {
+			return Options{}, fmt.Errorf("%w: %s", profiles.ErrNotFound, profileName)
+		}
+	}
+
+	return Options{
+		Profile:         profile,
+		Trims:           profileManager.Trims(profile.Name),
+		Stage:           app.NewStageConfig(cfg),
+		InputMerge:      cfg.ControllerManagerCfg.InputMergePolicies,
+		WatchdogTimeout: time.Duration(cfg.AppCfg.WatchdogTimeout) * time.Millisecond,
+	}, nil
+}
+
+// ScanControllers lists the controllers that sent inputs in a session, in the order they first appear
+func ScanControllers(sessionPath string) ([]string, error) {
+	file, err := os.Open(sessionPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening session: %w", err)
+	}
+	defer file.Close()
+	reader, err := recorder.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading session %s: %w", sessionPath, err)
+	}
+
+	names := make([]string, 0, 2)
+	seen := make(map[string]bool, 2)
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return names, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed reading session: %w", err)
+		}
+		if record.Type == recorder.RecordTypeInput && !seen[record.Source] {
+			seen[record.Source] = true
+			names = append(names, record.Source)
+		}
+	}
+}
+
+func writeFrameHeader(w io.Writer) error {
+	_, err := io.WriteString(w, "offset_ms,match")
+	if err != nil {
+		return err
+	}
+	for _, prefix := range []string{"replayed", "recorded"} {
+		for i := 0; i < sbus.MaxChannels; i++ {
+			_, err = fmt.Fprintf(w, ",%s_ch%d", prefix, i)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func writeFrameRow(w io.Writer, tick Tick) error {
+	row := make([]byte, 0, 256)
+	row = strconv.AppendFloat(row, float64(tick.Offset.Microseconds())/1000, 'f', 3, 64)
+	row = append(row, ',')
+	row = strconv.AppendBool(row, tick.Match)
+	for _, frame := range []sbus.SBusFrame{tick.Replayed, tick.Recorded} {
+		for _, value := range frame.Frame.Ch {
+			row = append(row, ',')
+			row = strconv.AppendUint(row, uint64(value), 10)
+		}
+	}
+	row = append(row, '\n')
+	_, err := w.Write(row)
+	return err
+}
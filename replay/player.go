@@ -0,0 +1,323 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"syscall"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/app"
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/controllers"
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/crsf"
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	"github.com/Speshl/pi_drift_wheel/go-evdev"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/recorder"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+type Options struct {
+	Profile         profiles.Profile  //mixed with until the session records the profile the app applied
+	Trims           map[string]int    //trims until the session records the ones the app applied
+	Stage           app.StageConfig   //receivers, merge policies and checks, indexed like the config
+	InputMerge      map[string]string //per controller input label, parsed once the controllers are created
+	Controllers     []string          //controllers to create before the first tick, in the order the app loaded them
+	Realtime        bool              //false replays as fast as possible
+	WatchdogTimeout time.Duration     //gap between recorded outputs that tripped the app's watchdog, zero to not check
+}
+
+// Tick is the result of one recorded processing tick run back through the output stage
+type Tick struct {
+	Time     time.Time
+	Offset   time.Duration //time since the first record
+	Mixed    sbus.SBusFrame
+	MixState models.MixState
+	Replayed sbus.SBusFrame //output frame after remapping and inverting
+	Recorded sbus.SBusFrame //output frame the app sent at this tick
+	Armed    bool           //false when the replayed output was held neutral
+	EStop    bool           //the e-stop was latched
+	Stalled  bool           //the outputs went this long without a frame that the app's watchdog tripped
+	Match    bool           //replayed output and, when the session records it, arming match the recording
+	Err      error          //set when the mixer could not produce a frame
+
+	RecordedArmed bool //arming the app recorded, the arming default until the session records a change
+
+	Inputs    []models.Input     //merged raw controller inputs
+	Telemetry crsf.CRSFTelemetry //latest telemetry from crsf port 0, the port the app uses for feedback
+	GpsTime   time.Time          //when the gps in Telemetry was received, zero before the first fix
+}
+
+// Player drives the controller manager and the app's output stage from a session log instead of real devices.
+// Every recorded output frame is one tick, so replayed frames line up with what was recorded
+type Player struct {
+	reader            *recorder.Reader
+	opts              Options
+	controllerManager *controllers.ControllerManager
+	controllers       map[string]*controllers.Controller //nil for unsupported sources
+	stage             *app.Stage
+	estop             *app.EStop
+	watchdog          *app.Watchdog
+	sources           *sessionSources
+	telemetry         *crsf.CRSF
+	gpsTime           time.Time
+
+	recordedArmed  bool
+	armingRecorded bool //the session has arming records to compare against
+}
+
+func NewPlayer(reader *recorder.Reader, opts Options) *Player {
+	controllerManager := controllers.NewControllerManager(config.ControllerManagerConfig{}, opts.Profile.ControllerOptions())
+	if opts.Trims != nil {
+		controllerManager.SetTrims(opts.Trims)
+	}
+	p := &Player{
+		reader:            reader,
+		opts:              opts,
+		controllerManager: controllerManager,
+		controllers:       make(map[string]*controllers.Controller, len(opts.Controllers)),
+		estop:             app.NewEStop(config.EStopConfig{}),
+		watchdog:          app.NewWatchdog(opts.WatchdogTimeout),
+		sources:           newSessionSources(),
+		telemetry:         crsf.NewCRSF("replay", nil),
+		recordedArmed:     !opts.Stage.Arming.Enabled,
+	}
+	p.stage = app.NewStage(opts.Stage, controllerManager, p.estop, p.watchdog)
+	p.stage.SetProfile(opts.Profile)
+	for _, name := range opts.Controllers {
+		p.controller(name)
+	}
+	inputPolicies, err := app.ParseInputMergePolicies(opts.InputMerge, controllerManager.SourceNames())
+	if err != nil {
+		slog.Warn("failed parsing input merge policies, merging those inputs furthest from rest", "error", err)
+	}
+	controllerManager.SetInputMerge(app.InputMerge(inputPolicies))
+	if opts.Stage.Trainer.Enabled && opts.Stage.Trainer.Instructor == app.InstructorController {
+		err := controllerManager.SetInstructor(opts.Stage.Trainer.Device) //recorded controllers are matched by name
+		if err != nil {
+			slog.Warn("instructor controller not in session, replaying without it", "device", opts.Stage.Trainer.Device, "error", err)
+		}
+	}
+	return p
+}
+
+// Run reads the session to the end calling onTick for every recorded output frame
+func (p *Player) Run(ctx context.Context, onTick func(Tick) error) error {
+	var first time.Time
+	wallStart := time.Now()
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		record, err := p.reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed reading session: %w", err)
+		}
+
+		if first.IsZero() {
+			first = record.Time
+		}
+		offset := record.Time.Sub(first)
+		if p.opts.Realtime {
+			err = sleepUntil(ctx, wallStart.Add(offset))
+			if err != nil {
+				return err
+			}
+		}
+
+		switch record.Type {
+		case recorder.RecordTypeInput:
+			p.applyInput(record)
+		case recorder.RecordTypeSBusRX:
+			p.sources.sbusFrames[record.Port] = record.Frame
+			p.sources.sbusTimes[record.Port] = record.Time
+		case recorder.RecordTypeCRSF:
+			p.applyTelemetry(record)
+		case recorder.RecordTypeProfile:
+			p.stage.SetProfile(record.Profile)
+		case recorder.RecordTypeTrims:
+			p.controllerManager.SetTrims(record.Trims)
+		case recorder.RecordTypeArming:
+			p.recordedArmed = record.Armed
+			p.armingRecorded = true
+		case recorder.RecordTypeEStop:
+			if record.Latched {
+				p.estop.Trigger(record.Time, record.Reason)
+			} else {
+				p.estop.Reset(record.Time)
+			}
+		case recorder.RecordTypeOutput:
+			err = onTick(p.tick(record, offset))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *Player) applyInput(record recorder.Record) {
+	controller := p.controller(record.Source)
+	if controller == nil {
+		return
+	}
+	controller.ApplyEvent(&evdev.InputEvent{
+		Time:  syscall.NsecToTimeval(record.Time.UnixNano()),
+		Type:  evdev.EvType(record.EventType),
+		Code:  evdev.EvCode(record.EventCode),
+		Value: record.EventValue,
+	})
+}
+
+func (p *Player) applyTelemetry(record recorder.Record) {
+	if len(record.Data) == 0 {
+		return
+	}
+	p.sources.applyCRSF(record)
+	if record.Port != 0 {
+		return
+	}
+	err := p.telemetry.UpdateFrame(record.Data)
+	if err != nil {
+		slog.Debug("skipping recorded crsf frame", "type", crsf.FrameType(record.Data[0]).String(), "error", err)
+		return
+	}
+	if crsf.FrameType(record.Data[0]) == crsf.FrameTypeGPS {
+		p.gpsTime = record.Time
+	}
+}
+
+func (p *Player) controller(name string) *controllers.Controller {
+	controller, ok := p.controllers[name]
+	if ok {
+		return controller
+	}
+	controller, err := p.controllerManager.AddVirtualController(name)
+	if err != nil {
+		slog.Warn("ignoring inputs from unsupported controller", "name", name, "error", err)
+	}
+	p.controllers[name] = controller
+	return controller
+}
+
+// tick runs the output stage the app ran when it sent the recorded frame
+func (p *Player) tick(record recorder.Record, offset time.Duration) Tick {
+	tick := Tick{
+		Time:          record.Time,
+		Offset:        offset,
+		Recorded:      sbus.SBusFrame{Frame: record.Frame, Priority: record.Priority},
+		RecordedArmed: p.recordedArmed,
+		Telemetry:     p.telemetry.GetData().CRSFTelemetry,
+		GpsTime:       p.gpsTime,
+	}
+	if p.opts.WatchdogTimeout > 0 {
+		tick.Stalled = p.watchdog.Check(record.Time) //before the stage beats it with this tick's frame
+	}
+
+	result := p.stage.Tick(record.Time, p.sources)
+	tick.Mixed = result.Mixed
+	tick.MixState = result.MixState.Copy()
+	tick.Inputs = p.controllerManager.GetInputs()
+	tick.Armed = result.Armed
+	tick.EStop = p.estop.Latched()
+	tick.Replayed = result.Output
+	tick.Err = result.Err
+	tick.Match = tick.Replayed.Frame.Ch == tick.Recorded.Frame.Ch && (!p.armingRecorded || tick.Armed == p.recordedArmed)
+	return tick
+}
+
+// sessionSources are the receivers as last recorded, read by the output stage like the app reads its ports
+type sessionSources struct {
+	sbusFrames map[int]sbus.Frame
+	sbusTimes  map[int]time.Time //when each sbus port's latest frame was recorded
+	crsfLinks  map[int]app.CRSFLink
+	attitudes  map[int]attitudeSample
+}
+
+type attitudeSample struct {
+	attitude frames.AttitudeData
+	received time.Time
+}
+
+func newSessionSources() *sessionSources {
+	return &sessionSources{
+		sbusFrames: make(map[int]sbus.Frame, config.MaxSbus),
+		sbusTimes:  make(map[int]time.Time, config.MaxSbus),
+		crsfLinks:  make(map[int]app.CRSFLink, config.MaxCRSF),
+		attitudes:  make(map[int]attitudeSample, 1),
+	}
+}
+
+// applyCRSF keeps the channels, link statistics and attitude of each port with when they were recorded
+func (s *sessionSources) applyCRSF(record recorder.Record) {
+	link, ok := s.crsfLinks[record.Port]
+	if !ok {
+		link.Channels = sbus.NewFrame()
+	}
+	switch crsf.FrameType(record.Data[0]) {
+	case crsf.FrameTypeChannels:
+		channels, err := frames.UnmarshalChannels(record.Data)
+		if err != nil {
+			return
+		}
+		link.Channels = app.CRSFChannelsFrame(channels)
+		link.ChannelsReceived = record.Time
+	case crsf.FrameTypeLinkStats:
+		linkStats, err := frames.UnmarshalLinkStats(record.Data)
+		if err != nil {
+			return
+		}
+		link.UplinkQuality = linkStats.UplinkQuality
+		link.LinkStatsReceived = record.Time
+	case crsf.FrameTypeAttitude:
+		attitude, err := frames.UnmarshalAttitude(record.Data)
+		if err == nil {
+			s.attitudes[record.Port] = attitudeSample{attitude: attitude, received: record.Time}
+		}
+		return
+	default:
+		return
+	}
+	s.crsfLinks[record.Port] = link
+}
+
+func (s *sessionSources) SBus(port int) (sbus.Frame, time.Time) {
+	frame, ok := s.sbusFrames[port]
+	if !ok {
+		return sbus.NewFrame(), time.Time{}
+	}
+	return frame, s.sbusTimes[port]
+}
+
+func (s *sessionSources) CRSF(port int) app.CRSFLink {
+	link, ok := s.crsfLinks[port]
+	if !ok {
+		return app.CRSFLink{Channels: sbus.NewFrame()}
+	}
+	return link
+}
+
+func (s *sessionSources) Attitude(port int) (frames.AttitudeData, time.Time) {
+	sample := s.attitudes[port]
+	return sample.attitude, sample.received
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
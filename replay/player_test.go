@@ -0,0 +1,301 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/app"
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/crsf"
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	"github.com/Speshl/pi_drift_wheel/go-evdev"
+	"github.com/Speshl/pi_drift_wheel/profiles"
+	"github.com/Speshl/pi_drift_wheel/recorder"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+const wheel = "G27 Racing Wheel"
+
+// session builds a session log holding the records in order
+func session(t *testing.T, start time.Time, records []recorder.Record) *recorder.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	err := recorder.WriteHeader(&buf, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		data, err := recorder.MarshalRecord(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(data)
+	}
+	reader, err := recorder.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func replayTicks(t *testing.T, reader *recorder.Reader, opts Options) []Tick {
+	t.Helper()
+	var ticks []Tick
+	err := NewPlayer(reader, opts).Run(context.Background(), func(tick Tick) error {
+		ticks = append(ticks, tick)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ticks
+}
+
+// instructorRadio is an instructor frame with the takeover switch on channel 4 high
+func instructorRadio() sbus.Frame {
+	frame := sbus.NewFrame()
+	frame.Ch[0] = 1500
+	frame.Ch[1] = 1200
+	frame.Ch[2] = uint16(sbus.MaxValue)
+	frame.Ch[4] = uint16(sbus.MaxValue)
+	return frame
+}
+
+func trainerOptions() Options {
+	return Options{
+		Controllers: []string{wheel},
+		Stage: app.StageConfig{
+			SBusRemaps: []sbus.Remap{sbus.IdentityRemap([]int{3}), nil}, //sbus1 is the instructor radio
+			Trainer: config.TrainerConfig{
+				Enabled:         true,
+				Instructor:      app.SBusSource(1),
+				TakeoverChannel: 4,
+				StudentThrottle: 100,
+			},
+			Arming: config.ArmingConfig{SourceTimeout: 250},
+		},
+	}
+}
+
+func TestPlayerTrainerTakeover(t *testing.T) {
+	start := time.Now()
+	records := []recorder.Record{
+		{Type: recorder.RecordTypeSBusRX, Time: start, Port: 1, Frame: instructorRadio()},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(10 * time.Millisecond), Frame: instructorRadio()},
+	}
+
+	ticks := replayTicks(t, session(t, start, records), trainerOptions())
+	if len(ticks) != 1 {
+		t.Fatalf("got %d ticks want 1", len(ticks))
+	}
+	if ticks[0].Err != nil || !ticks[0].Match {
+		t.Errorf("instructor takeover not replayed, err %v replayed %v recorded %v", ticks[0].Err, ticks[0].Replayed.Frame.Ch, ticks[0].Recorded.Frame.Ch)
+	}
+
+	opts := trainerOptions()
+	opts.Stage.Trainer.Enabled = false
+	ticks = replayTicks(t, session(t, start, records), opts)
+	if ticks[0].Match {
+		t.Error("replay without the trainer matched the instructor's frame")
+	}
+}
+
+func TestPlayerGyro(t *testing.T) {
+	start := time.Now()
+	yawZero := frames.AttitudeData{}
+	yawTen := frames.AttitudeData{Yaw: 1745} //10 degrees in radians * 10000
+	output := instructorRadio()
+	output.Ch[0] -= 200 //100 degrees a second countered at 2 steps each with full gain
+	records := []recorder.Record{
+		{Type: recorder.RecordTypeSBusRX, Time: start, Port: 1, Frame: instructorRadio()},
+		{Type: recorder.RecordTypeCRSF, Time: start, Port: 0, Data: yawZero.Marshal()},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(50 * time.Millisecond), Frame: instructorRadio()}, //one sample, no rate yet
+		{Type: recorder.RecordTypeCRSF, Time: start.Add(100 * time.Millisecond), Port: 0, Data: yawTen.Marshal()},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(105 * time.Millisecond), Frame: output},
+	}
+
+	opts := trainerOptions()
+	opts.Stage.Gyro = config.GyroConfig{
+		Enabled:       true,
+		Mode:          app.GyroModeRate,
+		RateGain:      2,
+		MaxCorrection: 400,
+		Timeout:       250,
+	}
+	ticks := replayTicks(t, session(t, start, records), opts)
+	if len(ticks) != 2 {
+		t.Fatalf("got %d ticks want 2", len(ticks))
+	}
+	for i := range ticks {
+		if !ticks[i].Match {
+			t.Errorf("tick %d: gyro not replayed, steer replayed %d recorded %d", i, ticks[i].Replayed.Frame.Ch[0], ticks[i].Recorded.Frame.Ch[0])
+		}
+	}
+}
+
+func TestPlayerDropsSilentSBus(t *testing.T) {
+	start := time.Now()
+	radio := sbus.NewFrame()
+	radio.Ch[3] = 1500
+	failsafe := radio
+	failsafe.Flags.Failsafe = true
+	neutral := sbus.NewFrame()
+	records := []recorder.Record{
+		{Type: recorder.RecordTypeSBusRX, Time: start, Port: 0, Frame: radio},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(10 * time.Millisecond), Frame: radio},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(400 * time.Millisecond), Frame: neutral}, //receiver went quiet
+		{Type: recorder.RecordTypeSBusRX, Time: start.Add(410 * time.Millisecond), Port: 0, Frame: failsafe},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(420 * time.Millisecond), Frame: neutral},
+	}
+
+	opts := trainerOptions()
+	opts.Stage.Trainer.Enabled = false
+	ticks := replayTicks(t, session(t, start, records), opts)
+	if len(ticks) != 3 {
+		t.Fatalf("got %d ticks want 3", len(ticks))
+	}
+	for i, want := range []uint16{1500, uint16(sbus.MidValue), uint16(sbus.MidValue)} {
+		if got := ticks[i].Replayed.Frame.Ch[3]; got != want {
+			t.Errorf("tick %d: ch3 got %d want %d", i, got, want)
+		}
+	}
+}
+
+// crsfChannels packs a frame's channels into a crsf channels frame, crsf packs them like sbus
+func crsfChannels(frame sbus.Frame) []byte {
+	data := append([]byte{byte(crsf.FrameTypeChannels)}, frame.Marshal()[1:23]...)
+	return append(data, frames.GenerateCrc8Value(data))
+}
+
+func TestPlayerDropsLostCRSFLink(t *testing.T) {
+	start := time.Now()
+	radio := sbus.NewFrame()
+	radio.Ch[3] = 1500
+	weak := frames.LinkStatsData{UplinkQuality: 10}
+	records := []recorder.Record{
+		{Type: recorder.RecordTypeCRSF, Time: start, Port: 0, Data: crsfChannels(radio)},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(10 * time.Millisecond), Frame: radio},
+		{Type: recorder.RecordTypeCRSF, Time: start.Add(20 * time.Millisecond), Port: 0, Data: weak.Marshal()},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(30 * time.Millisecond), Frame: sbus.NewFrame()},
+		{Type: recorder.RecordTypeCRSF, Time: start.Add(300 * time.Millisecond), Port: 0, Data: (&frames.LinkStatsData{UplinkQuality: 90}).Marshal()},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(310 * time.Millisecond), Frame: sbus.NewFrame()}, //channels stopped
+	}
+
+	opts := Options{
+		Controllers: []string{wheel},
+		Stage: app.StageConfig{
+			CRSFRemaps:         []sbus.Remap{sbus.IdentityRemap([]int{3})},
+			CRSFMinLinkQuality: []int{50},
+			Arming:             config.ArmingConfig{SourceTimeout: 250},
+		},
+	}
+	ticks := replayTicks(t, session(t, start, records), opts)
+	if len(ticks) != 3 {
+		t.Fatalf("got %d ticks want 3", len(ticks))
+	}
+	for i := range ticks {
+		if ticks[i].Replayed.Frame.Ch[3] != ticks[i].Recorded.Frame.Ch[3] {
+			t.Errorf("tick %d: ch3 replayed %d recorded %d", i, ticks[i].Replayed.Frame.Ch[3], ticks[i].Recorded.Frame.Ch[3])
+		}
+	}
+}
+
+func TestPlayerAppliesRecordedState(t *testing.T) {
+	start := time.Now()
+	radio := sbus.NewFrame()
+	radio.Ch[3] = 1500
+	profile := profiles.Profile{Name: "drift", InvertOutputs: []bool{false, false, false, true}}
+	inverted := app.InvertChannels(sbus.SBusFrame{Frame: radio}, profile.InvertOutputs).Frame
+	records := []recorder.Record{
+		{Type: recorder.RecordTypeSBusRX, Time: start, Port: 0, Frame: radio},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(10 * time.Millisecond), Frame: radio},
+		{Type: recorder.RecordTypeProfile, Time: start.Add(15 * time.Millisecond), Profile: profile},
+		{Type: recorder.RecordTypeTrims, Time: start.Add(15 * time.Millisecond), Trims: map[string]int{profiles.TrimSteer: 40}},
+		{Type: recorder.RecordTypeSBusRX, Time: start.Add(15 * time.Millisecond), Port: 0, Frame: radio},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(20 * time.Millisecond), Frame: inverted},
+		{Type: recorder.RecordTypeArming, Time: start.Add(25 * time.Millisecond), Reason: app.DisarmKill},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(30 * time.Millisecond), Frame: inverted},
+	}
+
+	opts := trainerOptions()
+	opts.Stage.Trainer.Enabled = false
+	ticks := replayTicks(t, session(t, start, records), opts)
+	if len(ticks) != 3 {
+		t.Fatalf("got %d ticks want 3", len(ticks))
+	}
+	if got := ticks[1].Replayed.Frame.Ch[3]; got != inverted.Ch[3] {
+		t.Errorf("recorded profile not applied, ch3 got %d want %d", got, inverted.Ch[3])
+	}
+	if steer := int(ticks[1].Mixed.Frame.Ch[0]) - int(ticks[0].Mixed.Frame.Ch[0]); steer != 40 {
+		t.Errorf("recorded trims not applied, steer moved %d want 40", steer)
+	}
+	if !ticks[1].RecordedArmed || ticks[2].RecordedArmed || !ticks[2].Armed {
+		t.Errorf("recorded arming got %t then %t", ticks[1].RecordedArmed, ticks[2].RecordedArmed)
+	}
+
+	//record what was replayed, only the arming record then differs
+	records[1].Frame = ticks[0].Replayed.Frame
+	records[5].Frame = ticks[1].Replayed.Frame
+	records[7].Frame = ticks[2].Replayed.Frame
+	ticks = replayTicks(t, session(t, start, records), opts)
+	if !ticks[0].Match || !ticks[1].Match || ticks[2].Match {
+		t.Errorf("matches got %t %t %t want true true false", ticks[0].Match, ticks[1].Match, ticks[2].Match)
+	}
+}
+
+func TestPlayerEStop(t *testing.T) {
+	start := time.Now()
+	const armButton = 295 //top_left on the g27
+	records := []recorder.Record{
+		{Type: recorder.RecordTypeInput, Time: start, Source: wheel, EventType: uint16(evdev.EV_KEY), EventCode: armButton, EventValue: 1},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(10 * time.Millisecond)},
+		{Type: recorder.RecordTypeEStop, Time: start.Add(20 * time.Millisecond), Latched: true, Reason: app.EStopDevice},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(30 * time.Millisecond)},
+		{Type: recorder.RecordTypeEStop, Time: start.Add(40 * time.Millisecond)},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(50 * time.Millisecond)},
+	}
+
+	opts := Options{
+		Controllers: []string{wheel},
+		Stage: app.StageConfig{
+			Arming: config.ArmingConfig{
+				Enabled:       true,
+				ArmButton:     "top_left",
+				CenterRange:   sbus.MaxValue,
+				ThrottleRange: 100,
+				SourceTimeout: 250,
+			},
+		},
+	}
+	ticks := replayTicks(t, session(t, start, records), opts)
+	if len(ticks) != 3 {
+		t.Fatalf("got %d ticks want 3", len(ticks))
+	}
+	for i, want := range []struct{ armed, estop bool }{{true, false}, {false, true}, {true, false}} {
+		if ticks[i].Armed != want.armed || ticks[i].EStop != want.estop {
+			t.Errorf("tick %d: armed %t estop %t want %t %t", i, ticks[i].Armed, ticks[i].EStop, want.armed, want.estop)
+		}
+	}
+	if ticks[1].Replayed.Frame.Ch != sbus.NewFrame().Ch {
+		t.Errorf("output not neutral while the e-stop was latched: %v", ticks[1].Replayed.Frame.Ch)
+	}
+}
+
+func TestPlayerWatchdog(t *testing.T) {
+	start := time.Now()
+	records := []recorder.Record{
+		{Type: recorder.RecordTypeOutput, Time: start},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(10 * time.Millisecond)},
+		{Type: recorder.RecordTypeOutput, Time: start.Add(200 * time.Millisecond)}, //processing stalled
+		{Type: recorder.RecordTypeOutput, Time: start.Add(210 * time.Millisecond)},
+	}
+	opts := Options{Controllers: []string{wheel}, WatchdogTimeout: 100 * time.Millisecond}
+	ticks := replayTicks(t, session(t, start, records), opts)
+	for i, want := range []bool{false, false, true, false} {
+		if ticks[i].Stalled != want {
+			t.Errorf("tick %d: stalled %t want %t", i, ticks[i].Stalled, want)
+		}
+	}
+}
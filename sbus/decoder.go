@@ -0,0 +1,182 @@
+package sbus
+
+import "time"
+
+const (
+	//a frame is 25 bytes at 100000 baud 8E2, 3ms on the wire, and frames come every 7 or 14ms.
+	//A quiet line for longer than a few byte times means the next byte starts a frame
+	FrameGap = 2 * time.Millisecond
+)
+
+// Stats counts what a Decoder has seen on one port
+type Stats struct {
+	Frames          uint64 //complete frames decoded
+	SBus2Frames     uint64 //frames ending in a telemetry slot marker
+	SyncLosses      uint64 //partial or misaligned frames thrown away
+	StartByteMisses uint64 //bytes outside a frame that were not a start byte
+	FrameLost       uint64 //frames with the frame lost flag
+	Failsafe        uint64 //frames with the failsafe flag
+	Slots           uint64 //sbus2 telemetry slots read
+}
+
+// Decoder finds frames in a byte stream. A frame must start with the start byte, end with an
+// sbus or sbus2 end byte and, when the reads are timed, start after a gap in the stream.
+// 0x0f shows up inside channel data so out of sync a timed decoder only starts a frame on the
+// first byte of a read after a gap. Untimed, a bad frame is rescanned from its next start byte
+type Decoder struct {
+	buff     []byte
+	lastRead time.Time
+	synced   bool
+	stats    Stats
+
+	slotGroup int //telemetry slots expected after an sbus2 frame, -1 when none
+	slot      []byte
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		buff:      make([]byte, 0, frameLength),
+		slotGroup: -1,
+		slot:      make([]byte, 0, slotLength),
+	}
+}
+
+// Feed takes the bytes from one read and when the read returned. A zero time skips the gap check.
+// Returns the frames and sbus2 telemetry slots completed by this read
+func (d *Decoder) Feed(data []byte, readTime time.Time) ([]Frame, []Slot) {
+	if d.isGap(data, readTime) { //the line went quiet mid frame and a new one is starting
+		d.lostSync()
+		d.buff = d.buff[:0]
+	}
+	timed := !readTime.IsZero()
+	afterGap := d.lastRead.IsZero() || readTime.Sub(d.lastRead) > FrameGap+byteTime(len(data)) //nothing read yet counts as a gap
+	if len(d.slot) > 0 && !readTime.IsZero() && readTime.Sub(d.lastRead) > FrameGap+byteTime(len(data)) {
+		d.slot = d.slot[:0] //a slot's bytes come together, the rest of this one is not coming
+	}
+	if timed {
+		d.lastRead = readTime
+	}
+
+	var frames []Frame
+	var slots []Slot
+	for i, b := range data {
+		if len(d.buff) == 0 && d.slotGroup >= 0 {
+			slot, consumed := d.feedSlot(b)
+			if slot != nil {
+				slots = append(slots, *slot)
+			}
+			if consumed {
+				continue
+			}
+		}
+		if len(d.buff) == 0 && b != startByte {
+			d.stats.StartByteMisses++
+			continue
+		}
+		if len(d.buff) == 0 && timed && !d.synced && (i > 0 || !afterGap) {
+			d.stats.StartByteMisses++ //a start byte mid stream is as likely channel data, wait for a gap
+			continue
+		}
+		d.buff = append(d.buff, b)
+		if len(d.buff) < frameLength {
+			continue
+		}
+
+		frame, err := UnmarshalFrame(d.buff)
+		if err != nil {
+			d.lostSync()
+			if timed {
+				d.buff = d.buff[:0]
+			} else {
+				d.rescan()
+			}
+			continue
+		}
+		d.synced = true
+		d.buff = d.buff[:0]
+		d.count(frame)
+		frames = append(frames, frame)
+		d.slotGroup = -1
+		if group, ok := frame.SBus2SlotGroup(); ok {
+			d.slotGroup = group
+		}
+	}
+	return frames, slots
+}
+
+// feedSlot collects slot bytes between frames, false when the byte is not part of a slot
+func (d *Decoder) feedSlot(b byte) (*Slot, bool) {
+	if len(d.slot) == 0 {
+		if _, ok := slotNumber(d.slotGroup, b); !ok {
+			if b == startByte { //slots are over, the next frame is starting
+				d.slotGroup = -1
+			}
+			return nil, false
+		}
+	}
+	d.slot = append(d.slot, b)
+	if len(d.slot) < slotLength {
+		return nil, true
+	}
+	number, _ := slotNumber(d.slotGroup, d.slot[0])
+	slot := &Slot{Number: number, Value: uint16(d.slot[1])<<8 | uint16(d.slot[2])}
+	d.slot = d.slot[:0]
+	d.stats.Slots++
+	return slot, true
+}
+
+// isGap is true when a read starts a new frame after a quiet line while one is partly read.
+// A late read of the rest of a frame, from a slow reader, does not start with the start byte
+func (d *Decoder) isGap(data []byte, readTime time.Time) bool {
+	if len(d.buff) == 0 || len(data) == 0 || data[0] != startByte {
+		return false
+	}
+	if readTime.IsZero() || d.lastRead.IsZero() {
+		return false
+	}
+	return readTime.Sub(d.lastRead) > FrameGap+byteTime(len(data))
+}
+
+// Stats returns the counts so far
+func (d *Decoder) Stats() Stats {
+	return d.stats
+}
+
+// Synced is true when the last frame decoded cleanly
+func (d *Decoder) Synced() bool {
+	return d.synced
+}
+
+func (d *Decoder) count(frame Frame) {
+	d.stats.Frames++
+	if _, ok := frame.SBus2SlotGroup(); ok {
+		d.stats.SBus2Frames++
+	}
+	if frame.Flags.Framelost {
+		d.stats.FrameLost++
+	}
+	if frame.Flags.Failsafe {
+		d.stats.Failsafe++
+	}
+}
+
+func (d *Decoder) lostSync() {
+	d.stats.SyncLosses++
+	d.synced = false
+}
+
+// rescan drops a bad frame up to the next start byte inside it
+func (d *Decoder) rescan() {
+	for i := 1; i < len(d.buff); i++ {
+		if d.buff[i] == startByte {
+			d.buff = append(d.buff[:0], d.buff[i:]...)
+			return
+		}
+	}
+	d.buff = d.buff[:0]
+}
+
+// byteTime is how long n bytes take on the wire, a read returns after its last byte arrives
+func byteTime(n int) time.Duration {
+	return time.Duration(n) * 120 * time.Microsecond
+}
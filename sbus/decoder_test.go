@@ -0,0 +1,196 @@
+package sbus
+
+import (
+	"testing"
+	"time"
+)
+
+func testFrame(value uint16) Frame {
+	frame := NewFrame()
+	frame.Ch[0] = value
+	return frame
+}
+
+func TestDecoderBackToBack(t *testing.T) {
+	decoder := NewDecoder()
+	var stream []byte
+	for i := 0; i < 3; i++ {
+		stream = append(stream, testFrame(uint16(1000+i)).Marshal()...)
+	}
+	frames, _ := decoder.Feed(stream, time.Time{})
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames want 3", len(frames))
+	}
+	for i := range frames {
+		if frames[i].Ch[0] != uint16(1000+i) {
+			t.Errorf("frame %d: ch0 %d", i, frames[i].Ch[0])
+		}
+	}
+	if stats := decoder.Stats(); stats.Frames != 3 || stats.SyncLosses != 0 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+// A 0x0f inside channel data must not leave the decoder misaligned
+func TestDecoderResyncsFromStartByteInData(t *testing.T) {
+	decoder := NewDecoder()
+	frame := NewFrame()
+	frame.Ch[0] = 0x070f //first data byte is the start byte
+	data := frame.Marshal()
+
+	//join mid frame so the first start byte seen is the one inside the data
+	stream := append([]byte{}, data[1:]...)
+	stream = append(stream, data...)
+	stream = append(stream, data...)
+	frames, _ := decoder.Feed(stream, time.Time{})
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames want 2", len(frames))
+	}
+	for i := range frames {
+		if frames[i] != frame {
+			t.Errorf("frame %d: got %v want %v", i, frames[i].Ch, frame.Ch)
+		}
+	}
+	if !decoder.Synced() {
+		t.Error("decoder not synced")
+	}
+	if decoder.Stats().SyncLosses == 0 {
+		t.Error("expected the misaligned frame to count as a sync loss")
+	}
+}
+
+func TestDecoderGapDropsPartialFrame(t *testing.T) {
+	decoder := NewDecoder()
+	now := time.Now()
+	data := testFrame(1500).Marshal()
+
+	frames, _ := decoder.Feed(data[:10], now)
+	if len(frames) != 0 {
+		t.Fatalf("got %d frames from a partial frame", len(frames))
+	}
+	//the rest never came, a new frame starts after the gap
+	frames, _ = decoder.Feed(data, now.Add(7*time.Millisecond))
+	if len(frames) != 1 || frames[0].Ch[0] != 1500 {
+		t.Fatalf("got %v", frames)
+	}
+	if stats := decoder.Stats(); stats.SyncLosses != 1 {
+		t.Errorf("sync losses got %d want 1", stats.SyncLosses)
+	}
+
+	//a frame split over reads with no gap still decodes
+	later := now.Add(20 * time.Millisecond)
+	decoder.Feed(data[:12], later)
+	frames, _ = decoder.Feed(data[12:], later.Add(byteTime(len(data)-12)))
+	if len(frames) != 1 {
+		t.Errorf("split frame: got %d frames", len(frames))
+	}
+}
+
+func TestDecoderSBus2EndBytes(t *testing.T) {
+	decoder := NewDecoder()
+	var stream []byte
+	for group, end := range []byte{0x04, 0x14, 0x24, 0x34, 0x00} {
+		frame := testFrame(uint16(200 + group))
+		frame.EndByte = end
+		stream = append(stream, frame.Marshal()...)
+	}
+	frames, _ := decoder.Feed(stream, time.Time{})
+	if len(frames) != 5 {
+		t.Fatalf("got %d frames want 5", len(frames))
+	}
+	for i := 0; i < 4; i++ {
+		group, ok := frames[i].SBus2SlotGroup()
+		if !ok || group != i {
+			t.Errorf("frame %d: slot group %d %t", i, group, ok)
+		}
+	}
+	if _, ok := frames[4].SBus2SlotGroup(); ok {
+		t.Error("plain sbus frame reported a slot group")
+	}
+	if stats := decoder.Stats(); stats.SBus2Frames != 4 {
+		t.Errorf("sbus2 frames got %d want 4", stats.SBus2Frames)
+	}
+}
+
+func TestDecoderFlagStats(t *testing.T) {
+	decoder := NewDecoder()
+	lost := NewFrame()
+	lost.Flags.Framelost = true
+	failsafe := NewFrame()
+	failsafe.Flags.Failsafe = true
+	failsafe.Flags.Framelost = true
+
+	stream := append(lost.Marshal(), failsafe.Marshal()...)
+	stream = append(stream, 0x00, 0x33) //trailing noise
+	decoder.Feed(stream, time.Time{})
+	stats := decoder.Stats()
+	if stats.FrameLost != 2 || stats.Failsafe != 1 || stats.StartByteMisses != 2 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	f.Add(append(NewFrame().Marshal(), NewFrame().Marshal()...))
+	f.Add([]byte{startByte, startByte, 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decoder := NewDecoder()
+		frames, _ := decoder.Feed(data, time.Time{})
+		if uint64(len(frames)) != decoder.Stats().Frames {
+			t.Errorf("returned %d frames but counted %d", len(frames), decoder.Stats().Frames)
+		}
+		for i := range frames {
+			if _, err := UnmarshalFrame(frames[i].Marshal()); err != nil {
+				t.Errorf("decoded frame does not re-encode: %s", err)
+			}
+		}
+	})
+}
+
+func TestDecoderSlowReadKeepsFrame(t *testing.T) {
+	decoder := NewDecoder()
+	now := time.Now()
+	data := testFrame(1700).Marshal()
+	decoder.Feed(data[:5], now)
+	frames, _ := decoder.Feed(data[5:], now.Add(10*time.Millisecond))
+	if len(frames) != 1 || frames[0].Ch[0] != 1700 {
+		t.Errorf("got %v", frames)
+	}
+}
+
+// A 0x0f in channel data followed 24 bytes later by an end byte looks like a frame.
+// Out of sync a timed decoder waits for a gap instead of taking it
+func TestDecoderWaitsForGapWhenOutOfSync(t *testing.T) {
+	decoder := NewDecoder()
+	now := time.Now()
+	first := NewFrame()
+	first.Ch[0] = 0x0700
+	first.Ch[1] = 0x0401 //second data byte is the start byte
+	second := NewFrame()
+	second.Ch[0] = 0x0400 //first data byte is an end byte, 24 bytes after the one above
+	data := first.Marshal()
+	if data[2] != startByte || second.Marshal()[1] != endByte {
+		t.Fatal("test frames do not line up a false frame")
+	}
+
+	//join mid frame and read the rest with no gap
+	decoder.Feed(data[20:], now)
+	stream := append(data[1:], second.Marshal()...)
+	frames, _ := decoder.Feed(stream, now.Add(byteTime(len(stream))))
+	if len(frames) != 0 {
+		t.Fatalf("decoded %v from mid stream start bytes", frames)
+	}
+	frames, _ = decoder.Feed(testFrame(1500).Marshal(), now.Add(20*time.Millisecond))
+	if len(frames) != 1 || frames[0].Ch[0] != 1500 {
+		t.Fatalf("got %v after a gap", frames)
+	}
+	if !decoder.Synced() {
+		t.Error("decoder not synced")
+	}
+
+	//untimed there is no gap to wait for and the same bytes decode the false frame first
+	untimed, _ := NewDecoder().Feed(stream, time.Time{})
+	falseFrame, err := UnmarshalFrame(stream[1 : 1+frameLength])
+	if err != nil || len(untimed) == 0 || untimed[0] != falseFrame {
+		t.Errorf("untimed got %v", untimed)
+	}
+}
@@ -32,8 +32,34 @@ type Flags struct {
 
 // Frame is an SBUS data frame with 16 proportional channels
 type Frame struct {
-	Ch    Channels
-	Flags Flags
+	Ch      Channels
+	Flags   Flags
+	EndByte byte //0x00 for sbus, sbus2 receivers end with the telemetry slot group that follows
+}
+
+// Sbus2 end bytes, each one is followed by 8 telemetry slots
+var sbus2EndBytes = [...]byte{0x04, 0x14, 0x24, 0x34}
+
+// SBus2SlotGroup is which group of 8 telemetry slots follows this frame, false for plain sbus
+func (f Frame) SBus2SlotGroup() (int, bool) {
+	for i := range sbus2EndBytes {
+		if f.EndByte == sbus2EndBytes[i] {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func isEndByte(b byte) bool {
+	if b == endByte {
+		return true
+	}
+	for i := range sbus2EndBytes {
+		if b == sbus2EndBytes[i] {
+			return true
+		}
+	}
+	return false
 }
 
 func NewFrame() Frame {
@@ -100,7 +126,7 @@ func (f Frame) Marshal() []byte {
 		byte((f.Ch[14]&mask)>>6 | (f.Ch[15]&mask)<<5),
 		byte((f.Ch[15] & mask) >> 3),
 		f.Flags.marshal(),
-		endByte,
+		f.EndByte,
 	}
 }
 
@@ -114,7 +140,7 @@ func UnmarshalFrame(data []byte) (f Frame, err error) {
 		err = fmt.Errorf("error parsing frame: incorrect start byte %v", data[0])
 		return
 	}
-	if data[frameLength-1] != endByte {
+	if !isEndByte(data[frameLength-1]) {
 		err = fmt.Errorf("error parsing frame: incorrect end byte %v", data[frameLength-1])
 		return
 	}
@@ -140,6 +166,7 @@ func UnmarshalFrame(data []byte) (f Frame, err error) {
 	f.Flags.Framelost = (data[frameLength-2] & 0x20) != 0
 	f.Flags.Ch18 = (data[frameLength-2] & 0x40) != 0
 	f.Flags.Ch17 = (data[frameLength-2] & 0x80) != 0
+	f.EndByte = data[frameLength-1]
 
 	return
 }
@@ -0,0 +1,164 @@
+package sbus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameRoundTripAllValues(t *testing.T) {
+	for ch := 0; ch < MaxChannels; ch++ {
+		for value := uint16(0); value <= mask; value++ {
+			frame := NewFrame()
+			frame.Ch[ch] = value
+			frame.Ch[(ch+1)%MaxChannels] = mask - value //neighbour shares bytes with this channel
+
+			got, err := UnmarshalFrame(frame.Marshal())
+			if err != nil {
+				t.Fatalf("ch %d value %d: %s", ch, value, err)
+			}
+			if got != frame {
+				t.Fatalf("ch %d value %d: got %v want %v", ch, value, got.Ch, frame.Ch)
+			}
+		}
+	}
+}
+
+func TestFrameRoundTripFlags(t *testing.T) {
+	for bits := 0; bits < 16; bits++ {
+		frame := NewFrame()
+		frame.Flags = Flags{
+			Ch17:      bits&1 != 0,
+			Ch18:      bits&2 != 0,
+			Framelost: bits&4 != 0,
+			Failsafe:  bits&8 != 0,
+		}
+		got, err := UnmarshalFrame(frame.Marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Flags != frame.Flags {
+			t.Errorf("flags %04b: got %+v want %+v", bits, got.Flags, frame.Flags)
+		}
+	}
+}
+
+func TestFrameMarshal(t *testing.T) {
+	full := Frame{Flags: Flags{Ch17: true, Ch18: true, Framelost: true, Failsafe: true}}
+	for i := range full.Ch {
+		full.Ch[i] = mask
+	}
+	fullBytes := append([]byte{startByte}, bytes.Repeat([]byte{0xff}, 22)...)
+	fullBytes = append(fullBytes, 0xf0, endByte)
+
+	tests := []struct {
+		name  string
+		frame Frame
+		want  []byte
+	}{
+		{
+			name:  "zero",
+			frame: Frame{},
+			want:  append(append([]byte{startByte}, make([]byte, 23)...), endByte),
+		},
+		{
+			name:  "all bits",
+			frame: full,
+			want:  fullBytes,
+		},
+		{
+			name:  "first channel",
+			frame: Frame{Ch: Channels{0x0701}},
+			want:  append(append([]byte{startByte, 0x01, 0x07}, make([]byte, 21)...), endByte),
+		},
+	}
+	for _, tc := range tests {
+		got := tc.frame.Marshal()
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: got % x want % x", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFrameMarshalMasksChannels(t *testing.T) {
+	frame := NewFrame()
+	frame.Ch[3] = 0xffff
+	got, err := UnmarshalFrame(frame.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Ch[3] != mask {
+		t.Errorf("got %d want %d", got.Ch[3], mask)
+	}
+	if got.Ch[2] != uint16(MidValue) || got.Ch[4] != uint16(MidValue) {
+		t.Errorf("overflow leaked into neighbours: %v", got.Ch)
+	}
+}
+
+func TestUnmarshalFrameErrors(t *testing.T) {
+	valid := NewFrame().Marshal()
+	badStart := NewFrame().Marshal()
+	badStart[0] = 0x0e
+	badEnd := NewFrame().Marshal()
+	badEnd[frameLength-1] = 0x05
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "short", data: valid[:frameLength-1]},
+		{name: "long", data: append(valid, 0x00)},
+		{name: "bad start", data: badStart},
+		{name: "bad end", data: badEnd},
+	}
+	for _, tc := range tests {
+		_, err := UnmarshalFrame(tc.data)
+		if err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
+
+func FuzzUnmarshalFrame(f *testing.F) {
+	f.Add(NewFrame().Marshal())
+	f.Add(Frame{}.Marshal())
+	f.Add([]byte{startByte})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		frame, err := UnmarshalFrame(data)
+		if err != nil {
+			return
+		}
+		//every channel bit survives, only the top 4 flag bits are kept
+		want := append([]byte{}, data...)
+		want[frameLength-2] &= 0xf0
+		got := frame.Marshal()
+		if !bytes.Equal(got, want) {
+			t.Errorf("got % x want % x", got, want)
+		}
+	})
+}
+
+func FuzzFrameRoundTrip(f *testing.F) {
+	f.Add([]byte{0x00}, uint8(0))
+	f.Add(bytes.Repeat([]byte{0xff}, 32), uint8(0xf0))
+	f.Fuzz(func(t *testing.T, data []byte, flags uint8) {
+		frame := Frame{
+			Flags: Flags{
+				Ch17:      flags&0x80 != 0,
+				Ch18:      flags&0x40 != 0,
+				Framelost: flags&0x20 != 0,
+				Failsafe:  flags&0x10 != 0,
+			},
+		}
+		for i := 0; i < MaxChannels && 2*i+1 < len(data); i++ {
+			frame.Ch[i] = (uint16(data[2*i]) | uint16(data[2*i+1])<<8) & mask
+		}
+		got, err := UnmarshalFrame(frame.Marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != frame {
+			t.Errorf("got %+v want %+v", got, frame)
+		}
+	})
+}
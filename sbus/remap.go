@@ -0,0 +1,118 @@
+package sbus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChannelMapping moves one received channel to an output channel, adjusted around mid
+type ChannelMapping struct {
+	In      int
+	Out     int
+	Reverse bool
+	Scale   int //percent of travel from mid
+	Offset  int //sbus steps added after scaling
+}
+
+func (m ChannelMapping) apply(value uint16) uint16 {
+	fromMid := int(value) - MidValue
+	if m.Reverse {
+		fromMid = -fromMid
+	}
+	mapped := MidValue + fromMid*m.Scale/100 + m.Offset
+	return uint16(min(max(mapped, MinValue), MaxValue))
+}
+
+// Remap is the channel table for a receiver whose channel order differs from the car's
+type Remap []ChannelMapping
+
+// IdentityRemap passes the channels through unchanged, like the plain channel lists before remapping
+func IdentityRemap(channels []int) Remap {
+	remap := make(Remap, 0, len(channels))
+	for _, ch := range channels {
+		remap = append(remap, ChannelMapping{In: ch, Out: ch, Scale: 100})
+	}
+	return remap
+}
+
+// ParseRemap reads a list like "2>0:rev,0>1:scale=80:offset=-20,4>2".
+// Each entry is the received channel, then the output channel, then any of rev, scale=percent and offset=steps
+func ParseRemap(value string) (Remap, error) {
+	remap := make(Remap, 0, MaxChannels)
+	used := make(map[int]int, MaxChannels)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ":")
+		inString, outString, ok := strings.Cut(fields[0], ">")
+		if !ok {
+			return nil, fmt.Errorf("remap %q is not in>out", entry)
+		}
+		mapping := ChannelMapping{Scale: 100}
+		var err error
+		mapping.In, err = parseChannel(inString)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing remap %q: %w", entry, err)
+		}
+		mapping.Out, err = parseChannel(outString)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing remap %q: %w", entry, err)
+		}
+		if in, ok := used[mapping.Out]; ok {
+			return nil, fmt.Errorf("channels %d and %d both map to %d", in, mapping.In, mapping.Out)
+		}
+		used[mapping.Out] = mapping.In
+
+		for _, option := range fields[1:] {
+			name, optionValue, _ := strings.Cut(option, "=")
+			switch name {
+			case "rev":
+				mapping.Reverse = true
+			case "scale":
+				mapping.Scale, err = strconv.Atoi(optionValue)
+			case "offset":
+				mapping.Offset, err = strconv.Atoi(optionValue)
+			default:
+				err = fmt.Errorf("unknown option %q", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed parsing remap %q: %w", entry, err)
+			}
+		}
+		remap = append(remap, mapping)
+	}
+	return remap, nil
+}
+
+func parseChannel(value string) (int, error) {
+	ch, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	if ch < 0 || ch >= MaxChannels {
+		return 0, fmt.Errorf("channel %d is outside 0-%d", ch, MaxChannels-1)
+	}
+	return ch, nil
+}
+
+// Apply builds a frame holding only the mapped outputs, the rest stay mid. Flags are kept
+func (r Remap) Apply(in Frame) Frame {
+	out := NewFrame()
+	out.Flags = in.Flags
+	for i := range r {
+		out.Ch[r[i].Out] = r[i].apply(in.Ch[r[i].In])
+	}
+	return out
+}
+
+// Outputs are the output channels the remap delivers, never nil so an empty remap delivers nothing
+func (r Remap) Outputs() []int {
+	outputs := make([]int, 0, len(r))
+	for i := range r {
+		outputs = append(outputs, r[i].Out)
+	}
+	return outputs
+}
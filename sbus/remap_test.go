@@ -0,0 +1,70 @@
+package sbus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRemap(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Remap
+		wantErr bool
+	}{
+		{value: "", want: Remap{}},
+		{value: "2>0:rev, 0>1:scale=80:offset=-20,4>2", want: Remap{
+			{In: 2, Out: 0, Reverse: true, Scale: 100},
+			{In: 0, Out: 1, Scale: 80, Offset: -20},
+			{In: 4, Out: 2, Scale: 100},
+		}},
+		{value: "3", wantErr: true},
+		{value: "3>16", wantErr: true},
+		{value: "a>1", wantErr: true},
+		{value: "1>2,3>2", wantErr: true},
+		{value: "1>2:scale=lots", wantErr: true},
+		{value: "1>2:invert", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := ParseRemap(tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: error %v", tc.value, err)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %+v want %+v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestRemapApply(t *testing.T) {
+	remap, err := ParseRemap("2>0:rev,0>1:scale=50:offset=10,3>2:offset=2000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := NewFrame()
+	in.Ch[0] = 1400
+	in.Ch[2] = 1200
+	in.Ch[3] = 1000
+	in.Ch[5] = 1700 //not mapped
+	in.Flags.Failsafe = true
+
+	want := NewFrame()
+	want.Ch[0] = 784  //992 - (1200 - 992)
+	want.Ch[1] = 1206 //992 + (1400 - 992) / 2 + 10
+	want.Ch[2] = uint16(MaxValue)
+	want.Flags.Failsafe = true
+	if got := remap.Apply(in); got != want {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+	if outputs := remap.Outputs(); !reflect.DeepEqual(outputs, []int{0, 1, 2}) {
+		t.Errorf("outputs %v", outputs)
+	}
+
+	identity := IdentityRemap([]int{5})
+	if got := identity.Apply(in); got.Ch[5] != 1700 || got.Ch[0] != uint16(MidValue) {
+		t.Errorf("identity got %+v", got.Ch)
+	}
+	if outputs := IdentityRemap(nil).Outputs(); outputs == nil || len(outputs) != 0 {
+		t.Errorf("empty remap delivers %v", outputs)
+	}
+}
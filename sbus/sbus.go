@@ -7,6 +7,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Speshl/pi_drift_wheel/metrics"
+	"github.com/Speshl/pi_drift_wheel/transport"
 	"github.com/albenik/go-serial/v2"
 	"golang.org/x/sync/errgroup"
 )
@@ -22,7 +24,11 @@ var (
 )
 
 type SBusCfgOpts struct {
-	Type string //TODO goenum
+	Type        string              //TODO goenum
+	OnReadFrame func(Frame)         //called from the reader for every valid frame, keep it quick
+	Sensors     SensorSlots         //sbus2 telemetry slots to decode, nil to only read the receiver voltage
+	ShutdownFor time.Duration       //how long the writer sends failsafe frames after ctx is done
+	Transport   transport.Transport //used instead of opening the path when set
 }
 
 type SBus struct {
@@ -32,12 +38,19 @@ type SBus struct {
 	receiving bool
 	rxLock    sync.RWMutex
 	rxFrame   SBusFrame
+	rxTime    time.Time
+	stats     Stats
+	telemetry Telemetry
 
 	priorityFrames []SBusFrame
 	write          bool
 	transmitting   bool
 	txLock         sync.RWMutex
 	txFrame        SBusFrame
+	override       *Frame        //sent instead of txFrame and the queue while set
+	failsafe       bool          //sends failsafe frames when there is no override
+	txWake         chan struct{} //writes the override now instead of on the next tick
+	queueDepth     metrics.Gauge
 
 	opts SBusCfgOpts
 }
@@ -69,6 +82,8 @@ func NewSBus(path string, read bool, write bool, opts *SBusCfgOpts) (*SBus, erro
 		priorityFrames: make([]SBusFrame, 0, 1000),
 		write:          write,
 		txFrame:        NewSBusFrame(),
+		txWake:         make(chan struct{}, 1),
+		queueDepth:     metrics.SBusPriorityQueueDepth.With(path),
 		opts:           *opts,
 	}, nil
 }
@@ -82,24 +97,36 @@ func NewSBusFrame() SBusFrame {
 }
 
 func (s *SBus) Start(ctx context.Context) error {
-	port, err := serial.Open(s.path,
-		serial.WithBaudrate(100000),
-		serial.WithDataBits(8),
-		serial.WithParity(serial.EvenParity),
-		serial.WithStopBits(serial.TwoStopBits),
-		serial.WithReadTimeout(1000),
-	)
-	if err != nil {
-		return fmt.Errorf("failed opening sbus %s: %w", s.path, err)
+	port := s.opts.Transport
+	if port == nil {
+		var err error
+		port, err = transport.Open(s.path,
+			serial.WithBaudrate(100000),
+			serial.WithDataBits(8),
+			serial.WithParity(serial.EvenParity),
+			serial.WithStopBits(serial.TwoStopBits),
+			serial.WithReadTimeout(1000),
+		)
+		if err != nil {
+			return fmt.Errorf("failed opening sbus %s: %w", s.path, err)
+		}
 	}
 
 	sbusGroup, ctx := errgroup.WithContext(ctx)
 
+	writerDone := make(chan struct{})
+	sbusGroup.Go(func() error {
+		<-ctx.Done()
+		<-writerDone        //let the writer send its shutdown frames first
+		return port.Close() //unblocks reads on transports without a read timeout
+	})
+
 	sbusGroup.Go(func() error {
 		return s.startReader(ctx, port)
 	})
 
 	sbusGroup.Go(func() error {
+		defer close(writerDone)
 		return s.startWriter(ctx, port)
 	})
 
@@ -110,7 +137,7 @@ func (s *SBus) IsReceiving() bool {
 	return s.receiving
 }
 
-func (s *SBus) startReader(ctx context.Context, port *serial.Port) error {
+func (s *SBus) startReader(ctx context.Context, port transport.Transport) error {
 	if !s.read {
 		return nil
 	}
@@ -119,55 +146,69 @@ func (s *SBus) startReader(ctx context.Context, port *serial.Port) error {
 		s.receiving = false
 	}()
 
-	slog.Info("start reading from sbus", "path", s.Path)
-	buff := make([]byte, 25)
-	frame := make([]byte, 0, 25)
-	midFrame := false
-	timeReceived := time.Now()
+	slog.Info("start reading from sbus", "path", s.path)
+	buff := make([]byte, 64)
+	decoder := NewDecoder()
+	var lastStats Stats
+	var timeReceived time.Time
+	framesRead := metrics.SBusFramesRead.With(s.path)
+	frameErrors := metrics.SBusFrameErrors.With(s.path)
+	startByteMisses := metrics.SBusStartByteMisses.With(s.path)
+	frameLost := metrics.SBusFrameLost.With(s.path)
+	failsafe := metrics.SBusFailsafe.With(s.path)
 	for {
-		clear(buff)
 		if ctx.Err() != nil {
 			slog.Info("sbus reader context was cancelled", "path", s.path)
 			return ctx.Err()
 		}
 		n, err := port.Read(buff)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return fmt.Errorf("failed reading from %s: %w", s.path, err)
 		}
+		slog.Debug("read", "num_read", n, "data", buff[:n])
 
-		for i := range buff[:n] {
-			if midFrame { //already found start byte so looking for end byte
-				slog.Debug("appending")
-				frame = append(frame, buff[i])
-				if len(frame) >= frameLength {
-					midFrame = false
-					if buff[i] == endByte { //this is a complete frame
-						frame, err := UnmarshalFrame(frame)
-						if err != nil {
-							slog.Error("frame should have parsed but failed", "error", err)
-						} else {
-							slog.Info("sbus time since last read", "duration", time.Since(timeReceived))
-							timeReceived = time.Now()
-							s.rxLock.Lock()
-							s.rxFrame.Frame = frame //set the latest frame
-							s.rxFrame.Used = true
-							s.rxLock.Unlock()
-						}
-					} else {
-						slog.Debug("found frame start but not frame end")
-					}
-				} else {
-					slog.Debug("building frame", "length", len(frame))
-				}
-			} else if int(buff[i]) == int(startByte) { //Looking for the start of the next frame
-				midFrame = true
-				frame = append(frame[:0], buff[i])
-				slog.Debug("found a match", "length", len(frame))
-			} else {
-				slog.Debug("outside frame, but didn't find start")
+		frames, slots := decoder.Feed(buff[:n], time.Now())
+		for i := range frames {
+			if !timeReceived.IsZero() {
+				slog.Debug("sbus time since last read", "duration", time.Since(timeReceived))
+			}
+			timeReceived = time.Now()
+			s.rxLock.Lock()
+			s.rxFrame.Frame = frames[i] //set the latest frame
+			s.rxFrame.Used = true
+			s.rxTime = timeReceived
+			s.rxLock.Unlock()
+			if s.opts.OnReadFrame != nil {
+				s.opts.OnReadFrame(frames[i])
 			}
 		}
-		slog.Debug("read", "num_read", n, "data", buff[:n])
+
+		if len(slots) > 0 {
+			now := time.Now()
+			s.rxLock.Lock()
+			for i := range slots {
+				s.telemetry.Update(slots[i], s.opts.Sensors, now)
+			}
+			s.rxLock.Unlock()
+		}
+
+		stats := decoder.Stats()
+		if stats.SyncLosses > lastStats.SyncLosses {
+			slog.Debug("sbus lost frame sync", "path", s.path, "sync_losses", stats.SyncLosses)
+		}
+		framesRead.Add(stats.Frames - lastStats.Frames)
+		frameErrors.Add(stats.SyncLosses - lastStats.SyncLosses)
+		startByteMisses.Add(stats.StartByteMisses - lastStats.StartByteMisses)
+		frameLost.Add(stats.FrameLost - lastStats.FrameLost)
+		failsafe.Add(stats.Failsafe - lastStats.Failsafe)
+		lastStats = stats
+
+		s.rxLock.Lock()
+		s.stats = stats
+		s.rxLock.Unlock()
 	}
 }
 
@@ -175,7 +216,7 @@ func (s *SBus) IsTransmitting() bool {
 	return s.transmitting
 }
 
-func (s *SBus) startWriter(ctx context.Context, port *serial.Port) error {
+func (s *SBus) startWriter(ctx context.Context, port transport.Transport) error {
 	if !s.write {
 		return nil
 	}
@@ -188,18 +229,44 @@ func (s *SBus) startWriter(ctx context.Context, port *serial.Port) error {
 	ticker := time.NewTicker(7 * time.Millisecond) //TODO sync with config
 	lastWriteTime := time.Now()
 	var writeBytes []byte
+	framesWritten := metrics.SBusFramesWritten.With(s.path)
 	for {
 		select {
 		case <-ctx.Done():
 			slog.Info("sbus writer context was cancelled", "path", s.path)
+			s.writeShutdownFrames(port, ticker)
 			return ctx.Err()
+		case <-s.txWake:
+			s.txLock.RLock()
+			txFrame, forced := s.forcedFrame()
+			s.txLock.RUnlock()
+			if !forced {
+				continue
+			}
+			txFrame.EndByte = endByte
+			_, err := port.Write(txFrame.Marshal())
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return err
+			}
+			framesWritten.Inc()
+			ticker.Reset(7 * time.Millisecond) //keep the usual gap before the next frame
+			lastWriteTime = time.Now()
 		case <-ticker.C:
 			s.txLock.Lock()
 			if s.txFrame.Priority <= 0 && len(s.priorityFrames) > 0 {
 				s.txFrame = s.priorityFrames[0]
 				s.priorityFrames = s.priorityFrames[1:]
+				s.queueDepth.Set(float64(len(s.priorityFrames)))
+			}
+			txFrame := s.txFrame.Frame
+			if forcedFrame, forced := s.forcedFrame(); forced {
+				txFrame = forcedFrame
 			}
-			writeBytes = s.txFrame.Frame.Marshal()
+			txFrame.EndByte = endByte //always send plain sbus
+			writeBytes = txFrame.Marshal()
 			if s.txFrame.Priority > 0 {
 				s.txFrame.Priority--
 			}
@@ -212,16 +279,58 @@ func (s *SBus) startWriter(ctx context.Context, port *serial.Port) error {
 
 			n, err := port.Write(writeBytes)
 			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
 				return err
 			}
 			if n != len(writeBytes) {
 				slog.Warn("sbus write incorrect length")
 			}
+			framesWritten.Inc()
 
 		}
 	}
 }
 
+// forcedFrame is the frame that replaces txFrame, hold txLock
+func (s *SBus) forcedFrame() (Frame, bool) {
+	if s.override != nil {
+		return *s.override, true
+	} else if s.failsafe {
+		return failsafeFrame(), true
+	}
+	return Frame{}, false
+}
+
+// failsafeFrame is neutral with the failsafe flag so receivers that honour it go to their own failsafe
+func failsafeFrame() Frame {
+	frame := NewFrame()
+	frame.Flags.Failsafe = true
+	return frame
+}
+
+// writeShutdownFrames sends neutral frames with the failsafe flag so the receiver does not hold the last frame
+func (s *SBus) writeShutdownFrames(port transport.Transport, ticker *time.Ticker) {
+	if s.opts.ShutdownFor <= 0 {
+		return
+	}
+	writeBytes := failsafeFrame().Marshal()
+	framesWritten := metrics.SBusFramesWritten.With(s.path)
+
+	slog.Info("sending shutdown frames", "path", s.path, "duration", s.opts.ShutdownFor)
+	deadline := time.Now().Add(s.opts.ShutdownFor)
+	for time.Now().Before(deadline) {
+		_, err := port.Write(writeBytes)
+		if err != nil {
+			slog.Warn("failed writing shutdown frame", "path", s.path, "error", err)
+			return
+		}
+		framesWritten.Inc()
+		<-ticker.C
+	}
+}
+
 func (s *SBus) Path() string {
 	return s.path
 }
@@ -236,10 +345,78 @@ func (s *SBus) GetReadFrame() Frame {
 	return s.rxFrame.Frame
 }
 
+// LastReceived is when the last complete frame was read, zero if none have been
+func (s *SBus) LastReceived() time.Time {
+	s.rxLock.RLock()
+	defer s.rxLock.RUnlock()
+	return s.rxTime
+}
+
+// GetTelemetry returns the sbus2 sensor values read so far
+func (s *SBus) GetTelemetry() Telemetry {
+	s.rxLock.RLock()
+	defer s.rxLock.RUnlock()
+	return s.telemetry
+}
+
+// Stats are the reader's frame and sync counts
+func (s *SBus) Stats() Stats {
+	s.rxLock.RLock()
+	defer s.rxLock.RUnlock()
+	return s.stats
+}
+
+// SetOverrideFrame sends frame on every write until cleared, starting straight away rather than on the next tick.
+// Queued priority frames are dropped and frames set while overridden are ignored
+func (s *SBus) SetOverrideFrame(frame Frame) {
+	s.txLock.Lock()
+	s.override = &frame
+	s.txFrame = SBusFrame{Frame: frame}
+	s.priorityFrames = s.priorityFrames[:0]
+	s.queueDepth.Set(0)
+	s.txLock.Unlock()
+	s.wakeWriter()
+}
+
+func (s *SBus) wakeWriter() {
+	select {
+	case s.txWake <- struct{}{}:
+	default: //a write is already pending
+	}
+}
+
+// SetFailsafe sends failsafe frames, starting straight away, until turned off. Queued priority frames are
+// dropped so nothing stale goes out after. An override frame still wins while set
+func (s *SBus) SetFailsafe(failsafe bool) {
+	s.txLock.Lock()
+	changed := s.failsafe != failsafe
+	s.failsafe = failsafe
+	if failsafe && changed {
+		s.txFrame = NewSBusFrame()
+		s.priorityFrames = s.priorityFrames[:0]
+		s.queueDepth.Set(0)
+	}
+	s.txLock.Unlock()
+	if failsafe && changed {
+		s.wakeWriter()
+	}
+}
+
+// ClearOverrideFrame goes back to sending the frames given to SetWriteFrame
+func (s *SBus) ClearOverrideFrame() {
+	s.txLock.Lock()
+	defer s.txLock.Unlock()
+	s.override = nil
+}
+
 func (s *SBus) SetWriteFrame(frame SBusFrame) {
 	s.txLock.Lock()
 	defer s.txLock.Unlock()
+	if s.override != nil {
+		return
+	}
 	if len(s.priorityFrames) == 0 || frame.Priority > 0 {
 		s.priorityFrames = append(s.priorityFrames, frame)
+		s.queueDepth.Set(float64(len(s.priorityFrames)))
 	}
 }
@@ -0,0 +1,185 @@
+package sbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/transport"
+)
+
+// startWriter runs an sbus writer into a pipe and returns the frames read off the other end, closed with the pipe
+func startWriter(t *testing.T, ctx context.Context, opts SBusCfgOpts) (*SBus, <-chan Frame, <-chan error) {
+	t.Helper()
+	local, remote := transport.NewPipe()
+	opts.Type = RxTypeControl
+	opts.Transport = local
+	sBus, err := NewSBus("pipe://test", false, true, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(func() {
+		cancel()
+		remote.Close()
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- sBus.Start(ctx)
+	}()
+
+	frames := make(chan Frame, 1000)
+	go func() {
+		decoder := NewDecoder()
+		buff := make([]byte, 256)
+		for {
+			n, err := remote.Read(buff)
+			if err != nil {
+				close(frames)
+				return
+			}
+			read, _ := decoder.Feed(buff[:n], time.Time{})
+			for i := range read {
+				frames <- read[i]
+			}
+		}
+	}()
+	return sBus, frames, done
+}
+
+// waitFor reads frames until one has ch0 set to value, failing on a frame with a forbidden ch0
+func waitFor(t *testing.T, frames <-chan Frame, value uint16, forbidden uint16) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case frame := <-frames:
+			if frame.Ch[0] == forbidden {
+				t.Fatalf("got forbidden frame %d waiting for %d", forbidden, value)
+			}
+			if frame.Ch[0] == value {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %d", value)
+		}
+	}
+}
+
+func TestOverrideFrameSkipsQueue(t *testing.T) {
+	sBus, frames, _ := startWriter(t, context.Background(), SBusCfgOpts{})
+
+	queued := NewSBusFrame()
+	queued.Frame.Ch[0] = 1000
+	queued.Priority = 50 //long enough that the override would wait behind it
+	sBus.SetWriteFrame(queued)
+	queued.Frame.Ch[0] = 1100
+	sBus.SetWriteFrame(queued)
+	waitFor(t, frames, 1000, 0)
+
+	start := time.Now()
+	override := NewFrame()
+	override.Ch[0] = 500
+	sBus.SetOverrideFrame(override)
+	waitFor(t, frames, 500, 1100)
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("override took %v", waited)
+	}
+
+	ignored := NewSBusFrame()
+	ignored.Frame.Ch[0] = 1200
+	ignored.Priority = 10
+	sBus.SetWriteFrame(ignored)
+	for i := 0; i < 5; i++ {
+		if frame := <-frames; frame.Ch[0] != 500 {
+			t.Fatalf("got %d while overridden", frame.Ch[0])
+		}
+	}
+
+	sBus.ClearOverrideFrame()
+	cleared := NewSBusFrame()
+	cleared.Frame.Ch[0] = 1500
+	sBus.SetWriteFrame(cleared)
+	waitFor(t, frames, 1500, 1100) //the dropped queue must not come back
+}
+
+func TestFailsafe(t *testing.T) {
+	sBus, frames, _ := startWriter(t, context.Background(), SBusCfgOpts{})
+
+	live := NewSBusFrame()
+	live.Frame.Ch[0] = 1000
+	sBus.SetWriteFrame(live)
+	waitFor(t, frames, 1000, 0)
+
+	sBus.SetFailsafe(true)
+	sBus.SetFailsafe(true) //repeats are harmless
+	timeout := time.After(time.Second)
+	for failsafe := false; !failsafe; {
+		select {
+		case frame := <-frames:
+			failsafe = frame.Flags.Failsafe && frame.Ch[0] == uint16(MidValue)
+		case <-timeout:
+			t.Fatal("timed out waiting for a failsafe frame")
+		}
+	}
+
+	live.Frame.Ch[0] = 1200
+	sBus.SetWriteFrame(live)
+	for i := 0; i < 5; i++ {
+		if frame := <-frames; !frame.Flags.Failsafe {
+			t.Fatalf("got %d while in failsafe", frame.Ch[0])
+		}
+	}
+
+	override := NewFrame()
+	override.Ch[0] = 500
+	sBus.SetOverrideFrame(override)
+	waitFor(t, frames, 500, 0)
+	sBus.ClearOverrideFrame()
+
+	sBus.SetFailsafe(false)
+	live.Frame.Ch[0] = 1400
+	sBus.SetWriteFrame(live)
+	waitFor(t, frames, 1400, 0)
+}
+
+func TestShutdownFrames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sBus, frames, done := startWriter(t, ctx, SBusCfgOpts{ShutdownFor: 50 * time.Millisecond})
+	driving := NewSBusFrame()
+	driving.Frame.Ch[1] = 1700
+	sBus.SetWriteFrame(driving)
+	for frame := range frames {
+		if frame.Ch[1] == 1700 {
+			break
+		}
+	}
+
+	start := time.Now()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("writer did not stop")
+	}
+	if stopped := time.Since(start); stopped < 50*time.Millisecond {
+		t.Errorf("stopped after %v, before the shutdown frames were sent", stopped)
+	}
+
+	var last Frame
+	failsafe := 0
+	for frame := range frames { //closed once the pipe is
+		last = frame
+		if frame.Flags.Failsafe {
+			failsafe++
+		}
+	}
+	if failsafe < 3 {
+		t.Errorf("got %d failsafe frames", failsafe)
+	}
+	neutral := NewFrame()
+	neutral.Flags.Failsafe = true
+	if last != neutral {
+		t.Errorf("last frame %+v, want neutral failsafe", last)
+	}
+}
@@ -0,0 +1,202 @@
+package sbus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sbus2 receivers follow frames ending in a slot marker with 8 telemetry slots.
+// Each slot is an id byte then 2 data bytes, big-endian
+const (
+	SlotCount    = 32
+	slotsInGroup = 8
+	slotLength   = 3
+)
+
+// slot ids in slot order, the end byte of the frame picks which group of 8 follows
+var slotIDs = [SlotCount]byte{
+	0x03, 0x83, 0x43, 0xc3, 0x23, 0xa3, 0x63, 0xe3,
+	0x13, 0x93, 0x53, 0xd3, 0x33, 0xb3, 0x73, 0xf3,
+	0x0b, 0x8b, 0x4b, 0xcb, 0x2b, 0xab, 0x6b, 0xeb,
+	0x1b, 0x9b, 0x5b, 0xdb, 0x3b, 0xbb, 0x7b, 0xfb,
+}
+
+// Sensor kinds and how many slots each takes, slot 0 is always the receiver voltage
+const (
+	SensorVoltage     = "voltage"  //2 slots, the sensor supply then its external lead
+	SensorTemperature = "temp"     //1 slot
+	SensorRPM         = "rpm"      //1 slot
+	SensorGPS         = "gps"      //8 slots, must start at 8, 16 or 24
+	SensorFeedback    = "feedback" //1 slot, raw servo position like the arduino sends as crsf attitude pitch
+)
+
+var sensorSlotCounts = map[string]int{
+	SensorVoltage:     2,
+	SensorTemperature: 1,
+	SensorRPM:         1,
+	SensorGPS:         8,
+	SensorFeedback:    1,
+}
+
+// Slot is the data from one telemetry slot
+type Slot struct {
+	Number int
+	Value  uint16
+}
+
+// slotNumber finds the slot an id byte belongs to in the group the last frame announced
+func slotNumber(group int, id byte) (int, bool) {
+	for i := group * slotsInGroup; i < (group+1)*slotsInGroup; i++ {
+		if slotIDs[i] == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// SensorSlots maps a sensor kind to the first slot the transmitter assigned it
+type SensorSlots map[string]int
+
+// ParseSensorSlots reads a list like "voltage:1,temp:3,rpm:4,gps:8"
+func ParseSensorSlots(value string) (SensorSlots, error) {
+	sensors := make(SensorSlots, len(sensorSlotCounts))
+	used := make(map[int]string, SlotCount)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, slotString, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("sensor %q is not kind:slot", entry)
+		}
+		count, ok := sensorSlotCounts[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown sensor %q", kind)
+		}
+		slot, err := strconv.Atoi(slotString)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing slot for %s: %w", kind, err)
+		}
+		if slot < 1 || slot+count > SlotCount {
+			return nil, fmt.Errorf("%s does not fit at slot %d", kind, slot)
+		}
+		if slot/slotsInGroup != (slot+count-1)/slotsInGroup {
+			return nil, fmt.Errorf("%s at slot %d crosses a slot group", kind, slot)
+		}
+		for i := slot; i < slot+count; i++ {
+			if other, ok := used[i]; ok {
+				return nil, fmt.Errorf("%s and %s both use slot %d", kind, other, i)
+			}
+			used[i] = kind
+		}
+		sensors[kind] = slot
+	}
+	return sensors, nil
+}
+
+type GpsTelemetry struct {
+	Lat      float64 //degrees, negative south
+	Long     float64 //degrees, negative west
+	Speed    int     //km/h
+	Altitude int     //meters
+	Vario    float64 //meters per second
+}
+
+// Telemetry is the latest decoded value of each sensor, a zero time means it has not reported
+type Telemetry struct {
+	RxVoltage        float64 //volts
+	RxVoltageTime    time.Time
+	Voltage          float64 //volts on the voltage sensor supply
+	VoltageTime      time.Time
+	ExtVoltage       float64 //volts on the voltage sensor external lead
+	ExtVoltageTime   time.Time
+	Temperature      int //celsius
+	TemperatureTime  time.Time
+	RPM              int
+	RPMTime          time.Time
+	Gps              GpsTelemetry
+	GpsTime          time.Time
+	Feedback         int
+	FeedbackTime     time.Time
+	gpsSlots         [8]uint16
+	gpsSlotsReceived uint8
+}
+
+// Update decodes a slot into the sensor it was assigned to
+func (t *Telemetry) Update(slot Slot, sensors SensorSlots, now time.Time) {
+	if slot.Number == 0 {
+		t.RxVoltage = voltage(slot.Value)
+		t.RxVoltageTime = now
+		return
+	}
+	for kind, first := range sensors {
+		offset := slot.Number - first
+		if offset < 0 || offset >= sensorSlotCounts[kind] {
+			continue
+		}
+		switch kind {
+		case SensorVoltage:
+			if offset == 0 {
+				t.Voltage = voltage(slot.Value)
+				t.VoltageTime = now
+			} else {
+				t.ExtVoltage = voltage(slot.Value)
+				t.ExtVoltageTime = now
+			}
+		case SensorTemperature:
+			t.Temperature = int(slot.Value&0x7fff) - 100
+			t.TemperatureTime = now
+		case SensorRPM:
+			t.RPM = int(slot.Value) * 6
+			t.RPMTime = now
+		case SensorFeedback:
+			t.Feedback = int(slot.Value)
+			t.FeedbackTime = now
+		case SensorGPS:
+			t.gpsSlots[offset] = slot.Value
+			t.gpsSlotsReceived |= 1 << offset
+			if t.gpsSlotsReceived == 0xff { //wait for every slot so a fix is not half old and half new
+				t.Gps = decodeGps(t.gpsSlots)
+				t.GpsTime = now
+				t.gpsSlotsReceived = 0
+			}
+		}
+		return
+	}
+}
+
+// voltage is 0.1V steps, the top bit is set by the sensor
+func voltage(value uint16) float64 {
+	return float64(value&0x7fff) / 10
+}
+
+// decodeGps reads the 8 gps slots:
+// 0 speed km/h, 1 altitude meters (signed 14 bit), 2 utc time (unused), 3 vario 0.1m/s,
+// 4-5 latitude and 6-7 longitude as degrees<<8 | hemisphere<<4 | minutes*10000 bits 16-19 then minutes*10000 bits 0-15
+func decodeGps(slots [8]uint16) GpsTelemetry {
+	return GpsTelemetry{
+		Speed:    int(slots[0] & 0x3fff),
+		Altitude: int(int16(slots[1]<<2) >> 2),
+		Vario:    float64(int16(slots[3])) / 10,
+		Lat:      decodeCoordinate(slots[4], slots[5]),
+		Long:     decodeCoordinate(slots[6], slots[7]),
+	}
+}
+
+func decodeCoordinate(high uint16, low uint16) float64 {
+	degrees := float64(high >> 8)
+	minutes := float64(uint32(high&0x0f)<<16|uint32(low)) / 10000
+	coordinate := degrees + minutes/60
+	if high&0x10 != 0 { //south or west
+		coordinate = -coordinate
+	}
+	return coordinate
+}
+
+// EncodeSlot builds the 3 bytes a sensor sends in a slot, used by the sim and tests
+func EncodeSlot(slot Slot) []byte {
+	return []byte{slotIDs[slot.Number], byte(slot.Value >> 8), byte(slot.Value)}
+}
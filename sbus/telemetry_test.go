@@ -0,0 +1,152 @@
+package sbus
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// sbus2Stream is an sbus2 frame for the slot group followed by the slots
+func sbus2Stream(group int, slots ...Slot) []byte {
+	frame := NewFrame()
+	frame.EndByte = sbus2EndBytes[group]
+	stream := frame.Marshal()
+	for i := range slots {
+		stream = append(stream, EncodeSlot(slots[i])...)
+	}
+	return stream
+}
+
+// encodeCoordinate is the inverse of decodeCoordinate
+func encodeCoordinate(coordinate float64) (uint16, uint16) {
+	var hemisphere uint16
+	if coordinate < 0 {
+		hemisphere = 1
+		coordinate = -coordinate
+	}
+	degrees := math.Floor(coordinate)
+	minutes := uint32(math.Round((coordinate - degrees) * 60 * 10000))
+	return uint16(degrees)<<8 | hemisphere<<4 | uint16(minutes>>16), uint16(minutes)
+}
+
+func TestDecoderReadsSlots(t *testing.T) {
+	decoder := NewDecoder()
+	stream := sbus2Stream(0, Slot{Number: 0, Value: 0x8048}, Slot{Number: 3, Value: 0x0f0f})
+	stream = append(stream, sbus2Stream(1, Slot{Number: 9, Value: 1234})...)
+	stream = append(stream, testFrame(1000).Marshal()...)
+	stream = append(stream, EncodeSlot(Slot{Number: 1, Value: 1})...) //no slots after an sbus1 frame
+
+	frames, slots := decoder.Feed(stream, time.Time{})
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames want 3", len(frames))
+	}
+	want := []Slot{{Number: 0, Value: 0x8048}, {Number: 3, Value: 0x0f0f}, {Number: 9, Value: 1234}}
+	if len(slots) != len(want) {
+		t.Fatalf("got slots %+v want %+v", slots, want)
+	}
+	for i := range want {
+		if slots[i] != want[i] {
+			t.Errorf("slot %d: got %+v want %+v", i, slots[i], want[i])
+		}
+	}
+	if stats := decoder.Stats(); stats.Slots != 3 || stats.SyncLosses != 0 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestDecoderSlotSplitAcrossReads(t *testing.T) {
+	decoder := NewDecoder()
+	stream := sbus2Stream(0, Slot{Number: 4, Value: 500})
+	now := time.Now()
+	_, slots := decoder.Feed(stream[:len(stream)-1], now)
+	if len(slots) != 0 {
+		t.Fatalf("got slots %+v before the last byte", slots)
+	}
+	_, slots = decoder.Feed(stream[len(stream)-1:], now.Add(byteTime(1)))
+	if len(slots) != 1 || slots[0] != (Slot{Number: 4, Value: 500}) {
+		t.Errorf("got slots %+v", slots)
+	}
+}
+
+func TestParseSensorSlots(t *testing.T) {
+	sensors, err := ParseSensorSlots(" voltage:1, temp:3,rpm:4,gps:8,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SensorSlots{SensorVoltage: 1, SensorTemperature: 3, SensorRPM: 4, SensorGPS: 8}
+	if len(sensors) != len(want) {
+		t.Fatalf("got %v want %v", sensors, want)
+	}
+	for kind, slot := range want {
+		if sensors[kind] != slot {
+			t.Errorf("%s: got %d want %d", kind, sensors[kind], slot)
+		}
+	}
+
+	for _, value := range []string{
+		"voltage",         //no slot
+		"speed:3",         //unknown kind
+		"rpm:x",           //bad number
+		"rpm:0",           //receiver voltage slot
+		"rpm:32",          //past the end
+		"gps:4",           //crosses groups
+		"voltage:7",       //crosses groups
+		"temp:3,rpm:3",    //overlap
+		"voltage:1,rpm:2", //overlap with the second voltage slot
+	} {
+		if _, err := ParseSensorSlots(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestTelemetryUpdate(t *testing.T) {
+	sensors, err := ParseSensorSlots("voltage:1,temp:3,rpm:4,feedback:5,gps:8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	telemetry := Telemetry{}
+	for _, slot := range []Slot{
+		{Number: 0, Value: 0x8000 | 74}, //top bit set by the sensor
+		{Number: 1, Value: 50},
+		{Number: 2, Value: 84},
+		{Number: 3, Value: 100 + 35},
+		{Number: 4, Value: 2000},
+		{Number: 5, Value: 1500},
+		{Number: 6, Value: 99}, //unassigned
+	} {
+		telemetry.Update(slot, sensors, now)
+	}
+	if telemetry.RxVoltage != 7.4 || telemetry.Voltage != 5.0 || telemetry.ExtVoltage != 8.4 {
+		t.Errorf("voltages rx %v supply %v ext %v", telemetry.RxVoltage, telemetry.Voltage, telemetry.ExtVoltage)
+	}
+	if telemetry.Temperature != 35 || telemetry.RPM != 12000 || telemetry.Feedback != 1500 {
+		t.Errorf("temp %d rpm %d feedback %d", telemetry.Temperature, telemetry.RPM, telemetry.Feedback)
+	}
+	if telemetry.TemperatureTime != now || !telemetry.GpsTime.IsZero() {
+		t.Errorf("times temp %v gps %v", telemetry.TemperatureTime, telemetry.GpsTime)
+	}
+
+	latHigh, latLow := encodeCoordinate(47.6205)
+	longHigh, longLow := encodeCoordinate(-122.3493)
+	var vario int16 = -15
+	gps := []uint16{43, 0x3ffb, 0, uint16(vario), latHigh, latLow, longHigh, longLow}
+	for i := 0; i < len(gps)-1; i++ {
+		telemetry.Update(Slot{Number: 8 + i, Value: gps[i]}, sensors, now)
+	}
+	if !telemetry.GpsTime.IsZero() {
+		t.Fatal("gps decoded before every slot arrived")
+	}
+	telemetry.Update(Slot{Number: 15, Value: gps[7]}, sensors, now)
+	if telemetry.GpsTime != now {
+		t.Fatal("gps not decoded")
+	}
+	got := telemetry.Gps
+	if got.Speed != 43 || got.Altitude != -5 || got.Vario != -1.5 {
+		t.Errorf("gps %+v", got)
+	}
+	if math.Abs(got.Lat-47.6205) > 1e-6 || math.Abs(got.Long+122.3493) > 1e-6 {
+		t.Errorf("gps lat %v long %v", got.Lat, got.Long)
+	}
+}
@@ -0,0 +1,178 @@
+package sim
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	EscForward = "forward"
+	EscBrake   = "brake"
+	EscNeutral = "neutral" //released after braking, the next push back reverses
+	EscReverse = "reverse"
+
+	metersPerDegreeLat = 111320.0
+)
+
+type CarConfig struct {
+	ServoTravel   float64 //degrees each side of center
+	ServoSlewRate float64 //degrees per second
+
+	MaxSpeed     float64 //meters per second
+	Acceleration float64 //meters per second squared at full throttle
+	BrakeDecel   float64 //meters per second squared at full brake
+	Drag         float64 //meters per second squared when coasting
+	ReverseLimit float64 //fraction of max speed allowed in reverse
+	Deadband     float64 //throttle treated as neutral inside this
+	Wheelbase    float64 //meters
+
+	BatteryCells    int
+	BatteryCapacity float64 //mAh
+	IdleCurrent     float64 //amps
+	MaxCurrent      float64 //amps at full throttle
+
+	//servo pot readings sent back as attitude pitch, matching the arduino feedback
+	FeedbackMin int
+	FeedbackMid int
+	FeedbackMax int
+
+	StartLat  float64
+	StartLong float64
+}
+
+func DefaultCarConfig() CarConfig {
+	return CarConfig{
+		ServoTravel:     30,
+		ServoSlewRate:   400,
+		MaxSpeed:        12,
+		Acceleration:    8,
+		BrakeDecel:      14,
+		Drag:            1.5,
+		ReverseLimit:    0.4,
+		Deadband:        0.05,
+		Wheelbase:       0.26,
+		BatteryCells:    2,
+		BatteryCapacity: 5000,
+		IdleCurrent:     0.5,
+		MaxCurrent:      60,
+		FeedbackMin:     300,
+		FeedbackMid:     500,
+		FeedbackMax:     750,
+		StartLat:        47.6205,
+		StartLong:       -122.3493,
+	}
+}
+
+// Car is a kinematic bicycle model with an rc car style esc
+type Car struct {
+	cfg CarConfig
+
+	SteerAngle float64 //degrees, positive is right
+	Speed      float64 //meters per second, negative in reverse
+	Heading    float64 //radians clockwise from north
+	YawRate    float64 //radians per second
+	North      float64 //meters from the start
+	East       float64
+	Esc        string
+	Current    float64 //amps
+	Used       float64 //mAh
+}
+
+func NewCar(cfg CarConfig) *Car {
+	return &Car{
+		cfg: cfg,
+		Esc: EscForward,
+	}
+}
+
+// Update moves the car forward by dt. steer and throttle are -1 to 1, negative throttle brakes or reverses
+func (c *Car) Update(steer float64, throttle float64, dt time.Duration) {
+	seconds := dt.Seconds()
+
+	//servo moves toward the commanded angle no faster than the slew rate
+	target := clamp(steer, -1, 1) * c.cfg.ServoTravel
+	maxStep := c.cfg.ServoSlewRate * seconds
+	c.SteerAngle += clamp(target-c.SteerAngle, -maxStep, maxStep)
+
+	c.updateEsc(clamp(throttle, -1, 1), seconds)
+
+	c.YawRate = c.Speed * math.Tan(c.SteerAngle*math.Pi/180) / c.cfg.Wheelbase
+	c.Heading = math.Mod(c.Heading+c.YawRate*seconds+2*math.Pi, 2*math.Pi)
+	c.North += c.Speed * math.Cos(c.Heading) * seconds
+	c.East += c.Speed * math.Sin(c.Heading) * seconds
+
+	c.Used += c.Current * seconds / 3.6 //amp seconds to mAh
+}
+
+func (c *Car) updateEsc(throttle float64, seconds float64) {
+	pushed := throttle > c.cfg.Deadband
+	pulled := throttle < -c.cfg.Deadband
+
+	switch {
+	case pushed:
+		c.Esc = EscForward
+	case pulled && c.Esc == EscForward:
+		c.Esc = EscBrake
+	case pulled && c.Esc == EscNeutral:
+		c.Esc = EscReverse
+	case !pulled && c.Esc == EscBrake:
+		c.Esc = EscNeutral
+	}
+
+	c.Current = c.cfg.IdleCurrent
+	switch {
+	case c.Esc == EscForward && pushed:
+		c.Speed += throttle * c.cfg.Acceleration * seconds
+		if c.Speed < 0 { //forward from rolling backward brakes first
+			c.Speed += c.cfg.BrakeDecel * seconds
+		}
+		c.Current += throttle * c.cfg.MaxCurrent
+	case c.Esc == EscBrake:
+		c.Speed = approachZero(c.Speed, -throttle*c.cfg.BrakeDecel*seconds)
+	case c.Esc == EscReverse && pulled:
+		c.Speed += throttle * c.cfg.Acceleration * seconds
+		c.Current += -throttle * c.cfg.MaxCurrent
+	default:
+		c.Speed = approachZero(c.Speed, c.cfg.Drag*seconds)
+	}
+	c.Speed = clamp(c.Speed, -c.cfg.MaxSpeed*c.cfg.ReverseLimit, c.cfg.MaxSpeed)
+}
+
+// Feedback is the servo pot reading the steering position would give
+func (c *Car) Feedback() int {
+	position := c.SteerAngle / c.cfg.ServoTravel
+	if position >= 0 {
+		return c.cfg.FeedbackMid + int(position*float64(c.cfg.FeedbackMax-c.cfg.FeedbackMid))
+	}
+	return c.cfg.FeedbackMid + int(position*float64(c.cfg.FeedbackMid-c.cfg.FeedbackMin))
+}
+
+func (c *Car) Position() (lat float64, long float64) {
+	lat = c.cfg.StartLat + c.North/metersPerDegreeLat
+	long = c.cfg.StartLong + c.East/(metersPerDegreeLat*math.Cos(c.cfg.StartLat*math.Pi/180))
+	return lat, long
+}
+
+// Voltage sags with load and drops as the pack is used
+func (c *Car) Voltage() float64 {
+	cells := float64(c.cfg.BatteryCells)
+	resting := cells * (4.2 - 0.9*c.Used/c.cfg.BatteryCapacity)
+	return math.Max(resting-c.Current*0.01*cells, 0)
+}
+
+func (c *Car) Remaining() int {
+	return int(clamp(100-100*c.Used/c.cfg.BatteryCapacity, 0, 100))
+}
+
+func approachZero(value float64, step float64) float64 {
+	if value > step {
+		return value - step
+	} else if value < -step {
+		return value + step
+	}
+	return 0
+}
+
+func clamp(value, min, max float64) float64 {
+	return math.Max(min, math.Min(max, value))
+}
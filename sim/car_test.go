@@ -0,0 +1,138 @@
+package sim
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const tolerance = 1e-9
+
+func TestServoSlewAndTravel(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     float64
+		steer     float64
+		dt        time.Duration
+		wantAngle float64
+	}{
+		{name: "slews toward right", start: 0, steer: 1, dt: 10 * time.Millisecond, wantAngle: 4},
+		{name: "slews toward left", start: 0, steer: -1, dt: 10 * time.Millisecond, wantAngle: -4},
+		{name: "reaches a close target", start: 10, steer: 0.4, dt: 10 * time.Millisecond, wantAngle: 12},
+		{name: "stops at travel", start: 28, steer: 1, dt: 100 * time.Millisecond, wantAngle: 30},
+		{name: "command past full is clamped", start: -29, steer: -3, dt: 100 * time.Millisecond, wantAngle: -30},
+		{name: "returns to center", start: 2, steer: 0, dt: 10 * time.Millisecond, wantAngle: 0},
+	}
+	for _, tc := range tests {
+		car := NewCar(DefaultCarConfig())
+		car.SteerAngle = tc.start
+		car.Update(tc.steer, 0, tc.dt)
+		if math.Abs(car.SteerAngle-tc.wantAngle) > tolerance {
+			t.Errorf("%s: angle got %v want %v", tc.name, car.SteerAngle, tc.wantAngle)
+		}
+	}
+}
+
+func TestEscStates(t *testing.T) {
+	tests := []struct {
+		name        string
+		esc         string
+		speed       float64
+		throttle    float64
+		wantEsc     string
+		wantSpeed   float64
+		wantCurrent float64
+	}{
+		{name: "accelerates", esc: EscForward, throttle: 1, wantEsc: EscForward, wantSpeed: 0.8, wantCurrent: 60.5},
+		{name: "half throttle", esc: EscForward, throttle: 0.5, wantEsc: EscForward, wantSpeed: 0.4, wantCurrent: 30.5},
+		{name: "deadband coasts", esc: EscForward, speed: 2, throttle: 0.03, wantEsc: EscForward, wantSpeed: 1.85, wantCurrent: 0.5},
+		{name: "stops at top speed", esc: EscForward, speed: 11.9, throttle: 1, wantEsc: EscForward, wantSpeed: 12, wantCurrent: 60.5},
+		{name: "pull brakes", esc: EscForward, speed: 5, throttle: -1, wantEsc: EscBrake, wantSpeed: 3.6, wantCurrent: 0.5},
+		{name: "half brake", esc: EscForward, speed: 5, throttle: -0.5, wantEsc: EscBrake, wantSpeed: 4.3, wantCurrent: 0.5},
+		{name: "brake stops at zero", esc: EscBrake, speed: 0.5, throttle: -1, wantEsc: EscBrake, wantSpeed: 0, wantCurrent: 0.5},
+		{name: "release after brake", esc: EscBrake, throttle: 0, wantEsc: EscNeutral, wantSpeed: 0, wantCurrent: 0.5},
+		{name: "pull from neutral reverses", esc: EscNeutral, throttle: -1, wantEsc: EscReverse, wantSpeed: -0.8, wantCurrent: 60.5},
+		{name: "reverse is limited", esc: EscReverse, speed: -4.8, throttle: -1, wantEsc: EscReverse, wantSpeed: -4.8, wantCurrent: 60.5},
+		{name: "release in reverse coasts", esc: EscReverse, speed: -1, throttle: 0, wantEsc: EscReverse, wantSpeed: -0.85, wantCurrent: 0.5},
+		{name: "push from reverse brakes first", esc: EscReverse, speed: -2, throttle: 1, wantEsc: EscForward, wantSpeed: 0.2, wantCurrent: 60.5},
+	}
+	for _, tc := range tests {
+		car := NewCar(DefaultCarConfig())
+		car.Esc = tc.esc
+		car.Speed = tc.speed
+		car.Update(0, tc.throttle, 100*time.Millisecond)
+		if car.Esc != tc.wantEsc {
+			t.Errorf("%s: esc got %s want %s", tc.name, car.Esc, tc.wantEsc)
+		}
+		if math.Abs(car.Speed-tc.wantSpeed) > tolerance {
+			t.Errorf("%s: speed got %v want %v", tc.name, car.Speed, tc.wantSpeed)
+		}
+		if math.Abs(car.Current-tc.wantCurrent) > tolerance {
+			t.Errorf("%s: current got %v want %v", tc.name, car.Current, tc.wantCurrent)
+		}
+	}
+}
+
+func TestYawAndHeading(t *testing.T) {
+	//45 degrees of lock on a 1m wheelbase at 1m/s turns at 1 rad/s
+	cfg := DefaultCarConfig()
+	cfg.ServoTravel = 45
+	cfg.Wheelbase = 1
+	cfg.Drag = 0
+
+	tests := []struct {
+		name        string
+		steer       float64
+		speed       float64
+		esc         string
+		heading     float64
+		wantYaw     float64
+		wantHeading float64
+	}{
+		{name: "straight", steer: 0, speed: 1, esc: EscForward, heading: 1, wantYaw: 0, wantHeading: 1},
+		{name: "right", steer: 1, speed: 1, esc: EscForward, heading: 1, wantYaw: 1, wantHeading: 1.1},
+		{name: "left", steer: -1, speed: 1, esc: EscForward, heading: 1, wantYaw: -1, wantHeading: 0.9},
+		{name: "right wraps past north", steer: 1, speed: 1, esc: EscForward, heading: 2*math.Pi - 0.05, wantYaw: 1, wantHeading: 0.05},
+		{name: "left wraps past north", steer: -1, speed: 1, esc: EscForward, heading: 0.05, wantYaw: -1, wantHeading: 2*math.Pi - 0.05},
+		{name: "reversing turns the other way", steer: 1, speed: -1, esc: EscReverse, heading: 1, wantYaw: -1, wantHeading: 0.9},
+		{name: "stopped does not turn", steer: 1, speed: 0, esc: EscForward, heading: 1, wantYaw: 0, wantHeading: 1},
+	}
+	for _, tc := range tests {
+		car := NewCar(cfg)
+		car.SteerAngle = tc.steer * cfg.ServoTravel
+		car.Speed = tc.speed
+		car.Esc = tc.esc
+		car.Heading = tc.heading
+		car.Update(tc.steer, 0, 100*time.Millisecond)
+		if math.Abs(car.YawRate-tc.wantYaw) > tolerance {
+			t.Errorf("%s: yaw got %v want %v", tc.name, car.YawRate, tc.wantYaw)
+		}
+		if math.Abs(car.Heading-tc.wantHeading) > tolerance {
+			t.Errorf("%s: heading got %v want %v", tc.name, car.Heading, tc.wantHeading)
+		}
+		if car.Heading < 0 || car.Heading >= 2*math.Pi {
+			t.Errorf("%s: heading %v outside 0 to 2pi", tc.name, car.Heading)
+		}
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	tests := []struct {
+		angle float64
+		want  int
+	}{
+		{angle: 0, want: 500},
+		{angle: 30, want: 750},
+		{angle: -30, want: 300},
+		{angle: 15, want: 625},
+		{angle: -15, want: 400},
+	}
+	for _, tc := range tests {
+		car := NewCar(DefaultCarConfig())
+		car.SteerAngle = tc.angle
+		got := car.Feedback()
+		if got != tc.want {
+			t.Errorf("angle %v: got %d want %d", tc.angle, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package sim
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Speshl/pi_drift_wheel/config"
+	"github.com/Speshl/pi_drift_wheel/transport"
+	"github.com/albenik/go-serial/v2"
+)
+
+const pathPTY = "pty"
+
+// RunCommand starts a simulated car. With the default pty links it prints the device paths
+// to point the app's sbus and crsf paths at
+func RunCommand(ctx context.Context, args []string) error {
+	cfg := DefaultConfig()
+
+	flags := flag.NewFlagSet("sim", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi_drift_wheel sim [flags]")
+		flags.PrintDefaults()
+	}
+	sbusPath := flags.String("sbus", pathPTY, "link the app sends sbus on: pty, a serial device, pipe:// or udp://")
+	crsfPath := flags.String("crsf", pathPTY, "link the app reads crsf telemetry from: pty, a serial device, pipe:// or udp://")
+	flags.IntVar(&cfg.SteerChannel, "steer-channel", cfg.SteerChannel, "sbus channel driving the servo")
+	flags.IntVar(&cfg.EscChannel, "esc-channel", cfg.EscChannel, "sbus channel driving the esc")
+	flags.Float64Var(&cfg.Car.MaxSpeed, "max-speed", cfg.Car.MaxSpeed, "top speed in meters per second")
+	flags.Float64Var(&cfg.Car.ServoSlewRate, "servo-slew", cfg.Car.ServoSlewRate, "servo speed in degrees per second")
+	flags.Float64Var(&cfg.Car.ServoTravel, "servo-travel", cfg.Car.ServoTravel, "servo travel in degrees each side")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if cfg.SteerChannel < 0 || cfg.SteerChannel >= 16 || cfg.EscChannel < 0 || cfg.EscChannel >= 16 {
+		return fmt.Errorf("channels must be 0-15")
+	}
+
+	sbusLink, err := openLink(*sbusPath, "sbus", "0_SBUSPATH",
+		serial.WithBaudrate(100000),
+		serial.WithDataBits(8),
+		serial.WithParity(serial.EvenParity),
+		serial.WithStopBits(serial.TwoStopBits),
+		serial.WithReadTimeout(1000),
+	)
+	if err != nil {
+		return err
+	}
+	crsfLink, err := openLink(*crsfPath, "crsf", "0_CRSFPATH",
+		serial.WithBaudrate(config.CRSFBaudRate),
+		serial.WithDataBits(8),
+		serial.WithParity(serial.NoParity),
+		serial.WithStopBits(serial.OneStopBit),
+	)
+	if err != nil {
+		sbusLink.Close()
+		return err
+	}
+
+	sim, err := NewSim(cfg, sbusLink, crsfLink)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("starting sim", "steer_channel", cfg.SteerChannel, "esc_channel", cfg.EscChannel)
+	defer slog.Info("stopping sim")
+	err = sim.Start(ctx)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func openLink(path string, name string, env string, serialOptions ...serial.Option) (transport.Transport, error) {
+	if path != pathPTY {
+		link, err := transport.Open(path, serialOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed opening %s link %s: %w", name, path, err)
+		}
+		return link, nil
+	}
+
+	pty, err := transport.OpenPTY()
+	if err != nil {
+		return nil, fmt.Errorf("failed opening %s pty: %w", name, err)
+	}
+	slog.Info("sim link ready", "link", name, "path", pty.SlavePath(), "env", config.AppEnvBase+env+"="+pty.SlavePath())
+	return pty, nil
+}
@@ -0,0 +1,203 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/Speshl/pi_drift_wheel/controllers/models"
+	"github.com/Speshl/pi_drift_wheel/crsf"
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+	"github.com/Speshl/pi_drift_wheel/transport"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	physicsRate   = 5 * time.Millisecond
+	attitudeRate  = 20 * time.Millisecond //arduino feedback rate
+	gpsRate       = 100 * time.Millisecond
+	batteryRate   = 500 * time.Millisecond
+	linkStatsRate = 200 * time.Millisecond
+	logRate       = time.Second
+)
+
+type Config struct {
+	Car          CarConfig
+	SteerChannel int
+	EscChannel   int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Car:          DefaultCarConfig(),
+		SteerChannel: 0,
+		EscChannel:   1,
+	}
+}
+
+// Sim reads the sbus frames the app sends, drives a Car with them and answers with crsf telemetry
+type Sim struct {
+	cfg       Config
+	car       *Car
+	sbusIn    *sbus.SBus
+	telemetry transport.Transport
+}
+
+// NewSim takes the link the app transmits sbus on and the link the app reads crsf from
+func NewSim(cfg Config, sbusLink transport.Transport, crsfLink transport.Transport) (*Sim, error) {
+	sbusIn, err := sbus.NewSBus("sim", true, false, &sbus.SBusCfgOpts{
+		Type:      sbus.RxTypeControl,
+		Transport: sbusLink,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating sbus reader: %w", err)
+	}
+	return &Sim{
+		cfg:       cfg,
+		car:       NewCar(cfg.Car),
+		sbusIn:    sbusIn,
+		telemetry: crsfLink,
+	}, nil
+}
+
+func (s *Sim) Start(ctx context.Context) error {
+	group, ctx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		return s.sbusIn.Start(ctx)
+	})
+	group.Go(func() error {
+		defer s.telemetry.Close()
+		return s.run(ctx)
+	})
+	return group.Wait()
+}
+
+func (s *Sim) run(ctx context.Context) error {
+	physicsTicker := time.NewTicker(physicsRate)
+	defer physicsTicker.Stop()
+	attitudeTicker := time.NewTicker(attitudeRate)
+	defer attitudeTicker.Stop()
+	gpsTicker := time.NewTicker(gpsRate)
+	defer gpsTicker.Stop()
+	batteryTicker := time.NewTicker(batteryRate)
+	defer batteryTicker.Stop()
+	linkStatsTicker := time.NewTicker(linkStatsRate)
+	defer linkStatsTicker.Stop()
+	logTicker := time.NewTicker(logRate)
+	defer logTicker.Stop()
+
+	lastUpdate := time.Now()
+	var err error
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-physicsTicker.C:
+			steer, throttle := s.controls()
+			s.car.Update(steer, throttle, now.Sub(lastUpdate))
+			lastUpdate = now
+		case <-attitudeTicker.C:
+			err = s.send(s.attitude())
+		case <-gpsTicker.C:
+			err = s.send(s.gps())
+		case <-batteryTicker.C:
+			err = s.send(s.battery())
+		case <-linkStatsTicker.C:
+			err = s.send(s.linkStats())
+		case <-logTicker.C:
+			lat, long := s.car.Position()
+			slog.Info("sim car",
+				"steer", fmt.Sprintf("%.1f", s.car.SteerAngle),
+				"speed", fmt.Sprintf("%.2f", s.car.Speed),
+				"esc", s.car.Esc,
+				"heading", fmt.Sprintf("%.1f", s.car.Heading*180/math.Pi),
+				"lat", lat,
+				"long", long,
+				"voltage", fmt.Sprintf("%.2f", s.car.Voltage()),
+				"receiving", !s.sbusIn.LastReceived().IsZero(),
+			)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed sending telemetry: %w", err)
+		}
+	}
+}
+
+// controls reads steer and throttle from the last sbus frame, neutral until one arrives
+func (s *Sim) controls() (float64, float64) {
+	if s.sbusIn.LastReceived().IsZero() {
+		return 0, 0
+	}
+	frame := s.sbusIn.GetReadFrame()
+	return channelToUnit(frame.Ch[s.cfg.SteerChannel]), channelToUnit(frame.Ch[s.cfg.EscChannel])
+}
+
+func (s *Sim) send(data []byte) error {
+	_, err := s.telemetry.Write(crsf.EncodeFrame(crsf.AddressTypeFlightController, data))
+	return err
+}
+
+// attitude carries the servo feedback in pitch like the arduino, yaw is the heading
+func (s *Sim) attitude() []byte {
+	heading := s.car.Heading
+	if heading > math.Pi {
+		heading -= 2 * math.Pi
+	}
+	attitude := frames.AttitudeData{
+		Pitch: int16(s.car.Feedback()),
+		Yaw:   int16(heading * 10000),
+	}
+	return attitude.Marshal()
+}
+
+func (s *Sim) gps() []byte {
+	lat, long := s.car.Position()
+	gps := frames.GpsData{
+		Lat:            int32(lat * 10000000),
+		Long:           int32(long * 10000000),
+		Speed:          int16(math.Abs(s.car.Speed) * 3.6 * 10),
+		Course:         int16(uint16(s.car.Heading * 180 / math.Pi * 100)), //unsigned on the wire
+		Altitude:       1000 + 50,
+		SatelliteCount: 12,
+	}
+	return gps.Marshal()
+}
+
+func (s *Sim) battery() []byte {
+	battery := frames.BatterySensorData{
+		Voltage:   int16(s.car.Voltage() * 10),
+		Current:   int16(s.car.Current * 10),
+		Used:      int32(s.car.Used),
+		Remaining: int8(s.car.Remaining()),
+	}
+	return battery.Marshal()
+}
+
+func (s *Sim) linkStats() []byte {
+	linkStats := frames.LinkStatsData{
+		UplinkRssiAnt1:  uint8(45 + rand.Intn(5)),
+		UplinkRssiAnt2:  uint8(47 + rand.Intn(5)),
+		UplinkQuality:   100,
+		UplinkSnr:       int8(9 + rand.Intn(3)),
+		RfMode:          4,
+		Power:           3,
+		DownlinkRssi:    uint8(50 + rand.Intn(5)),
+		DownlinkQuality: 100,
+		DownlinkSnr:     8,
+	}
+	return linkStats.Marshal()
+}
+
+func channelToUnit(value uint16) float64 {
+	if int(value) >= sbus.MidValue {
+		return float64(models.MapToRange(int(value), sbus.MidValue, sbus.MaxValue, 0, 1000)) / 1000
+	}
+	return float64(models.MapToRange(int(value), sbus.MinValue, sbus.MidValue, -1000, 0)) / 1000
+}
@@ -0,0 +1,100 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Speshl/pi_drift_wheel/crsf/frames"
+	sbus "github.com/Speshl/pi_drift_wheel/sbus"
+)
+
+func TestTelemetryEncoding(t *testing.T) {
+	tests := []struct {
+		name         string
+		heading      float64
+		speed        float64
+		wantYaw      int16
+		wantCourse   uint16
+		wantSpeedKmh int16
+	}{
+		{name: "north", heading: 0, speed: 10, wantYaw: 0, wantCourse: 0, wantSpeedKmh: 360},
+		{name: "east", heading: math.Pi / 2, speed: 5, wantYaw: 15707, wantCourse: 9000, wantSpeedKmh: 180},
+		{name: "west is a negative yaw", heading: 3 * math.Pi / 2, speed: 5, wantYaw: -15707, wantCourse: 27000, wantSpeedKmh: 180},
+		{name: "course past int16 stays unsigned", heading: 350 * math.Pi / 180, speed: 1, wantYaw: -1745, wantCourse: 35000, wantSpeedKmh: 36},
+		{name: "reversing speed is positive", heading: 0, speed: -2, wantYaw: 0, wantCourse: 0, wantSpeedKmh: 72},
+	}
+	for _, tc := range tests {
+		s := &Sim{cfg: DefaultConfig(), car: NewCar(DefaultCarConfig())}
+		s.car.Heading = tc.heading
+		s.car.Speed = tc.speed
+		s.car.SteerAngle = 15
+
+		attitude, err := frames.UnmarshalAttitude(s.attitude())
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if attitude.Pitch != 625 {
+			t.Errorf("%s: pitch got %d want the servo feedback 625", tc.name, attitude.Pitch)
+		}
+		if absDiff(int(attitude.Yaw), int(tc.wantYaw)) > 1 {
+			t.Errorf("%s: yaw got %d want %d", tc.name, attitude.Yaw, tc.wantYaw)
+		}
+
+		gps, err := frames.UnmarshalGps(s.gps())
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if absDiff(int(uint16(gps.Course)), int(tc.wantCourse)) > 1 {
+			t.Errorf("%s: course got %d want %d", tc.name, uint16(gps.Course), tc.wantCourse)
+		}
+		if absDiff(int(gps.Speed), int(tc.wantSpeedKmh)) > 1 {
+			t.Errorf("%s: speed got %d want %d", tc.name, gps.Speed, tc.wantSpeedKmh)
+		}
+		if absDiff(int(gps.Lat), 476205000) > 1 || absDiff(int(gps.Long), -1223493000) > 1 || gps.Altitude != 1050 {
+			t.Errorf("%s: position got %d %d %d", tc.name, gps.Lat, gps.Long, gps.Altitude)
+		}
+	}
+}
+
+func TestBatteryEncoding(t *testing.T) {
+	s := &Sim{cfg: DefaultConfig(), car: NewCar(DefaultCarConfig())}
+	s.car.Used = 1250
+	s.car.Current = 20
+
+	battery, err := frames.UnmarshalBatterySensor(s.battery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//2 cells at 4.2V less 0.9V over the quarter used, less 0.2V sag per cell at 20A
+	want := frames.BatterySensorData{Voltage: 75, Current: 200, Used: 1250, Remaining: 75}
+	if battery != want {
+		t.Errorf("got %+v want %+v", battery, want)
+	}
+}
+
+func TestChannelToUnit(t *testing.T) {
+	tests := []struct {
+		value uint16
+		want  float64
+	}{
+		{value: uint16(sbus.MinValue), want: -1},
+		{value: 582, want: -0.5},
+		{value: uint16(sbus.MidValue), want: 0},
+		{value: uint16(sbus.MaxValue), want: 1},
+		{value: 0, want: -1},
+		{value: 2047, want: 1},
+	}
+	for _, tc := range tests {
+		got := channelToUnit(tc.value)
+		if got != tc.want {
+			t.Errorf("%d: got %v want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func absDiff(a int, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
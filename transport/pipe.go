@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+)
+
+const maxPipeBuffer = 64 * 1024 //like a serial line nobody listens to, old bytes are lost past this
+
+var (
+	pipeLock sync.Mutex
+	pipes    = make(map[string]Transport, 4)
+)
+
+type pipeBuffer struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	data   []byte
+	closed bool
+}
+
+// pipeEnd reads from one buffer and writes to the other. Writes never block
+type pipeEnd struct {
+	read  *pipeBuffer
+	write *pipeBuffer
+}
+
+func newPipeBuffer() *pipeBuffer {
+	buffer := &pipeBuffer{
+		data: make([]byte, 0, 1024),
+	}
+	buffer.cond = sync.NewCond(&buffer.lock)
+	return buffer
+}
+
+// NewPipe returns both ends of an in memory link
+func NewPipe() (Transport, Transport) {
+	aToB := newPipeBuffer()
+	bToA := newPipeBuffer()
+	return &pipeEnd{read: bToA, write: aToB}, &pipeEnd{read: aToB, write: bToA}
+}
+
+// RegisterPipe makes one end of a new pipe available to Open as pipe://name and returns the other end
+func RegisterPipe(name string) Transport {
+	local, remote := NewPipe()
+	pipeLock.Lock()
+	defer pipeLock.Unlock()
+	pipes[name] = remote
+	return local
+}
+
+// openPipe hands out a registered end once
+func openPipe(name string) (Transport, error) {
+	pipeLock.Lock()
+	defer pipeLock.Unlock()
+	end, ok := pipes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPipe, name)
+	}
+	delete(pipes, name)
+	return end, nil
+}
+
+func (p *pipeEnd) Read(b []byte) (int, error) {
+	p.read.lock.Lock()
+	defer p.read.lock.Unlock()
+	for len(p.read.data) == 0 && !p.read.closed {
+		p.read.cond.Wait()
+	}
+	if len(p.read.data) == 0 {
+		return 0, ErrClosed
+	}
+	n := copy(b, p.read.data)
+	p.read.data = append(p.read.data[:0], p.read.data[n:]...)
+	return n, nil
+}
+
+func (p *pipeEnd) Write(b []byte) (int, error) {
+	p.write.lock.Lock()
+	defer p.write.lock.Unlock()
+	if p.write.closed {
+		return 0, ErrClosed
+	}
+	p.write.data = append(p.write.data, b...)
+	if over := len(p.write.data) - maxPipeBuffer; over > 0 {
+		p.write.data = append(p.write.data[:0], p.write.data[over:]...)
+	}
+	p.write.cond.Broadcast()
+	return len(b), nil
+}
+
+// Close ends both directions, the other end reads what is left then gets ErrClosed
+func (p *pipeEnd) Close() error {
+	for _, buffer := range []*pipeBuffer{p.read, p.write} {
+		buffer.lock.Lock()
+		buffer.closed = true
+		buffer.cond.Broadcast()
+		buffer.lock.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	a, b := NewPipe()
+
+	_, err := a.Write([]byte("to b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Write([]byte("to a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := b.Read(buf)
+	if err != nil || string(buf[:n]) != "to b" {
+		t.Errorf("b read %q %v", buf[:n], err)
+	}
+	n, err = a.Read(buf)
+	if err != nil || string(buf[:n]) != "to a" {
+		t.Errorf("a read %q %v", buf[:n], err)
+	}
+}
+
+func TestPipeReadWaits(t *testing.T) {
+	a, b := NewPipe()
+	done := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 16)
+		n, _ := b.Read(buf)
+		done <- string(buf[:n])
+	}()
+
+	select {
+	case got := <-done:
+		t.Fatalf("read returned %q before anything was written", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	_, err := a.Write([]byte("late"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-done:
+		if got != "late" {
+			t.Errorf("got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read did not wake on write")
+	}
+}
+
+func TestPipeDropsOldBytes(t *testing.T) {
+	a, b := NewPipe()
+	data := make([]byte, maxPipeBuffer+10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	n, err := a.Write(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("write %d %v", n, err)
+	}
+
+	buf := make([]byte, len(data))
+	n, err = b.Read(buf)
+	if err != nil || n != maxPipeBuffer {
+		t.Fatalf("read %d bytes %v want %d", n, err, maxPipeBuffer)
+	}
+	if buf[0] != data[10] || buf[n-1] != data[len(data)-1] {
+		t.Error("kept the oldest bytes instead of the newest")
+	}
+}
+
+func TestPipeClose(t *testing.T) {
+	a, b := NewPipe()
+	_, err := a.Write([]byte("last"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 16)
+	n, err := b.Read(buf)
+	if err != nil || string(buf[:n]) != "last" {
+		t.Errorf("read after close got %q %v", buf[:n], err)
+	}
+	_, err = b.Read(buf)
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("read got %v want %v", err, ErrClosed)
+	}
+	_, err = b.Write([]byte("x"))
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("write got %v want %v", err, ErrClosed)
+	}
+}
+
+func TestOpenPipe(t *testing.T) {
+	local := RegisterPipe("test")
+	remote, err := Open("pipe://test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Open("pipe://test")
+	if !errors.Is(err, ErrUnknownPipe) {
+		t.Errorf("second open got %v want %v", err, ErrUnknownPipe)
+	}
+
+	_, err = remote.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := local.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("read %q %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// PTY is a pseudo terminal pair. The master end is the Transport, the slave path can be given
+// to anything that expects a serial device, like the app's sbus and crsf paths
+type PTY struct {
+	master    *os.File
+	slave     *os.File //held open so the master does not see EIO while the other side reopens
+	slavePath string
+}
+
+func OpenPTY() (*PTY, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening ptmx: %w", err)
+	}
+
+	err = unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0) //unlockpt
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed unlocking pty: %w", err)
+	}
+	number, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN) //ptsname
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed getting pty number: %w", err)
+	}
+	slavePath := "/dev/pts/" + strconv.Itoa(number)
+
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed opening %s: %w", slavePath, err)
+	}
+
+	//raw mode so frame bytes are not translated or echoed back
+	for _, fd := range []int{int(master.Fd()), int(slave.Fd())} {
+		err = makeRaw(fd)
+		if err != nil {
+			master.Close()
+			slave.Close()
+			return nil, fmt.Errorf("failed setting raw mode on pty: %w", err)
+		}
+	}
+
+	return &PTY{
+		master:    master,
+		slave:     slave,
+		slavePath: slavePath,
+	}, nil
+}
+
+func (p *PTY) SlavePath() string {
+	return p.slavePath
+}
+
+func (p *PTY) Read(b []byte) (int, error) {
+	return p.master.Read(b)
+}
+
+func (p *PTY) Write(b []byte) (int, error) {
+	return p.master.Write(b)
+}
+
+func (p *PTY) Close() error {
+	slaveErr := p.slave.Close()
+	err := p.master.Close()
+	if err != nil {
+		return err
+	}
+	return slaveErr
+}
+
+func makeRaw(fd int) error {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+}
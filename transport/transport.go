@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/albenik/go-serial/v2"
+)
+
+const (
+	SchemePipe = "pipe"
+	SchemeUDP  = "udp"
+)
+
+var (
+	ErrClosed      = fmt.Errorf("transport closed")
+	ErrUnknownPipe = fmt.Errorf("no pipe registered")
+)
+
+// Transport is the byte link sbus and crsf run over. Reads may return 0 bytes on a timeout
+type Transport interface {
+	io.ReadWriteCloser
+}
+
+// Open picks the transport from the path. pipe://name and udp://local?remote=host:port are
+// handled here, anything else is opened as a serial port (including pty slaves) with serialOptions
+func Open(path string, serialOptions ...serial.Option) (Transport, error) {
+	if IsSerial(path) {
+		return OpenSerial(path, serialOptions...)
+	}
+
+	parsed, err := url.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing transport %s: %w", path, err)
+	}
+	switch parsed.Scheme {
+	case SchemePipe:
+		return openPipe(parsed.Host)
+	case SchemeUDP:
+		return OpenUDP(parsed.Host, parsed.Query().Get("remote"))
+	default:
+		return nil, fmt.Errorf("unsupported transport %s", parsed.Scheme)
+	}
+}
+
+// IsSerial is false for paths handled by a non serial transport
+func IsSerial(path string) bool {
+	return !strings.HasPrefix(path, SchemePipe+"://") && !strings.HasPrefix(path, SchemeUDP+"://")
+}
+
+func OpenSerial(path string, options ...serial.Option) (Transport, error) {
+	port, err := serial.Open(path, options...)
+	if err != nil {
+		return nil, err
+	}
+	return port, nil
+}
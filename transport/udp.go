@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// UDP sends each write as one datagram. Without a remote address replies go to the last sender
+type UDP struct {
+	conn *net.UDPConn
+
+	lock    sync.RWMutex
+	remote  *net.UDPAddr
+	dynamic bool //remote follows whoever sent last
+}
+
+func OpenUDP(localAddr string, remoteAddr string) (*UDP, error) {
+	local, err := net.ResolveUDPAddr("udp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed resolving udp address %s: %w", localAddr, err)
+	}
+	var remote *net.UDPAddr
+	if remoteAddr != "" {
+		remote, err = net.ResolveUDPAddr("udp", remoteAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed resolving udp address %s: %w", remoteAddr, err)
+		}
+	}
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, fmt.Errorf("failed listening on %s: %w", localAddr, err)
+	}
+	return &UDP{
+		conn:    conn,
+		remote:  remote,
+		dynamic: remote == nil,
+	}, nil
+}
+
+func (u *UDP) LocalAddr() net.Addr {
+	return u.conn.LocalAddr()
+}
+
+func (u *UDP) Read(b []byte) (int, error) {
+	n, addr, err := u.conn.ReadFromUDP(b)
+	if err != nil {
+		return n, err
+	}
+	if u.dynamic {
+		u.lock.Lock()
+		u.remote = addr
+		u.lock.Unlock()
+	}
+	return n, nil
+}
+
+// Write drops the data until there is somewhere to send it, like an unplugged serial line
+func (u *UDP) Write(b []byte) (int, error) {
+	u.lock.RLock()
+	remote := u.remote
+	u.lock.RUnlock()
+	if remote == nil {
+		return len(b), nil
+	}
+	return u.conn.WriteToUDP(b, remote)
+}
+
+func (u *UDP) Close() error {
+	return u.conn.Close()
+}